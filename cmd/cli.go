@@ -0,0 +1,543 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/farmako/coupon-system/internal/config"
+	"github.com/farmako/coupon-system/internal/couponcsv"
+	"github.com/farmako/coupon-system/internal/database"
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/farmako/coupon-system/internal/logging"
+	"github.com/farmako/coupon-system/internal/repository"
+	"github.com/farmako/coupon-system/internal/service"
+	"github.com/redis/go-redis/v9"
+)
+
+// usageError marks mistakes in the command line itself.
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+// runCLI runs an admin command against the database and returns the process
+// exit code. Commands go through the same services as the HTTP API.
+func runCLI(cfg *config.Config, command string, args []string) int {
+	logger, err := logging.New(os.Stderr, "text", "warn")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	ctx := context.Background()
+	db, err := database.Connect(ctx, cfg.Database, logger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: connecting to database: %v\n", err)
+		return 1
+	}
+	if err := database.Migrate(db); err != nil {
+		fmt.Fprintf(os.Stderr, "error: migrating database: %v\n", err)
+		return 1
+	}
+
+	// Redis is only reached if a command changes a coupon's usage caps.
+	redisClient := redis.NewClient(&redis.Options{
+		Addr:     cfg.Redis.Addr,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+	})
+	defer redisClient.Close()
+
+	c := &cli{
+		admin: service.NewCouponAdminService(
+			repository.NewCouponRepository(db),
+			repository.NewRedemptionRepository(db),
+			service.NewRedisUsageCounter(redisClient),
+			cfg.Approval,
+			logger,
+		),
+		in:  os.Stdin,
+		out: os.Stdout,
+	}
+
+	err = c.run(ctx, command, args)
+	var usageErr *usageError
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.As(err, &usageErr):
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 2
+	default:
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+}
+
+type cli struct {
+	admin service.CouponAdminService
+	in    io.Reader
+	out   io.Writer
+}
+
+func (c *cli) run(ctx context.Context, command string, args []string) error {
+	if len(args) == 0 {
+		return &usageError{msg: fmt.Sprintf("%s needs a subcommand", command)}
+	}
+	subcommand, args := args[0], args[1:]
+
+	switch command + " " + subcommand {
+	case "coupon create":
+		return c.createCoupon(ctx, args)
+	case "coupon list":
+		return c.listCoupons(ctx, args)
+	case "coupon show":
+		return c.showCoupon(ctx, args)
+	case "coupon publish":
+		return c.changeCoupon(ctx, "publish", args, c.admin.PublishCoupon)
+	case "coupon pause", "coupon disable":
+		// disable is the command's former name.
+		return c.changeCoupon(ctx, subcommand, args, c.admin.PauseCoupon)
+	case "coupon resume":
+		return c.changeCoupon(ctx, "resume", args, c.admin.ResumeCoupon)
+	case "coupon delete":
+		return c.deleteCoupon(ctx, args)
+	case "coupon import":
+		return c.importCoupons(ctx, args)
+	case "coupon export":
+		return c.exportCoupons(ctx, args)
+	case "redemptions list":
+		return c.listRedemptions(ctx, args)
+	default:
+		return &usageError{msg: fmt.Sprintf("unknown command %q", command+" "+subcommand)}
+	}
+}
+
+// flagSet holds the flags every command accepts.
+type flagSet struct {
+	*flag.FlagSet
+	tenant *string
+}
+
+func newFlagSet(name string) *flagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	return &flagSet{
+		FlagSet: fs,
+		tenant:  fs.String("tenant", domain.DefaultTenant, "tenant to act for"),
+	}
+}
+
+// parse parses args and returns a context acting for the selected tenant as
+// the operator running the command.
+func (fs *flagSet) parse(ctx context.Context, args []string) (context.Context, error) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		}
+		return nil, &usageError{msg: err.Error()}
+	}
+	if !domain.IsValidTenantID(*fs.tenant) {
+		return nil, &usageError{msg: fmt.Sprintf("invalid tenant %q", *fs.tenant)}
+	}
+
+	operator := os.Getenv("USER")
+	if operator == "" {
+		operator = "unknown"
+	}
+	ctx = domain.ContextWithTenant(ctx, *fs.tenant)
+	return domain.ContextWithPrincipal(ctx, &domain.Principal{
+		ID:     "cli:" + operator,
+		Name:   operator,
+		Type:   domain.PrincipalCLI,
+		Scopes: []string{domain.ScopeAdmin},
+	}), nil
+}
+
+// code returns the single positional CODE argument.
+func (fs *flagSet) code() (string, error) {
+	if fs.NArg() != 1 {
+		return "", &usageError{msg: fmt.Sprintf("%s takes exactly one coupon code", fs.Name())}
+	}
+	return fs.Arg(0), nil
+}
+
+func (c *cli) createCoupon(ctx context.Context, args []string) error {
+	fs := newFlagSet("coupon create")
+	code := fs.String("code", "", "coupon code (required)")
+	discountType := fs.String("discount-type", string(domain.Percentage), "percentage, fixed, per_unit or buy_x_get_y")
+	var discountValue, minOrderValue, budget domain.Money
+	fs.Var(&discountValue, "discount-value", "percentage, fixed amount or amount per unit off")
+	currency := fs.String("currency", domain.DefaultCurrency, "ISO 4217 currency code of the coupon's amounts")
+	buy := fs.Int("buy", 0, "units to buy for a buy_x_get_y coupon")
+	get := fs.Int("get", 0, "units given free for every -buy units of a buy_x_get_y coupon")
+	tiers := fs.String("tiers", "", "comma-separated MIN_ORDER:DISCOUNT tiers used instead of -discount-value, e.g. 500:5,1000:10")
+	starts := fs.String("starts", "", "start as YYYY-MM-DD or RFC 3339 (default now)")
+	expires := fs.String("expires", "", "expiry as YYYY-MM-DD or RFC 3339 (required)")
+	draft := fs.Bool("draft", false, "create the coupon as a draft")
+	usageType := fs.String("usage-type", string(domain.MultiUse), "one_time, multi_use or time_based")
+	fs.Var(&minOrderValue, "min-order-value", "minimum order value")
+	maxUsagePerUser := fs.Int("max-usage-per-user", 0, "redemptions allowed per user (0 for unlimited)")
+	maxTotalUsage := fs.Int("max-total-usage", 0, "redemptions allowed across all users (0 for unlimited)")
+	fs.Var(&budget, "budget", "total discount the coupon may give (0 for unlimited)")
+	medicines := fs.String("medicines", "", "comma-separated applicable medicine IDs")
+	categories := fs.String("categories", "", "comma-separated applicable categories")
+	terms := fs.String("terms", "", "terms and conditions")
+	days := fs.String("days", "", "comma-separated days the coupon is valid on, e.g. mon,tue (default every day)")
+	hours := fs.String("hours", "", "comma-separated daily hours the coupon is valid for, e.g. 18:00-21:00 (default all day)")
+	timeZone := fs.String("time-zone", "", "IANA time zone for -days and -hours (default UTC)")
+
+	ctx, err := fs.parse(ctx, args)
+	if err != nil {
+		return err
+	}
+	expiryDate, err := parseTime(*expires)
+	if err != nil {
+		return &usageError{msg: fmt.Sprintf("-expires: %v", err)}
+	}
+	var startDate *time.Time
+	if *starts != "" {
+		t, err := time.Parse(time.DateOnly, *starts)
+		if err != nil {
+			if t, err = time.Parse(time.RFC3339, *starts); err != nil {
+				return &usageError{msg: fmt.Sprintf("-starts: %q is not YYYY-MM-DD or RFC 3339", *starts)}
+			}
+		}
+		startDate = &t
+	}
+
+	var schedule *domain.Schedule
+	if *days != "" || *hours != "" || *timeZone != "" {
+		schedule = &domain.Schedule{TimeZone: *timeZone}
+		for _, day := range splitList(*days) {
+			schedule.Days = append(schedule.Days, domain.Weekday(strings.ToLower(day)))
+		}
+		for _, value := range splitList(*hours) {
+			hourRange, err := domain.ParseHourRange(value)
+			if err != nil {
+				return &usageError{msg: fmt.Sprintf("-hours: %v", err)}
+			}
+			schedule.Hours = append(schedule.Hours, hourRange)
+		}
+	}
+
+	var discountTiers domain.DiscountTiers
+	for _, value := range splitList(*tiers) {
+		tier, err := domain.ParseDiscountTier(value)
+		if err != nil {
+			return &usageError{msg: fmt.Sprintf("-tiers: %v", err)}
+		}
+		discountTiers = append(discountTiers, tier)
+	}
+
+	coupon, err := c.admin.CreateCoupon(ctx, &domain.Coupon{
+		Code:                  *code,
+		StartDate:             startDate,
+		Schedule:              schedule,
+		ExpiryDate:            expiryDate,
+		UsageType:             domain.UsageType(*usageType),
+		ApplicableMedicineIDs: splitList(*medicines),
+		ApplicableCategories:  splitList(*categories),
+		MinOrderValue:         minOrderValue,
+		TermsAndConditions:    *terms,
+		Currency:              strings.ToUpper(*currency),
+		DiscountType:          domain.DiscountType(*discountType),
+		DiscountValue:         discountValue,
+		Tiers:                 discountTiers,
+		BuyQuantity:           *buy,
+		GetQuantity:           *get,
+		MaxUsagePerUser:       *maxUsagePerUser,
+		MaxTotalUsage:         *maxTotalUsage,
+		Budget:                budget,
+		Draft:                 *draft,
+	})
+	if err != nil {
+		return err
+	}
+	return c.writeJSON(coupon)
+}
+
+func (c *cli) listCoupons(ctx context.Context, args []string) error {
+	fs := newFlagSet("coupon list")
+	asJSON := fs.Bool("json", false, "print JSON instead of a table")
+	ctx, err := fs.parse(ctx, args)
+	if err != nil {
+		return err
+	}
+
+	coupons, err := c.admin.ListCoupons(ctx)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return c.writeJSON(coupons)
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CODE\tDISCOUNT\tUSAGE\tSTARTS\tEXPIRES\tSTATUS")
+	now := time.Now()
+	for _, coupon := range coupons {
+		starts := "-"
+		if coupon.StartDate != nil {
+			starts = coupon.StartDate.Format(time.DateOnly)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			coupon.Code,
+			formatDiscount(&coupon),
+			coupon.UsageType,
+			starts,
+			coupon.ExpiryDate.Format(time.DateOnly),
+			coupon.Status(now),
+		)
+	}
+	return w.Flush()
+}
+
+func (c *cli) showCoupon(ctx context.Context, args []string) error {
+	fs := newFlagSet("coupon show")
+	ctx, err := fs.parse(ctx, args)
+	if err != nil {
+		return err
+	}
+	code, err := fs.code()
+	if err != nil {
+		return err
+	}
+
+	coupon, err := c.admin.GetCoupon(ctx, code)
+	if err != nil {
+		return err
+	}
+	return c.writeJSON(coupon)
+}
+
+// changeCoupon runs a lifecycle change, such as pause, on one coupon.
+func (c *cli) changeCoupon(ctx context.Context, action string, args []string, change func(context.Context, string) (*domain.Coupon, error)) error {
+	fs := newFlagSet("coupon " + action)
+	ctx, err := fs.parse(ctx, args)
+	if err != nil {
+		return err
+	}
+	code, err := fs.code()
+	if err != nil {
+		return err
+	}
+
+	coupon, err := change(ctx, code)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "Coupon %s is now %s\n", code, coupon.Status(time.Now()))
+	return nil
+}
+
+func (c *cli) deleteCoupon(ctx context.Context, args []string) error {
+	fs := newFlagSet("coupon delete")
+	ctx, err := fs.parse(ctx, args)
+	if err != nil {
+		return err
+	}
+	code, err := fs.code()
+	if err != nil {
+		return err
+	}
+
+	if err := c.admin.DeleteCoupon(ctx, code); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "Coupon %s deleted\n", code)
+	return nil
+}
+
+func (c *cli) importCoupons(ctx context.Context, args []string) error {
+	fs := newFlagSet("coupon import")
+	dryRun := fs.Bool("dry-run", false, "only validate the file")
+	asJSON := fs.Bool("json", false, "print the result as JSON")
+	ctx, err := fs.parse(ctx, args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return &usageError{msg: "coupon import takes exactly one file (- for stdin)"}
+	}
+
+	var in io.Reader = c.in
+	if path := fs.Arg(0); path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	rows, err := couponcsv.Decode(in)
+	if err != nil {
+		return fmt.Errorf("invalid CSV: %w", err)
+	}
+	result, err := c.admin.ImportCoupons(ctx, rows, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		if err := c.writeJSON(result); err != nil {
+			return err
+		}
+	} else {
+		for _, rowErr := range result.Errors {
+			if rowErr.Code != "" {
+				fmt.Fprintf(c.out, "line %d (%s): %s\n", rowErr.Line, rowErr.Code, rowErr.Error)
+			} else {
+				fmt.Fprintf(c.out, "line %d: %s\n", rowErr.Line, rowErr.Error)
+			}
+		}
+		fmt.Fprintf(c.out, "%d rows, %d valid, %d pending approval, %d imported\n",
+			result.Rows, result.Valid, result.PendingApproval, result.Imported)
+	}
+
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("%d of %d rows have errors; nothing was imported", len(result.Errors), result.Rows)
+	}
+	return nil
+}
+
+func (c *cli) exportCoupons(ctx context.Context, args []string) error {
+	fs := newFlagSet("coupon export")
+	output := fs.String("o", "-", "file to write (- for stdout)")
+	ctx, err := fs.parse(ctx, args)
+	if err != nil {
+		return err
+	}
+
+	coupons, err := c.admin.ListCoupons(ctx)
+	if err != nil {
+		return err
+	}
+	if *output == "-" {
+		return couponcsv.Encode(c.out, coupons)
+	}
+
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := couponcsv.Encode(f, coupons); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (c *cli) listRedemptions(ctx context.Context, args []string) error {
+	fs := newFlagSet("redemptions list")
+	code := fs.String("coupon", "", "only redemptions of this coupon code")
+	userID := fs.String("user", "", "only redemptions by this user ID")
+	limit := fs.Int("limit", 50, "maximum number of redemptions to show (0 for all)")
+	asJSON := fs.Bool("json", false, "print JSON instead of a table")
+	ctx, err := fs.parse(ctx, args)
+	if err != nil {
+		return err
+	}
+
+	redemptions, err := c.admin.ListRedemptions(ctx, repository.RedemptionFilter{
+		CouponCode: *code,
+		UserID:     *userID,
+		Limit:      *limit,
+	})
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return c.writeJSON(redemptions)
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "REDEEMED AT\tCOUPON\tORDER\tUSER\tORDER VALUE\tDISCOUNT\tREFUNDED")
+	for _, redemption := range redemptions {
+		refunded := "-"
+		if redemption.Reversed() {
+			refunded = "reversed"
+		} else if redemption.RefundedAmount > 0 {
+			refunded = redemption.RefundedAmount.StringFixed()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			redemption.CreatedAt.Format(time.RFC3339),
+			redemption.CouponCode,
+			redemption.OrderID,
+			redemption.UserID,
+			redemption.OrderValue.StringFixed(),
+			redemption.Discount.StringFixed(),
+			refunded,
+		)
+	}
+	return w.Flush()
+}
+
+func (c *cli) writeJSON(v any) error {
+	encoder := json.NewEncoder(c.out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func formatDiscount(coupon *domain.Coupon) string {
+	switch coupon.DiscountType {
+	case domain.BuyXGetY:
+		return fmt.Sprintf("buy %d get %d", coupon.BuyQuantity, coupon.GetQuantity)
+	case domain.PerUnit:
+		return coupon.DiscountValue.StringFixed() + " per unit"
+	}
+	if len(coupon.Tiers) > 0 {
+		tiers := make([]string, len(coupon.Tiers))
+		for i, tier := range coupon.Tiers {
+			tiers[i] = formatDiscountValue(coupon.DiscountType, tier.DiscountValue) + " over " + tier.MinOrderValue.String()
+		}
+		return strings.Join(tiers, ", ")
+	}
+	return formatDiscountValue(coupon.DiscountType, coupon.DiscountValue)
+}
+
+func formatDiscountValue(discountType domain.DiscountType, value domain.Money) string {
+	if discountType == domain.Percentage {
+		return value.String() + "%"
+	}
+	return value.StringFixed()
+}
+
+// parseTime accepts a date, which means the end of that day in UTC, or a full
+// RFC 3339 timestamp.
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, errors.New("is required")
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t.Add(24*time.Hour - time.Second), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not YYYY-MM-DD or RFC 3339", value)
+	}
+	return t, nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/farmako/coupon-system/internal/database"
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/farmako/coupon-system/internal/logging"
+	"github.com/farmako/coupon-system/internal/repository"
+	"github.com/farmako/coupon-system/internal/service"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestCLI(t *testing.T) (*cli, *bytes.Buffer, repository.RedemptionRepository) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, database.Migrate(db))
+
+	redemptions := repository.NewRedemptionRepository(db)
+	out := &bytes.Buffer{}
+	return &cli{
+		admin: service.NewCouponAdminService(
+			repository.NewCouponRepository(db),
+			redemptions,
+			// No command changes usage caps, so the usage counter is unused.
+			nil,
+			service.ApprovalPolicy{PercentageThreshold: domain.MoneyFromInt(50)},
+			logging.Discard(),
+		),
+		in:  &bytes.Buffer{},
+		out: out,
+	}, out, redemptions
+}
+
+func TestCouponCommands(t *testing.T) {
+	ctx := context.Background()
+	c, out, _ := newTestCLI(t)
+
+	err := c.run(ctx, "coupon", []string{"create",
+		"-code", "SAVE10", "-discount-type", "percentage", "-discount-value", "10",
+		"-expires", "2099-12-31", "-max-usage-per-user", "2",
+	})
+	require.NoError(t, err)
+
+	var created domain.Coupon
+	require.NoError(t, json.Unmarshal(out.Bytes(), &created))
+	assert.Equal(t, "SAVE10", created.Code)
+	assert.Equal(t, 2, created.MaxUsagePerUser)
+	assert.Equal(t, domain.Approved, created.ApprovalStatus)
+	assert.Contains(t, created.CreatedBy, "cli:")
+
+	out.Reset()
+	require.NoError(t, c.run(ctx, "coupon", []string{"list"}))
+	assert.Contains(t, out.String(), "SAVE10")
+	assert.Contains(t, out.String(), "10%")
+	assert.Contains(t, out.String(), "active")
+
+	out.Reset()
+	require.NoError(t, c.run(ctx, "coupon", []string{"pause", "SAVE10"}))
+	assert.Contains(t, out.String(), "Coupon SAVE10 is now paused")
+	out.Reset()
+	require.NoError(t, c.run(ctx, "coupon", []string{"show", "SAVE10"}))
+	var shown domain.Coupon
+	require.NoError(t, json.Unmarshal(out.Bytes(), &shown))
+	assert.True(t, shown.Paused)
+	assert.Contains(t, out.String(), `"status": "paused"`)
+
+	out.Reset()
+	require.NoError(t, c.run(ctx, "coupon", []string{"resume", "SAVE10"}))
+	assert.Contains(t, out.String(), "Coupon SAVE10 is now active")
+
+	out.Reset()
+	require.NoError(t, c.run(ctx, "coupon", []string{"disable", "SAVE10"}))
+	assert.Contains(t, out.String(), "Coupon SAVE10 is now paused")
+
+	require.NoError(t, c.run(ctx, "coupon", []string{"delete", "SAVE10"}))
+	err = c.run(ctx, "coupon", []string{"show", "SAVE10"})
+	assert.IsType(t, &domain.CouponNotFoundError{}, err)
+}
+
+func TestDraftAndScheduledCoupons(t *testing.T) {
+	ctx := context.Background()
+	c, out, _ := newTestCLI(t)
+
+	require.NoError(t, c.run(ctx, "coupon", []string{"create",
+		"-code", "DIWALI20", "-discount-type", "percentage", "-discount-value", "20",
+		"-starts", "2098-11-01", "-expires", "2098-11-05", "-draft",
+	}))
+	out.Reset()
+	require.NoError(t, c.run(ctx, "coupon", []string{"list"}))
+	assert.Contains(t, out.String(), "2098-11-01")
+	assert.Contains(t, out.String(), "draft")
+
+	out.Reset()
+	require.NoError(t, c.run(ctx, "coupon", []string{"publish", "DIWALI20"}))
+	assert.Contains(t, out.String(), "Coupon DIWALI20 is now scheduled")
+
+	err := c.run(ctx, "coupon", []string{"resume", "DIWALI20"})
+	assert.IsType(t, &domain.ConflictError{}, err)
+}
+
+func TestCouponCommandsAreTenantScoped(t *testing.T) {
+	ctx := context.Background()
+	c, out, _ := newTestCLI(t)
+
+	require.NoError(t, c.run(ctx, "coupon", []string{"create",
+		"-tenant", "brand-b", "-code", "BRANDB", "-discount-type", "fixed",
+		"-discount-value", "25", "-expires", "2099-01-01T00:00:00Z",
+	}))
+
+	out.Reset()
+	require.NoError(t, c.run(ctx, "coupon", []string{"list"}))
+	assert.NotContains(t, out.String(), "BRANDB")
+
+	out.Reset()
+	require.NoError(t, c.run(ctx, "coupon", []string{"list", "-tenant", "brand-b"}))
+	assert.Contains(t, out.String(), "BRANDB")
+}
+
+func TestRedemptionsList(t *testing.T) {
+	ctx := context.Background()
+	c, out, redemptions := newTestCLI(t)
+
+	for _, r := range []domain.Redemption{
+		{ID: uuid.New(), CouponCode: "SAVE10", UserID: "user-1", OrderID: "order-1", OrderValue: domain.MoneyFromInt(200), Discount: domain.MoneyFromInt(20)},
+		{ID: uuid.New(), CouponCode: "SAVE10", UserID: "user-2", OrderID: "order-2", OrderValue: domain.MoneyFromInt(100), Discount: domain.MoneyFromInt(10)},
+		{ID: uuid.New(), CouponCode: "FLAT50", UserID: "user-1", OrderID: "order-3", OrderValue: domain.MoneyFromInt(300), Discount: domain.MoneyFromInt(50)},
+	} {
+		require.NoError(t, redemptions.Create(ctx, &r))
+	}
+
+	require.NoError(t, c.run(ctx, "redemptions", []string{"list", "-coupon", "SAVE10", "-json"}))
+	var listed []domain.Redemption
+	require.NoError(t, json.Unmarshal(out.Bytes(), &listed))
+	assert.Len(t, listed, 2)
+
+	out.Reset()
+	require.NoError(t, c.run(ctx, "redemptions", []string{"list", "-user", "user-1"}))
+	assert.Contains(t, out.String(), "order-1")
+	assert.Contains(t, out.String(), "order-3")
+	assert.NotContains(t, out.String(), "order-2")
+}
+
+func TestCouponImportExport(t *testing.T) {
+	ctx := context.Background()
+	c, out, _ := newTestCLI(t)
+
+	path := filepath.Join(t.TempDir(), "coupons.csv")
+	require.NoError(t, os.WriteFile(path, []byte(
+		"code,usage_type,discount_type,discount_value,expiry_date,min_order_value\n"+
+			"SAVE10,multi_use,percentage,10,2099-12-31,100\n"+
+			"HALF,one_time,percentage,60,2099-12-31,\n"), 0o600))
+
+	require.NoError(t, c.run(ctx, "coupon", []string{"import", "-dry-run", path}))
+	assert.Contains(t, out.String(), "2 rows, 2 valid, 1 pending approval, 0 imported")
+
+	out.Reset()
+	require.NoError(t, c.run(ctx, "coupon", []string{"list"}))
+	assert.NotContains(t, out.String(), "SAVE10")
+
+	out.Reset()
+	require.NoError(t, c.run(ctx, "coupon", []string{"import", path}))
+	assert.Contains(t, out.String(), "2 imported")
+
+	out.Reset()
+	require.NoError(t, c.run(ctx, "coupon", []string{"export"}))
+	assert.Contains(t, out.String(), "SAVE10,multi_use,percentage,10,INR,,0,0,100,0,0,0,,2099-12-31T23:59:59Z,,,,,,,,,,false,false\n")
+	assert.Contains(t, out.String(), "HALF,one_time,percentage,60")
+
+	// Importing the same file again fails on every row and creates nothing.
+	out.Reset()
+	err := c.run(ctx, "coupon", []string{"import", path})
+	require.Error(t, err)
+	assert.Contains(t, out.String(), "line 2 (SAVE10): coupon SAVE10 already exists")
+	assert.Contains(t, out.String(), "line 3 (HALF): coupon HALF already exists")
+}
+
+func TestCLIUsageErrors(t *testing.T) {
+	ctx := context.Background()
+	c, _, _ := newTestCLI(t)
+
+	tests := []struct {
+		name    string
+		command string
+		args    []string
+	}{
+		{name: "missing subcommand", command: "coupon"},
+		{name: "unknown subcommand", command: "coupon", args: []string{"frobnicate"}},
+		{name: "missing code", command: "coupon", args: []string{"show"}},
+		{name: "bad expiry", command: "coupon", args: []string{"create", "-code", "X", "-expires", "tomorrow"}},
+		{name: "import without file", command: "coupon", args: []string{"import"}},
+		{name: "bad tenant", command: "coupon", args: []string{"list", "-tenant", "Not A Tenant"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := c.run(ctx, tt.command, tt.args)
+			assert.IsType(t, &usageError{}, err)
+		})
+	}
+}
@@ -2,26 +2,34 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
+	// Coupon schedules name IANA time zones; the runtime image has no zoneinfo.
+	_ "time/tzdata"
 
+	"github.com/farmako/coupon-system/internal/auth"
+	"github.com/farmako/coupon-system/internal/config"
+	"github.com/farmako/coupon-system/internal/database"
 	"github.com/farmako/coupon-system/internal/domain"
 	"github.com/farmako/coupon-system/internal/handler"
+	"github.com/farmako/coupon-system/internal/health"
+	"github.com/farmako/coupon-system/internal/logging"
+	"github.com/farmako/coupon-system/internal/metrics"
 	"github.com/farmako/coupon-system/internal/middleware"
 	"github.com/farmako/coupon-system/internal/repository"
 	"github.com/farmako/coupon-system/internal/service"
+	"github.com/farmako/coupon-system/internal/tracing"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"github.com/redis/go-redis/v9"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
 )
 
 // @title Coupon System API
@@ -43,117 +51,274 @@ import (
 // @securityDefinitions.apikey ApiKeyAuth
 // @in header
 // @name Authorization
+
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
 func main() {
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML config file")
+	flag.Usage = usage
+	flag.Parse()
+
 	// Load environment variables
-	if err := godotenv.Load(); err != nil {
-		log.Printf("Warning: .env file not found")
+	envErr := godotenv.Load()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	command, args := "serve", flag.Args()
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+
+	switch command {
+	case "serve":
+		serve(cfg, envErr != nil)
+	case "coupon", "redemptions":
+		os.Exit(runCLI(cfg, command, args))
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", command)
+		usage()
+		os.Exit(2)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage: %s [-config file] <command> [arguments]
+
+Commands:
+  serve                          run the HTTP server (default)
+  coupon create [flags]          create a coupon
+  coupon list [flags]            list coupons
+  coupon show [flags] CODE       print a coupon as JSON
+  coupon publish [flags] CODE    take a draft coupon live
+  coupon pause [flags] CODE      stop a coupon from being redeemed (alias: disable)
+  coupon resume [flags] CODE     resume a paused coupon
+  coupon delete [flags] CODE     delete a coupon
+  coupon import [flags] FILE     create coupons from a CSV file (- for stdin)
+  coupon export [flags]          write every coupon as CSV
+  redemptions list [flags]       list recent redemptions
+
+Run a command with -h for its flags.
+
+Global flags:
+`, os.Args[0])
+	flag.PrintDefaults()
+}
+
+// serve runs the HTTP API until it receives a termination signal.
+func serve(cfg *config.Config, missingEnvFile bool) {
+	logger, err := logging.New(os.Stdout, cfg.Log.Format, cfg.Log.Level)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize logger: %v\n", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+	if missingEnvFile {
+		logger.Warn(".env file not found")
 	}
 
-	db, err := initDB()
+	appMetrics := metrics.New()
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		fatal("Failed to initialize tracing", err)
+	}
+
+	db, err := database.Connect(context.Background(), cfg.Database, logger)
+	if err != nil {
+		fatal("Failed to connect to database", err)
+	}
+	if err := database.Migrate(db); err != nil {
+		fatal("Failed to migrate database", err)
+	}
+	sqlDB, err := db.DB()
 	if err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+		fatal("Failed to access database pool", err)
+	}
+	if err := appMetrics.RegisterDBStats(sqlDB, cfg.Database.Name); err != nil {
+		fatal("Failed to register database pool metrics", err)
+	}
+	if err := appMetrics.InstrumentDB(db); err != nil {
+		fatal("Failed to instrument database", err)
+	}
+	if err := tracing.InstrumentDB(db); err != nil {
+		fatal("Failed to instrument database", err)
 	}
 
-	redisClient := initRedis()
+	redisClient := initRedis(cfg.Redis, logger)
+	redisClient.AddHook(appMetrics.RedisHook())
+	redisClient.AddHook(tracing.RedisHook())
 
 	couponRepo := repository.NewCouponRepository(db)
-	couponService := service.NewCouponService(couponRepo, redisClient)
-	couponHandler := handler.NewCouponHandler(couponService)
-	healthHandler := handler.NewHealthHandler(db, redisClient)
+	redemptionRepo := repository.NewRedemptionRepository(db)
+	blackoutRepo := repository.NewBlackoutRepository(db)
+	usageCounter := service.NewRedisUsageCounter(redisClient)
+	couponService := service.NewCouponService(couponRepo, redemptionRepo, blackoutRepo, usageCounter, appMetrics, logger)
+	couponHandler := handler.NewCouponHandler(couponService, logger)
+	// The database is critical; coupons can still be validated, and redeemed
+	// unless they have total caps or the request carries an Idempotency-Key,
+	// without Redis, so Redis only degrades readiness.
+	healthChecker := health.NewChecker(cfg.Server.HealthCheckInterval)
+	healthChecker.Register(health.DatabaseCheck(db, true, cfg.Server.HealthCheckTimeout))
+	healthChecker.Register(health.RedisCheck(redisClient, false, cfg.Server.HealthCheckTimeout))
+	healthHandler := handler.NewHealthHandler(healthChecker)
+
+	couponAdminService := service.NewCouponAdminService(couponRepo, redemptionRepo, usageCounter, cfg.Approval, logger)
+	couponAdminHandler := handler.NewCouponAdminHandler(couponAdminService)
+
+	campaignService := service.NewCampaignService(repository.NewCampaignRepository(db), couponRepo, cfg.Approval, logger)
+	campaignHandler := handler.NewCampaignHandler(campaignService)
+
+	blackoutHandler := handler.NewBlackoutHandler(service.NewBlackoutService(blackoutRepo, logger))
+
+	apiKeyRepo := repository.NewAPIKeyRepository(db)
+	apiKeyService := service.NewAPIKeyService(apiKeyRepo)
+	apiKeyHandler := handler.NewAPIKeyHandler(apiKeyService)
+
+	var tokenVerifier middleware.TokenVerifier
+	if cfg.JWT.Enabled() {
+		jwtVerifier, err := auth.NewJWTVerifier(cfg.JWT)
+		if err != nil {
+			fatal("Failed to initialize JWT verifier", err)
+		}
+		tokenVerifier = jwtVerifier
+	}
+	authenticator := middleware.NewAuthenticator(apiKeyService, tokenVerifier)
 
-	rateLimiter := middleware.NewRateLimiter(redisClient, 100, time.Minute)
+	if cfg.AdminAPIKey != "" {
+		if err := apiKeyService.RegisterKey(context.Background(), "bootstrap-admin", cfg.AdminAPIKey, []string{domain.ScopeAdmin}); err != nil {
+			fatal("Failed to register bootstrap admin key", err)
+		}
+	}
 
-	router := gin.Default()
+	rateLimiter := middleware.NewRateLimiter(redisClient, cfg.RateLimit.Requests, cfg.RateLimit.Window, appMetrics, logger)
+	ipRateLimiter := middleware.NewRateLimiter(redisClient, cfg.RateLimit.IPRequests, cfg.RateLimit.Window, appMetrics, logger)
+	idempotency := middleware.Idempotency(middleware.NewRedisIdempotencyStore(redisClient), cfg.Idempotency.LockTTL, cfg.Idempotency.TTL, logger)
 
-	router.Use(rateLimiter.RateLimit())
+	router := gin.New()
+	router.Use(gin.Recovery(), middleware.RequestID(), tracing.Middleware(), appMetrics.Middleware(), middleware.AccessLog(logger))
 
 	router.GET("/health", healthHandler.HealthCheck)
-
+	router.GET("/livez", healthHandler.Livez)
+	router.GET("/readyz", healthHandler.Readyz)
+	router.GET("/metrics", gin.WrapH(appMetrics.Handler()))
+
+	// API requests are limited per IP first, so that unauthenticated callers
+	// are limited too. Probes and scrapes above are not limited, so that they
+	// keep working while Redis is down. API limits are also tracked per
+	// tenant, so they run once the tenant is known.
 	api := router.Group("/api/v1")
+	api.Use(ipRateLimiter.RateLimitByIP(), authenticator.Authenticate(), middleware.ResolveTenant(), rateLimiter.RateLimit())
 	{
-		api.GET("/coupons/applicable", couponHandler.GetApplicableCoupons)
-		api.POST("/coupons/validate", couponHandler.ValidateCoupon)
+		api.GET("/coupons/applicable", middleware.RequireScope(domain.ScopeCouponsRead), couponHandler.GetApplicableCoupons)
+		api.POST("/coupons/validate", middleware.RequireScope(domain.ScopeCouponsValidate), idempotency, couponHandler.ValidateCoupon)
+		api.POST("/coupons/redeem", middleware.RequireScope(domain.ScopeCouponsRedeem), idempotency, couponHandler.RedeemCoupon)
+		api.POST("/coupons/redemptions/:order_id/reverse", middleware.RequireScope(domain.ScopeCouponsRedeem), idempotency, couponHandler.ReverseRedemption)
+	}
+
+	admin := api.Group("/admin")
+	{
+		admin.GET("/coupons", middleware.RequireScope(domain.ScopeCouponsList), couponAdminHandler.ListCoupons)
+		admin.GET("/coupons/export", middleware.RequireScope(domain.ScopeCouponsList), couponAdminHandler.ExportCoupons)
+		admin.GET("/coupons/:code", middleware.RequireScope(domain.ScopeCouponsList), couponAdminHandler.GetCoupon)
+		admin.POST("/coupons", middleware.RequireScope(domain.ScopeCouponsWrite), couponAdminHandler.CreateCoupon)
+		admin.POST("/coupons/import", middleware.RequireScope(domain.ScopeCouponsWrite), couponAdminHandler.ImportCoupons)
+		admin.PUT("/coupons/:code", middleware.RequireScope(domain.ScopeCouponsWrite), couponAdminHandler.UpdateCoupon)
+		admin.DELETE("/coupons/:code", middleware.RequireScope(domain.ScopeCouponsWrite), couponAdminHandler.DeleteCoupon)
+		admin.POST("/coupons/:code/approve", middleware.RequireScope(domain.ScopeCouponsApprove), couponAdminHandler.ApproveCoupon)
+		admin.POST("/coupons/:code/publish", middleware.RequireScope(domain.ScopeCouponsWrite), couponAdminHandler.PublishCoupon)
+		admin.POST("/coupons/:code/pause", middleware.RequireScope(domain.ScopeCouponsWrite), couponAdminHandler.PauseCoupon)
+		admin.POST("/coupons/:code/resume", middleware.RequireScope(domain.ScopeCouponsWrite), couponAdminHandler.ResumeCoupon)
+		admin.PUT("/coupons/:code/blackouts", middleware.RequireScope(domain.ScopeCouponsWrite), couponAdminHandler.SetCouponBlackouts)
+
+		admin.GET("/campaigns", middleware.RequireScope(domain.ScopeCouponsList), campaignHandler.ListCampaigns)
+		admin.GET("/campaigns/:id", middleware.RequireScope(domain.ScopeCouponsList), campaignHandler.GetCampaign)
+		admin.POST("/campaigns", middleware.RequireScope(domain.ScopeCouponsWrite), campaignHandler.CreateCampaign)
+		admin.POST("/campaigns/:id/approve", middleware.RequireScope(domain.ScopeCouponsApprove), campaignHandler.ApproveCampaign)
+		admin.POST("/campaigns/:id/codes", middleware.RequireScope(domain.ScopeCouponsWrite), campaignHandler.GenerateCodes)
+		admin.GET("/campaigns/:id/codes", middleware.RequireScope(domain.ScopeCouponsList), campaignHandler.ExportCodes)
+
+		admin.GET("/blackouts", middleware.RequireScope(domain.ScopeCouponsList), blackoutHandler.ListBlackouts)
+		admin.POST("/blackouts", middleware.RequireScope(domain.ScopeCouponsWrite), blackoutHandler.CreateBlackout)
+		admin.DELETE("/blackouts/:id", middleware.RequireScope(domain.ScopeCouponsWrite), blackoutHandler.DeleteBlackout)
+
+		admin.POST("/api-keys", middleware.RequireScope(domain.ScopeAdmin), apiKeyHandler.CreateAPIKey)
+		admin.GET("/api-keys", middleware.RequireScope(domain.ScopeAdmin), apiKeyHandler.ListAPIKeys)
+		admin.DELETE("/api-keys/:id", middleware.RequireScope(domain.ScopeAdmin), apiKeyHandler.RevokeAPIKey)
 	}
 
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
 	srv := &http.Server{
-		Addr:    ":8080",
+		Addr:    fmt.Sprintf(":%d", cfg.Server.Port),
 		Handler: router,
 	}
 
 	serverCtx, serverStopCtx := context.WithCancel(context.Background())
+	go healthChecker.Run(serverCtx)
 
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	go func() {
 		<-sig
 
-		shutdownCtx, _ := context.WithTimeout(serverCtx, 30*time.Second)
+		// Fail readiness first so load balancers stop sending new requests,
+		// then stop accepting connections.
+		healthHandler.StartDraining()
+		logger.Info("Draining before shutdown", "delay", cfg.Server.DrainDelay)
+		time.Sleep(cfg.Server.DrainDelay)
+
+		shutdownCtx, cancel := context.WithTimeout(serverCtx, cfg.Server.ShutdownTimeout)
+		defer cancel()
 
 		go func() {
 			<-shutdownCtx.Done()
 			if shutdownCtx.Err() == context.DeadlineExceeded {
-				log.Fatal("graceful shutdown timed out.. forcing exit.")
+				fatal("Graceful shutdown timed out, forcing exit", shutdownCtx.Err())
 			}
 		}()
 
 		err := srv.Shutdown(shutdownCtx)
 		if err != nil {
-			log.Fatal(err)
+			fatal("Failed to shut down server", err)
 		}
 		serverStopCtx()
 	}()
 
-	log.Printf("Server is running on port 8080")
+	logger.Info("Server is running", "port", cfg.Server.Port)
 	err = srv.ListenAndServe()
 	if err != nil && err != http.ErrServerClosed {
-		log.Fatal(err)
+		fatal("Server failed", err)
 	}
 
 	<-serverCtx.Done()
-}
-
-func initDB() (*gorm.DB, error) {
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-		getEnv("DB_HOST", "localhost"),
-		getEnv("DB_USER", "postgres"),
-		getEnv("DB_PASSWORD", "postgres"),
-		getEnv("DB_NAME", "coupon_system"),
-		getEnv("DB_PORT", "5432"),
-	)
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
-	if err != nil {
-		return nil, err
-	}
-
-	if err := db.AutoMigrate(&domain.Coupon{}); err != nil {
-		return nil, err
+	if err := shutdownTracing(context.Background()); err != nil {
+		logger.Error("Failed to flush traces", "error", err)
 	}
-
-	return db, nil
 }
 
-func initRedis() *redis.Client {
+func initRedis(cfg config.RedisConfig, logger *slog.Logger) *redis.Client {
 	redisClient := redis.NewClient(&redis.Options{
-		Addr:     getEnv("REDIS_ADDR", "localhost:6379"),
-		Password: getEnv("REDIS_PASSWORD", ""),
-		DB:       0,
+		Addr:     cfg.Addr,
+		Password: cfg.Password,
+		DB:       cfg.DB,
 	})
 
 	ctx := context.Background()
 	if err := redisClient.Ping(ctx).Err(); err != nil {
-		log.Printf("Warning: Failed to connect to Redis: %v", err)
+		logger.Warn("Failed to connect to Redis", "error", err)
 	}
 
 	return redisClient
 }
 
-func getEnv(key, defaultValue string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
-	}
-	return value
+// fatal logs err and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
@@ -0,0 +1,233 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultUserScopes are granted to end users whose token carries no scope claim.
+var DefaultUserScopes = []string{domain.ScopeCouponsRead, domain.ScopeCouponsValidate}
+
+type JWTConfig struct {
+	// HMACSecretFile holds the shared secret used to verify HS256 tokens.
+	HMACSecretFile string `yaml:"hmac_secret_file"`
+	// PublicKeyFile holds a PEM encoded RSA public key used to verify RS256 tokens.
+	PublicKeyFile string `yaml:"public_key_file"`
+	// JWKSFile holds a JSON Web Key Set; keys are selected by the token's kid header.
+	JWKSFile string `yaml:"jwks_file"`
+	Issuer   string `yaml:"issuer"`
+	Audience string `yaml:"audience"`
+}
+
+// Enabled reports whether any verification key is configured.
+func (c JWTConfig) Enabled() bool {
+	return c.HMACSecretFile != "" || c.PublicKeyFile != "" || c.JWKSFile != ""
+}
+
+type Claims struct {
+	Scope    string      `json:"scope,omitempty"`
+	Role     domain.Role `json:"role,omitempty"`
+	TenantID string      `json:"tenant_id,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// JWTVerifier verifies HS256 and RS256 bearer tokens against keys loaded from
+// local files at startup.
+type JWTVerifier struct {
+	hmacSecret []byte
+	rsaKey     *rsa.PublicKey
+	hmacKeys   map[string][]byte
+	rsaKeys    map[string]*rsa.PublicKey
+	parser     *jwt.Parser
+}
+
+func NewJWTVerifier(cfg JWTConfig) (*JWTVerifier, error) {
+	v := &JWTVerifier{
+		hmacKeys: make(map[string][]byte),
+		rsaKeys:  make(map[string]*rsa.PublicKey),
+	}
+
+	if cfg.HMACSecretFile != "" {
+		secret, err := os.ReadFile(cfg.HMACSecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("read jwt hmac secret: %w", err)
+		}
+		v.hmacSecret = []byte(strings.TrimSpace(string(secret)))
+		if len(v.hmacSecret) == 0 {
+			return nil, errors.New("jwt hmac secret file is empty")
+		}
+	}
+
+	if cfg.PublicKeyFile != "" {
+		pem, err := os.ReadFile(cfg.PublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("read jwt public key: %w", err)
+		}
+		v.rsaKey, err = jwt.ParseRSAPublicKeyFromPEM(pem)
+		if err != nil {
+			return nil, fmt.Errorf("parse jwt public key: %w", err)
+		}
+	}
+
+	if cfg.JWKSFile != "" {
+		if err := v.loadJWKS(cfg.JWKSFile); err != nil {
+			return nil, err
+		}
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg(), jwt.SigningMethodRS256.Alg()}),
+		jwt.WithExpirationRequired(),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	v.parser = jwt.NewParser(opts...)
+
+	return v, nil
+}
+
+// Verify checks the token signature and registered claims and returns the
+// user principal it identifies.
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (*domain.Principal, error) {
+	var claims Claims
+	if _, err := v.parser.ParseWithClaims(token, &claims, v.keyFunc); err != nil {
+		return nil, &domain.InvalidCredentialsError{Reason: err.Error()}
+	}
+
+	if claims.Subject == "" {
+		return nil, &domain.InvalidCredentialsError{Reason: "token has no subject"}
+	}
+
+	if claims.Role != "" && !claims.Role.IsValid() {
+		return nil, &domain.InvalidCredentialsError{Reason: fmt.Sprintf("token has unknown role %q", claims.Role)}
+	}
+
+	if claims.TenantID != "" && !domain.IsValidTenantID(claims.TenantID) {
+		return nil, &domain.InvalidCredentialsError{Reason: fmt.Sprintf("token has invalid tenant %q", claims.TenantID)}
+	}
+
+	scopes := DefaultUserScopes
+	if claims.Scope != "" {
+		scopes = strings.Fields(claims.Scope)
+	}
+
+	return &domain.Principal{
+		ID:       claims.Subject,
+		Name:     claims.Subject,
+		Type:     domain.PrincipalUser,
+		UserID:   claims.Subject,
+		Scopes:   scopes,
+		Role:     claims.Role,
+		TenantID: claims.TenantID,
+	}, nil
+}
+
+// keyFunc picks the verification key by algorithm family so that an RSA public
+// key can never be used as an HMAC secret.
+func (v *JWTVerifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if kid != "" {
+			if key, ok := v.hmacKeys[kid]; ok {
+				return key, nil
+			}
+		}
+		if v.hmacSecret != nil {
+			return v.hmacSecret, nil
+		}
+	case *jwt.SigningMethodRSA:
+		if kid != "" {
+			if key, ok := v.rsaKeys[kid]; ok {
+				return key, nil
+			}
+		}
+		if v.rsaKey != nil {
+			return v.rsaKey, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no verification key for alg %s kid %q", token.Method.Alg(), kid)
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	K   string `json:"k"`
+}
+
+func (v *JWTVerifier) loadJWKS(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read jwks: %w", err)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("parse jwks: %w", err)
+	}
+
+	for _, key := range set.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		if key.Kid == "" {
+			return errors.New("jwks key is missing kid")
+		}
+
+		switch key.Kty {
+		case "RSA":
+			pub, err := parseRSAJWK(key)
+			if err != nil {
+				return fmt.Errorf("jwks key %s: %w", key.Kid, err)
+			}
+			v.rsaKeys[key.Kid] = pub
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(key.K)
+			if err != nil {
+				return fmt.Errorf("jwks key %s: %w", key.Kid, err)
+			}
+			v.hmacKeys[key.Kid] = secret
+		default:
+			return fmt.Errorf("jwks key %s: unsupported kty %q", key.Kid, key.Kty)
+		}
+	}
+
+	return nil
+}
+
+func parseRSAJWK(key jwk) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(key.N)
+	if err != nil {
+		return nil, fmt.Errorf("decode modulus: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(key.E)
+	if err != nil {
+		return nil, fmt.Errorf("decode exponent: %w", err)
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}, nil
+}
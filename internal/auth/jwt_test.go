@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, name string, data []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims jwt.Claims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func userClaims(subject string, expiresIn time.Duration) Claims {
+	return Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject,
+			Issuer:    "farmako",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+		},
+	}
+}
+
+func TestJWTVerifier(t *testing.T) {
+	ctx := context.Background()
+	secret := []byte("super-secret-signing-key")
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	pubDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	require.NoError(t, err)
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+
+	t.Run("should verify HS256 tokens and bind the subject", func(t *testing.T) {
+		verifier, err := NewJWTVerifier(JWTConfig{
+			HMACSecretFile: writeFile(t, "secret", secret),
+			Issuer:         "farmako",
+		})
+		require.NoError(t, err)
+
+		principal, err := verifier.Verify(ctx, sign(t, jwt.SigningMethodHS256, secret, "", userClaims("user-42", time.Hour)))
+		require.NoError(t, err)
+		assert.Equal(t, "user-42", principal.UserID)
+		assert.Equal(t, domain.PrincipalUser, principal.Type)
+		assert.ElementsMatch(t, DefaultUserScopes, principal.Scopes)
+	})
+
+	t.Run("should verify RS256 tokens with a PEM public key", func(t *testing.T) {
+		verifier, err := NewJWTVerifier(JWTConfig{PublicKeyFile: writeFile(t, "key.pem", pubPEM)})
+		require.NoError(t, err)
+
+		principal, err := verifier.Verify(ctx, sign(t, jwt.SigningMethodRS256, rsaKey, "", userClaims("user-7", time.Hour)))
+		require.NoError(t, err)
+		assert.Equal(t, "user-7", principal.UserID)
+	})
+
+	t.Run("should select JWKS keys by kid", func(t *testing.T) {
+		jwks, _ := json.Marshal(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "2024-01",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+			}},
+		})
+		verifier, err := NewJWTVerifier(JWTConfig{JWKSFile: writeFile(t, "jwks.json", jwks)})
+		require.NoError(t, err)
+
+		_, err = verifier.Verify(ctx, sign(t, jwt.SigningMethodRS256, rsaKey, "2024-01", userClaims("user-1", time.Hour)))
+		assert.NoError(t, err)
+
+		_, err = verifier.Verify(ctx, sign(t, jwt.SigningMethodRS256, rsaKey, "unknown", userClaims("user-1", time.Hour)))
+		assert.Error(t, err)
+	})
+
+	t.Run("should reject HS256 tokens signed with the RSA public key", func(t *testing.T) {
+		verifier, err := NewJWTVerifier(JWTConfig{PublicKeyFile: writeFile(t, "key.pem", pubPEM)})
+		require.NoError(t, err)
+
+		_, err = verifier.Verify(ctx, sign(t, jwt.SigningMethodHS256, pubPEM, "", userClaims("attacker", time.Hour)))
+		assert.IsType(t, &domain.InvalidCredentialsError{}, err)
+	})
+
+	t.Run("should reject expired tokens and wrong issuers", func(t *testing.T) {
+		verifier, err := NewJWTVerifier(JWTConfig{
+			HMACSecretFile: writeFile(t, "secret", secret),
+			Issuer:         "farmako",
+		})
+		require.NoError(t, err)
+
+		_, err = verifier.Verify(ctx, sign(t, jwt.SigningMethodHS256, secret, "", userClaims("user-42", -time.Minute)))
+		assert.IsType(t, &domain.InvalidCredentialsError{}, err)
+
+		claims := userClaims("user-42", time.Hour)
+		claims.Issuer = "someone-else"
+		_, err = verifier.Verify(ctx, sign(t, jwt.SigningMethodHS256, secret, "", claims))
+		assert.IsType(t, &domain.InvalidCredentialsError{}, err)
+	})
+
+	t.Run("should use the scope claim when present", func(t *testing.T) {
+		verifier, err := NewJWTVerifier(JWTConfig{HMACSecretFile: writeFile(t, "secret", secret)})
+		require.NoError(t, err)
+
+		claims := userClaims("user-42", time.Hour)
+		claims.Scope = domain.ScopeCouponsRead
+		principal, err := verifier.Verify(ctx, sign(t, jwt.SigningMethodHS256, secret, "", claims))
+		require.NoError(t, err)
+		assert.Equal(t, []string{domain.ScopeCouponsRead}, principal.Scopes)
+	})
+}
@@ -0,0 +1,356 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/farmako/coupon-system/internal/auth"
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/farmako/coupon-system/internal/service"
+	"github.com/farmako/coupon-system/internal/tracing"
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	Server      ServerConfig           `yaml:"server"`
+	Database    DatabaseConfig         `yaml:"database"`
+	Redis       RedisConfig            `yaml:"redis"`
+	RateLimit   RateLimitConfig        `yaml:"rate_limit"`
+	Idempotency IdempotencyConfig      `yaml:"idempotency"`
+	Log         LogConfig              `yaml:"log"`
+	Tracing     tracing.Config         `yaml:"tracing"`
+	JWT         auth.JWTConfig         `yaml:"jwt"`
+	Approval    service.ApprovalPolicy `yaml:"approval"`
+	// AdminAPIKey, when set, is registered as an admin key at startup.
+	AdminAPIKey string `yaml:"admin_api_key"`
+}
+
+type ServerConfig struct {
+	Port            int           `yaml:"port"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// DrainDelay is how long /readyz reports draining before the server stops
+	// accepting connections, giving load balancers time to react.
+	DrainDelay time.Duration `yaml:"drain_delay"`
+	// HealthCheckInterval is how often dependencies are probed in the
+	// background; health endpoints report the latest results.
+	HealthCheckInterval time.Duration `yaml:"health_check_interval"`
+	// HealthCheckTimeout bounds each dependency probe.
+	HealthCheckTimeout time.Duration `yaml:"health_check_timeout"`
+}
+
+type DatabaseConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Name     string `yaml:"name"`
+	SSLMode  string `yaml:"sslmode"`
+
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"`
+
+	// ConnectTimeout bounds how long startup waits for the database. Attempts
+	// are retried after RetryBackoff, doubling up to RetryMaxBackoff.
+	ConnectTimeout  time.Duration `yaml:"connect_timeout"`
+	RetryBackoff    time.Duration `yaml:"retry_backoff"`
+	RetryMaxBackoff time.Duration `yaml:"retry_max_backoff"`
+}
+
+// DSN returns the Postgres connection string.
+func (c DatabaseConfig) DSN() string {
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=%s",
+		c.Host, c.User, c.Password, c.Name, c.Port, c.SSLMode)
+}
+
+type RedisConfig struct {
+	Addr     string `yaml:"addr"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+}
+
+type RateLimitConfig struct {
+	// Requests is the limit per tenant and client IP on the API.
+	Requests int `yaml:"requests"`
+	// IPRequests is the limit per client IP across every route, counted
+	// before authentication.
+	IPRequests int           `yaml:"ip_requests"`
+	Window     time.Duration `yaml:"window"`
+}
+
+type IdempotencyConfig struct {
+	// TTL is how long responses are kept for replay to requests repeating
+	// their Idempotency-Key.
+	TTL time.Duration `yaml:"ttl"`
+	// LockTTL is how long a request holds its key while it runs. It should
+	// exceed the slowest request, and bounds how long a key stays locked if
+	// its request never finishes.
+	LockTTL time.Duration `yaml:"lock_ttl"`
+}
+
+type LogConfig struct {
+	Format string `yaml:"format"`
+	Level  string `yaml:"level"`
+}
+
+// Default returns the configuration used when nothing is overridden.
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Port:                8080,
+			ShutdownTimeout:     30 * time.Second,
+			DrainDelay:          5 * time.Second,
+			HealthCheckInterval: 10 * time.Second,
+			HealthCheckTimeout:  2 * time.Second,
+		},
+		Database: DatabaseConfig{
+			Host:     "localhost",
+			Port:     5432,
+			User:     "postgres",
+			Password: "postgres",
+			Name:     "coupon_system",
+			SSLMode:  "disable",
+
+			MaxOpenConns:    25,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+
+			ConnectTimeout:  time.Minute,
+			RetryBackoff:    500 * time.Millisecond,
+			RetryMaxBackoff: 10 * time.Second,
+		},
+		Redis: RedisConfig{
+			Addr: "localhost:6379",
+		},
+		RateLimit: RateLimitConfig{
+			Requests:   100,
+			IPRequests: 300,
+			Window:     time.Minute,
+		},
+		Idempotency: IdempotencyConfig{
+			TTL:     24 * time.Hour,
+			LockTTL: 30 * time.Second,
+		},
+		Log: LogConfig{
+			Format: "json",
+			Level:  "info",
+		},
+		Tracing: tracing.Config{
+			Exporter:    tracing.ExporterNone,
+			ServiceName: "coupon-system",
+			SampleRatio: 1,
+		},
+		Approval: service.ApprovalPolicy{
+			PercentageThreshold: domain.MoneyFromInt(50),
+			FixedThreshold:      domain.MoneyFromInt(500),
+		},
+	}
+}
+
+// Load builds the configuration from the defaults, the YAML file at path (if
+// path is not empty) and then environment variables, and validates the result.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading config file: %w", err)
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+		}
+	}
+
+	if err := cfg.applyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// applyEnv overrides settings from environment variables. Variable names match
+// the ones the service has always read.
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	vars := []struct {
+		name string
+		set  func(string) error
+	}{
+		{"PORT", intVar(&c.Server.Port)},
+		{"SHUTDOWN_TIMEOUT", durationVar(&c.Server.ShutdownTimeout)},
+		{"DRAIN_DELAY", durationVar(&c.Server.DrainDelay)},
+		{"HEALTH_CHECK_INTERVAL", durationVar(&c.Server.HealthCheckInterval)},
+		{"HEALTH_CHECK_TIMEOUT", durationVar(&c.Server.HealthCheckTimeout)},
+		{"DB_HOST", stringVar(&c.Database.Host)},
+		{"DB_PORT", intVar(&c.Database.Port)},
+		{"DB_USER", stringVar(&c.Database.User)},
+		{"DB_PASSWORD", stringVar(&c.Database.Password)},
+		{"DB_NAME", stringVar(&c.Database.Name)},
+		{"DB_SSLMODE", stringVar(&c.Database.SSLMode)},
+		{"DB_MAX_OPEN_CONNS", intVar(&c.Database.MaxOpenConns)},
+		{"DB_MAX_IDLE_CONNS", intVar(&c.Database.MaxIdleConns)},
+		{"DB_CONN_MAX_LIFETIME", durationVar(&c.Database.ConnMaxLifetime)},
+		{"DB_CONN_MAX_IDLE_TIME", durationVar(&c.Database.ConnMaxIdleTime)},
+		{"DB_CONNECT_TIMEOUT", durationVar(&c.Database.ConnectTimeout)},
+		{"DB_RETRY_BACKOFF", durationVar(&c.Database.RetryBackoff)},
+		{"DB_RETRY_MAX_BACKOFF", durationVar(&c.Database.RetryMaxBackoff)},
+		{"REDIS_ADDR", stringVar(&c.Redis.Addr)},
+		{"REDIS_PASSWORD", stringVar(&c.Redis.Password)},
+		{"REDIS_DB", intVar(&c.Redis.DB)},
+		{"RATE_LIMIT_REQUESTS", intVar(&c.RateLimit.Requests)},
+		{"RATE_LIMIT_IP_REQUESTS", intVar(&c.RateLimit.IPRequests)},
+		{"RATE_LIMIT_WINDOW", durationVar(&c.RateLimit.Window)},
+		{"IDEMPOTENCY_TTL", durationVar(&c.Idempotency.TTL)},
+		{"IDEMPOTENCY_LOCK_TTL", durationVar(&c.Idempotency.LockTTL)},
+		{"LOG_FORMAT", stringVar(&c.Log.Format)},
+		{"LOG_LEVEL", stringVar(&c.Log.Level)},
+		{"TRACING_EXPORTER", stringVar(&c.Tracing.Exporter)},
+		{"OTEL_SERVICE_NAME", stringVar(&c.Tracing.ServiceName)},
+		{"OTEL_EXPORTER_OTLP_ENDPOINT", stringVar(&c.Tracing.OTLPEndpoint)},
+		{"TRACING_SAMPLE_RATIO", floatVar(&c.Tracing.SampleRatio)},
+		{"JWT_HMAC_SECRET_FILE", stringVar(&c.JWT.HMACSecretFile)},
+		{"JWT_PUBLIC_KEY_FILE", stringVar(&c.JWT.PublicKeyFile)},
+		{"JWT_JWKS_FILE", stringVar(&c.JWT.JWKSFile)},
+		{"JWT_ISSUER", stringVar(&c.JWT.Issuer)},
+		{"JWT_AUDIENCE", stringVar(&c.JWT.Audience)},
+		{"APPROVAL_PERCENTAGE_THRESHOLD", moneyVar(&c.Approval.PercentageThreshold)},
+		{"APPROVAL_FIXED_THRESHOLD", moneyVar(&c.Approval.FixedThreshold)},
+		{"ADMIN_API_KEY", stringVar(&c.AdminAPIKey)},
+	}
+
+	var errs []error
+	for _, v := range vars {
+		value, ok := lookup(v.name)
+		if !ok || value == "" {
+			continue
+		}
+		if err := v.set(value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", v.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Port > 0 && c.Server.Port <= 65535, "server.port must be between 1 and 65535, got %d", c.Server.Port)
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	check(c.Server.DrainDelay >= 0, "server.drain_delay must not be negative")
+	check(c.Server.HealthCheckInterval > 0, "server.health_check_interval must be positive")
+	check(c.Server.HealthCheckTimeout > 0, "server.health_check_timeout must be positive")
+	check(c.Database.Host != "", "database.host is required")
+	check(c.Database.Port > 0 && c.Database.Port <= 65535, "database.port must be between 1 and 65535, got %d", c.Database.Port)
+	check(c.Database.Name != "", "database.name is required")
+	check(c.Database.MaxOpenConns >= 0, "database.max_open_conns must not be negative")
+	check(c.Database.MaxIdleConns >= 0, "database.max_idle_conns must not be negative")
+	check(c.Database.MaxOpenConns == 0 || c.Database.MaxIdleConns <= c.Database.MaxOpenConns,
+		"database.max_idle_conns (%d) must not exceed database.max_open_conns (%d)", c.Database.MaxIdleConns, c.Database.MaxOpenConns)
+	check(c.Database.ConnMaxLifetime >= 0, "database.conn_max_lifetime must not be negative")
+	check(c.Database.ConnMaxIdleTime >= 0, "database.conn_max_idle_time must not be negative")
+	check(c.Database.ConnectTimeout > 0, "database.connect_timeout must be positive")
+	check(c.Database.RetryBackoff > 0, "database.retry_backoff must be positive")
+	check(c.Database.RetryMaxBackoff >= c.Database.RetryBackoff, "database.retry_max_backoff must not be less than database.retry_backoff")
+	check(c.Redis.Addr != "", "redis.addr is required")
+	check(c.Redis.DB >= 0, "redis.db must not be negative")
+	check(c.RateLimit.Requests > 0, "rate_limit.requests must be positive")
+	check(c.RateLimit.IPRequests > 0, "rate_limit.ip_requests must be positive")
+	check(c.RateLimit.Window > 0, "rate_limit.window must be positive")
+	check(c.Idempotency.TTL > 0, "idempotency.ttl must be positive")
+	check(c.Idempotency.LockTTL > 0 && c.Idempotency.LockTTL <= c.Idempotency.TTL, "idempotency.lock_ttl must be positive and not exceed idempotency.ttl")
+
+	switch c.Log.Format {
+	case "json", "text":
+	default:
+		check(false, "log.format must be json or text, got %q", c.Log.Format)
+	}
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		check(false, "log.level must be debug, info, warn or error, got %q", c.Log.Level)
+	}
+
+	switch c.Tracing.Exporter {
+	case tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP:
+	default:
+		check(false, "tracing.exporter must be none, stdout or otlp, got %q", c.Tracing.Exporter)
+	}
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio must be between 0 and 1")
+
+	check(c.Approval.PercentageThreshold >= 0, "approval.percentage_threshold must not be negative")
+	check(c.Approval.FixedThreshold >= 0, "approval.fixed_threshold must not be negative")
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return nil
+}
+
+func stringVar(p *string) func(string) error {
+	return func(value string) error {
+		*p = value
+		return nil
+	}
+}
+
+func intVar(p *int) func(string) error {
+	return func(value string) error {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		*p = parsed
+		return nil
+	}
+}
+
+func floatVar(p *float64) func(string) error {
+	return func(value string) error {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		*p = parsed
+		return nil
+	}
+}
+
+func moneyVar(p *domain.Money) func(string) error {
+	return func(value string) error {
+		parsed, err := domain.ParseMoney(value)
+		if err != nil {
+			return err
+		}
+		*p = parsed
+		return nil
+	}
+}
+
+func durationVar(p *time.Duration) func(string) error {
+	return func(value string) error {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		*p = parsed
+		return nil
+	}
+}
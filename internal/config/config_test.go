@@ -0,0 +1,108 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("defaults are valid", func(t *testing.T) {
+		cfg, err := Load("")
+		require.NoError(t, err)
+		assert.Equal(t, 8080, cfg.Server.Port)
+		assert.Equal(t, 30*time.Second, cfg.Server.ShutdownTimeout)
+		assert.Equal(t, 100, cfg.RateLimit.Requests)
+		assert.Equal(t, 300, cfg.RateLimit.IPRequests)
+	})
+
+	t.Run("file values override defaults and env overrides the file", func(t *testing.T) {
+		path := writeConfig(t, `
+server:
+  port: 9090
+  shutdown_timeout: 10s
+redis:
+  addr: redis:6379
+  db: 2
+rate_limit:
+  requests: 20
+  window: 30s
+approval:
+  fixed_threshold: 1000
+`)
+		t.Setenv("REDIS_DB", "3")
+		t.Setenv("RATE_LIMIT_WINDOW", "2m")
+
+		cfg, err := Load(path)
+		require.NoError(t, err)
+		assert.Equal(t, 9090, cfg.Server.Port)
+		assert.Equal(t, 10*time.Second, cfg.Server.ShutdownTimeout)
+		assert.Equal(t, "redis:6379", cfg.Redis.Addr)
+		assert.Equal(t, 3, cfg.Redis.DB)
+		assert.Equal(t, 20, cfg.RateLimit.Requests)
+		assert.Equal(t, 2*time.Minute, cfg.RateLimit.Window)
+		assert.Equal(t, domain.MoneyFromInt(1000), cfg.Approval.FixedThreshold)
+		assert.Equal(t, domain.MoneyFromInt(50), cfg.Approval.PercentageThreshold)
+	})
+
+	t.Run("unknown keys are rejected", func(t *testing.T) {
+		path := writeConfig(t, "server:\n  prot: 9090\n")
+		_, err := Load(path)
+		assert.ErrorContains(t, err, "prot")
+	})
+
+	t.Run("malformed environment values are reported by name", func(t *testing.T) {
+		t.Setenv("PORT", "eighty")
+		_, err := Load("")
+		assert.ErrorContains(t, err, `PORT: invalid integer "eighty"`)
+	})
+
+	t.Run("approval thresholds are exact amounts", func(t *testing.T) {
+		t.Setenv("APPROVAL_PERCENTAGE_THRESHOLD", "12.5")
+		cfg, err := Load("")
+		require.NoError(t, err)
+		assert.Equal(t, domain.MustParseMoney("12.5"), cfg.Approval.PercentageThreshold)
+
+		t.Setenv("APPROVAL_FIXED_THRESHOLD", "499.999")
+		_, err = Load("")
+		assert.ErrorContains(t, err, `APPROVAL_FIXED_THRESHOLD: "499.999" has more than two decimal places`)
+	})
+
+	t.Run("every invalid setting is reported", func(t *testing.T) {
+		path := writeConfig(t, `
+server:
+  port: 70000
+rate_limit:
+  requests: 0
+idempotency:
+  lock_ttl: 48h
+log:
+  format: xml
+tracing:
+  exporter: zipkin
+`)
+		_, err := Load(path)
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "server.port must be between 1 and 65535, got 70000")
+		assert.ErrorContains(t, err, "rate_limit.requests must be positive")
+		assert.ErrorContains(t, err, "idempotency.lock_ttl must be positive and not exceed idempotency.ttl")
+		assert.ErrorContains(t, err, `log.format must be json or text, got "xml"`)
+		assert.ErrorContains(t, err, `tracing.exporter must be none, stdout or otlp, got "zipkin"`)
+	})
+}
+
+func TestExampleConfigIsValid(t *testing.T) {
+	_, err := Load(filepath.Join("..", "..", "config.example.yaml"))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,463 @@
+// Package couponcsv reads and writes coupons as CSV so they can be planned in
+// spreadsheets. Files written by Encode can be read back by Decode.
+//
+// Cells that a spreadsheet would run as a formula, starting with =, +, - or
+// @, are written with a leading ' so that they stay text. Decode strips it
+// again.
+package couponcsv
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/farmako/coupon-system/internal/domain"
+)
+
+// Column names, in the order Encode writes them.
+const (
+	ColumnCode            = "code"
+	ColumnUsageType       = "usage_type"
+	ColumnDiscountType    = "discount_type"
+	ColumnDiscountValue   = "discount_value"
+	ColumnCurrency        = "currency"
+	ColumnTiers           = "tiers"
+	ColumnBuyQuantity     = "buy_quantity"
+	ColumnGetQuantity     = "get_quantity"
+	ColumnMinOrderValue   = "min_order_value"
+	ColumnMaxUsagePerUser = "max_usage_per_user"
+	ColumnMaxTotalUsage   = "max_total_usage"
+	ColumnBudget          = "budget"
+	ColumnStartDate       = "start_date"
+	ColumnExpiryDate      = "expiry_date"
+	ColumnMedicineIDs     = "applicable_medicine_ids"
+	ColumnCategories      = "applicable_categories"
+	ColumnValidFrom       = "valid_from"
+	ColumnValidUntil      = "valid_until"
+	ColumnScheduleDays    = "schedule_days"
+	ColumnScheduleHours   = "schedule_hours"
+	ColumnScheduleZone    = "schedule_time_zone"
+	ColumnBlackouts       = "blackouts"
+	ColumnTerms           = "terms_and_conditions"
+	ColumnDraft           = "draft"
+	ColumnPaused          = "paused"
+)
+
+var Columns = []string{
+	ColumnCode,
+	ColumnUsageType,
+	ColumnDiscountType,
+	ColumnDiscountValue,
+	ColumnCurrency,
+	ColumnTiers,
+	ColumnBuyQuantity,
+	ColumnGetQuantity,
+	ColumnMinOrderValue,
+	ColumnMaxUsagePerUser,
+	ColumnMaxTotalUsage,
+	ColumnBudget,
+	ColumnStartDate,
+	ColumnExpiryDate,
+	ColumnMedicineIDs,
+	ColumnCategories,
+	ColumnValidFrom,
+	ColumnValidUntil,
+	ColumnScheduleDays,
+	ColumnScheduleHours,
+	ColumnScheduleZone,
+	ColumnBlackouts,
+	ColumnTerms,
+	ColumnDraft,
+	ColumnPaused,
+}
+
+var requiredColumns = []string{ColumnCode, ColumnUsageType, ColumnDiscountType, ColumnDiscountValue, ColumnExpiryDate}
+
+// ListSeparator separates items of the tier, medicine ID, category, schedule
+// and blackout columns, since commas already separate cells. Tiers are
+// written as MIN_ORDER:DISCOUNT and blackouts as NAME@STARTS_AT/ENDS_AT.
+const ListSeparator = ";"
+
+// Decode parses a CSV file with a header row. Columns may appear in any order
+// and optional ones may be left out. Problems with individual rows are
+// reported on the rows; an error is only returned when the file as a whole
+// cannot be read.
+func Decode(r io.Reader) ([]domain.CouponImportRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+	index, err := columnIndex(header)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []domain.CouponImportRow
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		row := domain.CouponImportRow{Line: line}
+		if len(record) != len(header) {
+			row.ParseError = fmt.Sprintf("expected %d fields, got %d", len(header), len(record))
+		} else {
+			row.Coupon, err = parseRecord(record, index)
+			if err != nil {
+				row.ParseError = err.Error()
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+// Encode writes coupons with a header row. It writes nothing and returns an
+// error if a coupon cannot be represented, such as a blackout whose name
+// contains the list separator.
+func Encode(w io.Writer, coupons []domain.Coupon) error {
+	records := make([][]string, 0, len(coupons))
+	for i := range coupons {
+		record, err := formatRecord(&coupons[i])
+		if err != nil {
+			return fmt.Errorf("coupon %s: %w", coupons[i].Code, err)
+		}
+		for j, cell := range record {
+			record[j] = escapeCell(cell)
+		}
+		records = append(records, record)
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(Columns); err != nil {
+		return err
+	}
+	for _, record := range records {
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func columnIndex(header []string) (map[string]int, error) {
+	known := make(map[string]bool, len(Columns))
+	for _, column := range Columns {
+		known[column] = true
+	}
+
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		if i == 0 {
+			// Spreadsheet exports often start with a byte order mark.
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !known[name] {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		if _, ok := index[name]; ok {
+			return nil, fmt.Errorf("duplicate column %q", name)
+		}
+		index[name] = i
+	}
+
+	for _, column := range requiredColumns {
+		if _, ok := index[column]; !ok {
+			return nil, fmt.Errorf("missing required column %q", column)
+		}
+	}
+	return index, nil
+}
+
+// parseRecord reports every malformed field of the record at once.
+func parseRecord(record []string, index map[string]int) (domain.Coupon, error) {
+	get := func(column string) string {
+		if i, ok := index[column]; ok {
+			return unescapeCell(strings.TrimSpace(record[i]))
+		}
+		return ""
+	}
+
+	var problems []string
+	fail := func(column string, err error) {
+		problems = append(problems, fmt.Sprintf("%s: %v", column, err))
+	}
+
+	coupon := domain.Coupon{
+		Code:                  get(ColumnCode),
+		UsageType:             domain.UsageType(get(ColumnUsageType)),
+		DiscountType:          domain.DiscountType(get(ColumnDiscountType)),
+		ApplicableMedicineIDs: splitList(get(ColumnMedicineIDs)),
+		ApplicableCategories:  splitList(get(ColumnCategories)),
+		TermsAndConditions:    get(ColumnTerms),
+		Currency:              strings.ToUpper(get(ColumnCurrency)),
+	}
+
+	var err error
+	if coupon.DiscountValue, err = parseMoney(get(ColumnDiscountValue)); err != nil {
+		fail(ColumnDiscountValue, err)
+	}
+	for _, value := range splitList(get(ColumnTiers)) {
+		tier, err := domain.ParseDiscountTier(value)
+		if err != nil {
+			fail(ColumnTiers, err)
+			continue
+		}
+		coupon.Tiers = append(coupon.Tiers, tier)
+	}
+	if coupon.MinOrderValue, err = parseMoney(get(ColumnMinOrderValue)); err != nil {
+		fail(ColumnMinOrderValue, err)
+	}
+	if value := get(ColumnBuyQuantity); value != "" {
+		if coupon.BuyQuantity, err = strconv.Atoi(value); err != nil {
+			fail(ColumnBuyQuantity, fmt.Errorf("%q is not a whole number", value))
+		}
+	}
+	if value := get(ColumnGetQuantity); value != "" {
+		if coupon.GetQuantity, err = strconv.Atoi(value); err != nil {
+			fail(ColumnGetQuantity, fmt.Errorf("%q is not a whole number", value))
+		}
+	}
+	if value := get(ColumnMaxUsagePerUser); value != "" {
+		if coupon.MaxUsagePerUser, err = strconv.Atoi(value); err != nil {
+			fail(ColumnMaxUsagePerUser, fmt.Errorf("%q is not a whole number", value))
+		}
+	}
+	if value := get(ColumnMaxTotalUsage); value != "" {
+		if coupon.MaxTotalUsage, err = strconv.Atoi(value); err != nil {
+			fail(ColumnMaxTotalUsage, fmt.Errorf("%q is not a whole number", value))
+		}
+	}
+	if coupon.Budget, err = parseMoney(get(ColumnBudget)); err != nil {
+		fail(ColumnBudget, err)
+	}
+	if value := get(ColumnStartDate); value != "" {
+		start, err := parseTime(value, false)
+		if err != nil {
+			fail(ColumnStartDate, err)
+		}
+		coupon.StartDate = &start
+	}
+	if value := get(ColumnExpiryDate); value != "" {
+		if coupon.ExpiryDate, err = parseTime(value, true); err != nil {
+			fail(ColumnExpiryDate, err)
+		}
+	}
+
+	from, until := get(ColumnValidFrom), get(ColumnValidUntil)
+	switch {
+	case from != "" && until != "":
+		window := &domain.TimeWindow{}
+		if window.StartTime, err = parseTime(from, false); err != nil {
+			fail(ColumnValidFrom, err)
+		}
+		if window.EndTime, err = parseTime(until, true); err != nil {
+			fail(ColumnValidUntil, err)
+		}
+		coupon.ValidTimeWindow = window
+	case from != "" || until != "":
+		problems = append(problems, fmt.Sprintf("%s and %s must be set together", ColumnValidFrom, ColumnValidUntil))
+	}
+
+	days, hours, zone := get(ColumnScheduleDays), get(ColumnScheduleHours), get(ColumnScheduleZone)
+	if days != "" || hours != "" || zone != "" {
+		schedule := &domain.Schedule{TimeZone: zone}
+		for _, day := range splitList(days) {
+			schedule.Days = append(schedule.Days, domain.Weekday(strings.ToLower(day)))
+		}
+		for _, value := range splitList(hours) {
+			hourRange, err := domain.ParseHourRange(value)
+			if err != nil {
+				fail(ColumnScheduleHours, err)
+				continue
+			}
+			schedule.Hours = append(schedule.Hours, hourRange)
+		}
+		coupon.Schedule = schedule
+	}
+
+	for _, value := range splitList(get(ColumnBlackouts)) {
+		blackout, err := parseBlackout(value)
+		if err != nil {
+			fail(ColumnBlackouts, err)
+			continue
+		}
+		coupon.Blackouts = append(coupon.Blackouts, blackout)
+	}
+	if coupon.Draft, err = parseBool(get(ColumnDraft)); err != nil {
+		fail(ColumnDraft, err)
+	}
+	if coupon.Paused, err = parseBool(get(ColumnPaused)); err != nil {
+		fail(ColumnPaused, err)
+	}
+
+	if len(problems) > 0 {
+		return coupon, errors.New(strings.Join(problems, "; "))
+	}
+	return coupon, nil
+}
+
+func formatRecord(coupon *domain.Coupon) ([]string, error) {
+	var startDate, validFrom, validUntil string
+	if coupon.StartDate != nil {
+		startDate = formatTime(*coupon.StartDate)
+	}
+	if coupon.ValidTimeWindow != nil {
+		validFrom = formatTime(coupon.ValidTimeWindow.StartTime)
+		validUntil = formatTime(coupon.ValidTimeWindow.EndTime)
+	}
+
+	var tiers, days, hours []string
+	for _, tier := range coupon.Tiers {
+		tiers = append(tiers, tier.String())
+	}
+	var zone string
+	if coupon.Schedule != nil {
+		for _, day := range coupon.Schedule.Days {
+			days = append(days, string(day))
+		}
+		for _, h := range coupon.Schedule.Hours {
+			hours = append(hours, h.Start+"-"+h.End)
+		}
+		zone = coupon.Schedule.TimeZone
+	}
+
+	var blackouts []string
+	for _, blackout := range coupon.Blackouts {
+		if strings.Contains(blackout.Name, ListSeparator) {
+			return nil, fmt.Errorf("blackout name %q contains %q", blackout.Name, ListSeparator)
+		}
+		blackouts = append(blackouts, blackout.Name+"@"+formatTime(blackout.StartsAt)+"/"+formatTime(blackout.EndsAt))
+	}
+
+	record := make([]string, 0, len(Columns))
+	return append(record,
+		coupon.Code,
+		string(coupon.UsageType),
+		string(coupon.DiscountType),
+		coupon.DiscountValue.String(),
+		coupon.Currency,
+		strings.Join(tiers, ListSeparator),
+		strconv.Itoa(coupon.BuyQuantity),
+		strconv.Itoa(coupon.GetQuantity),
+		coupon.MinOrderValue.String(),
+		strconv.Itoa(coupon.MaxUsagePerUser),
+		strconv.Itoa(coupon.MaxTotalUsage),
+		coupon.Budget.String(),
+		startDate,
+		formatTime(coupon.ExpiryDate),
+		strings.Join(coupon.ApplicableMedicineIDs, ListSeparator),
+		strings.Join(coupon.ApplicableCategories, ListSeparator),
+		validFrom,
+		validUntil,
+		strings.Join(days, ListSeparator),
+		strings.Join(hours, ListSeparator),
+		zone,
+		strings.Join(blackouts, ListSeparator),
+		coupon.TermsAndConditions,
+		strconv.FormatBool(coupon.Draft),
+		strconv.FormatBool(coupon.Paused),
+	), nil
+}
+
+// parseBlackout reads NAME@STARTS_AT/ENDS_AT. The name may be empty and may
+// itself contain @.
+func parseBlackout(value string) (domain.BlackoutPeriod, error) {
+	at := strings.LastIndex(value, "@")
+	startsAt, endsAt, ok := strings.Cut(value[at+1:], "/")
+	if at < 0 || !ok {
+		return domain.BlackoutPeriod{}, fmt.Errorf("%q is not NAME@STARTS_AT/ENDS_AT", value)
+	}
+
+	blackout := domain.BlackoutPeriod{Name: strings.TrimSpace(value[:at])}
+	var err error
+	if blackout.StartsAt, err = parseTime(strings.TrimSpace(startsAt), false); err != nil {
+		return blackout, err
+	}
+	if blackout.EndsAt, err = parseTime(strings.TrimSpace(endsAt), false); err != nil {
+		return blackout, err
+	}
+	return blackout, nil
+}
+
+func parseBool(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%q is not true or false", value)
+	}
+	return b, nil
+}
+
+func parseMoney(value string) (domain.Money, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return domain.ParseMoney(value)
+}
+
+// parseTime accepts an RFC 3339 timestamp or a date. A date means the start of
+// that day in UTC, or its end if endOfDay is set.
+func parseTime(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		if endOfDay {
+			return t.Add(24*time.Hour - time.Second), nil
+		}
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not YYYY-MM-DD or RFC 3339", value)
+	}
+	return t, nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// escapeCell prefixes cells that spreadsheets would run as formulas with a
+// quote. Cells that already start with a quote get another, so that
+// unescapeCell restores them exactly.
+func escapeCell(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@'", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+func unescapeCell(cell string) string {
+	return strings.TrimPrefix(cell, "'")
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ListSeparator) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
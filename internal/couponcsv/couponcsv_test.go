@@ -0,0 +1,178 @@
+package couponcsv
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecode(t *testing.T) {
+	t.Run("should parse rows in any column order", func(t *testing.T) {
+		input := "\ufeffDiscount_Type,code,discount_value,usage_type,expiry_date,applicable_medicine_ids,applicable_categories,valid_from,valid_until\n" +
+			"percentage,SAVE10,10,multi_use,2099-12-31,med1; med2,pain-relief,2099-06-01,2099-06-30\n" +
+			"fixed,FLAT50,50,one_time,2099-01-01T00:00:00Z,,,,\n"
+
+		rows, err := Decode(strings.NewReader(input))
+		require.NoError(t, err)
+		require.Len(t, rows, 2)
+
+		first := rows[0]
+		assert.Equal(t, 2, first.Line)
+		assert.Empty(t, first.ParseError)
+		assert.Equal(t, "SAVE10", first.Coupon.Code)
+		assert.Equal(t, domain.Percentage, first.Coupon.DiscountType)
+		assert.Equal(t, []string{"med1", "med2"}, first.Coupon.ApplicableMedicineIDs)
+		assert.Equal(t, []string{"pain-relief"}, first.Coupon.ApplicableCategories)
+		assert.Equal(t, time.Date(2099, 12, 31, 23, 59, 59, 0, time.UTC), first.Coupon.ExpiryDate)
+		require.NotNil(t, first.Coupon.ValidTimeWindow)
+		assert.Equal(t, time.Date(2099, 6, 1, 0, 0, 0, 0, time.UTC), first.Coupon.ValidTimeWindow.StartTime)
+		assert.Equal(t, time.Date(2099, 6, 30, 23, 59, 59, 0, time.UTC), first.Coupon.ValidTimeWindow.EndTime)
+
+		assert.Empty(t, rows[1].ParseError)
+		assert.Nil(t, rows[1].Coupon.ValidTimeWindow)
+	})
+
+	t.Run("should report every problem on a row", func(t *testing.T) {
+		input := "code,usage_type,discount_type,discount_value,expiry_date,valid_from,blackouts,draft\n" +
+			"BAD,multi_use,fixed,ten,next week,2099-01-01,sale@2099-10-20,maybe\n" +
+			"SHORT,multi_use\n"
+
+		rows, err := Decode(strings.NewReader(input))
+		require.NoError(t, err)
+		require.Len(t, rows, 2)
+		assert.Contains(t, rows[0].ParseError, "discount_value")
+		assert.Contains(t, rows[0].ParseError, "expiry_date")
+		assert.Contains(t, rows[0].ParseError, "valid_from and valid_until must be set together")
+		assert.Contains(t, rows[0].ParseError, "blackouts")
+		assert.Contains(t, rows[0].ParseError, "draft")
+		assert.Equal(t, 3, rows[1].Line)
+		assert.Contains(t, rows[1].ParseError, "expected 8 fields")
+	})
+
+	t.Run("should reject bad headers", func(t *testing.T) {
+		for name, input := range map[string]string{
+			"empty":          "",
+			"unknown column": "code,usage_type,discount_type,discount_value,expiry_date,colour\n",
+			"missing column": "code,usage_type,discount_type,discount_value\n",
+			"duplicate":      "code,code,usage_type,discount_type,discount_value,expiry_date\n",
+		} {
+			_, err := Decode(strings.NewReader(input))
+			assert.Error(t, err, name)
+		}
+	})
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	coupons := []domain.Coupon{
+		{
+			Code:                  "SAVE10",
+			UsageType:             domain.MultiUse,
+			DiscountType:          domain.Percentage,
+			DiscountValue:         domain.MustParseMoney("12.5"),
+			Currency:              "INR",
+			MinOrderValue:         domain.MoneyFromInt(100),
+			MaxUsagePerUser:       2,
+			MaxTotalUsage:         1000,
+			Budget:                domain.MustParseMoney("50000.75"),
+			StartDate:             ptr(time.Date(2099, 6, 1, 0, 0, 0, 0, time.UTC)),
+			ExpiryDate:            time.Date(2099, 12, 31, 23, 59, 59, 0, time.UTC),
+			ApplicableMedicineIDs: []string{"med1", "med2"},
+			ApplicableCategories:  []string{"vitamins"},
+			ValidTimeWindow: &domain.TimeWindow{
+				StartTime: time.Date(2099, 6, 1, 9, 0, 0, 0, time.UTC),
+				EndTime:   time.Date(2099, 6, 1, 18, 0, 0, 0, time.UTC),
+			},
+			Schedule: &domain.Schedule{
+				Days:     []domain.Weekday{"mon", "fri"},
+				Hours:    []domain.HourRange{{Start: "09:00", End: "12:00"}, {Start: "18:00", End: "21:00"}},
+				TimeZone: "Asia/Kolkata",
+			},
+			Blackouts: domain.BlackoutPeriods{
+				{Name: "Diwali @ stores", StartsAt: time.Date(2099, 10, 20, 0, 0, 0, 0, time.UTC), EndsAt: time.Date(2099, 10, 25, 0, 0, 0, 0, time.UTC)},
+				{StartsAt: time.Date(2099, 12, 25, 0, 0, 0, 0, time.UTC), EndsAt: time.Date(2099, 12, 26, 0, 0, 0, 0, time.UTC)},
+			},
+			TermsAndConditions: "One per order, while stocks last",
+			Paused:             true,
+		},
+		{
+			Code:         "TIERED",
+			UsageType:    domain.MultiUse,
+			DiscountType: domain.Percentage,
+			Tiers: domain.DiscountTiers{
+				{MinOrderValue: domain.MoneyFromInt(500), DiscountValue: domain.MoneyFromInt(5)},
+				{MinOrderValue: domain.MoneyFromInt(1000), DiscountValue: domain.MoneyFromInt(10)},
+			},
+			ExpiryDate: time.Date(2099, 12, 31, 23, 59, 59, 0, time.UTC),
+			Draft:      true,
+		},
+		{
+			Code:                 "B2G1",
+			UsageType:            domain.MultiUse,
+			DiscountType:         domain.BuyXGetY,
+			BuyQuantity:          2,
+			GetQuantity:          1,
+			ApplicableCategories: []string{"vitamins"},
+			ExpiryDate:           time.Date(2099, 12, 31, 23, 59, 59, 0, time.UTC),
+		},
+		{
+			Code:                  "FORMULA",
+			UsageType:             domain.MultiUse,
+			DiscountType:          domain.Fixed,
+			DiscountValue:         domain.MoneyFromInt(50),
+			ApplicableMedicineIDs: []string{"+med1"},
+			ApplicableCategories:  []string{"-pain"},
+			ExpiryDate:            time.Date(2099, 12, 31, 23, 59, 59, 0, time.UTC),
+			Blackouts: domain.BlackoutPeriods{
+				{Name: "@sale", StartsAt: time.Date(2099, 10, 20, 0, 0, 0, 0, time.UTC), EndsAt: time.Date(2099, 10, 25, 0, 0, 0, 0, time.UTC)},
+			},
+			TermsAndConditions: `=HYPERLINK("http://example.com")`,
+		},
+		{
+			Code:               "QUOTED",
+			UsageType:          domain.MultiUse,
+			DiscountType:       domain.Fixed,
+			DiscountValue:      domain.MoneyFromInt(50),
+			ExpiryDate:         time.Date(2099, 12, 31, 23, 59, 59, 0, time.UTC),
+			TermsAndConditions: "'quoted'",
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, Encode(&buf, coupons))
+	assert.True(t, strings.HasPrefix(buf.String(), strings.Join(Columns, ",")+"\n"))
+	assert.Contains(t, buf.String(), `,'+med1,'-pain,`)
+	assert.Contains(t, buf.String(), `"'=HYPERLINK(""http://example.com"")"`)
+	assert.Contains(t, buf.String(), `,'@sale@2099-10-20T00:00:00Z/2099-10-25T00:00:00Z,`)
+
+	rows, err := Decode(&buf)
+	require.NoError(t, err)
+	require.Len(t, rows, len(coupons))
+	for i, row := range rows {
+		assert.Empty(t, row.ParseError)
+		assert.Equal(t, coupons[i], row.Coupon)
+	}
+}
+
+func TestEncodeRejectsUnrepresentableBlackouts(t *testing.T) {
+	coupons := []domain.Coupon{{
+		Code:       "SALE",
+		ExpiryDate: time.Date(2099, 12, 31, 23, 59, 59, 0, time.UTC),
+		Blackouts: domain.BlackoutPeriods{
+			{Name: "Diwali; Holi", StartsAt: time.Date(2099, 10, 20, 0, 0, 0, 0, time.UTC), EndsAt: time.Date(2099, 10, 25, 0, 0, 0, 0, time.UTC)},
+		},
+	}}
+
+	var buf bytes.Buffer
+	err := Encode(&buf, coupons)
+	assert.ErrorContains(t, err, "SALE")
+	assert.Empty(t, buf.String())
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
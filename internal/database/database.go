@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/farmako/coupon-system/internal/config"
+	"github.com/farmako/coupon-system/internal/domain"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// Connect opens the Postgres database described by cfg and applies its pool
+// settings. While the database is unreachable it retries with exponential
+// backoff, giving up after cfg.ConnectTimeout.
+func Connect(ctx context.Context, cfg config.DatabaseConfig, logger *slog.Logger) (*gorm.DB, error) {
+	return connect(ctx, cfg, logger, func() (*gorm.DB, error) {
+		return gorm.Open(postgres.Open(cfg.DSN()), &gorm.Config{})
+	})
+}
+
+func connect(ctx context.Context, cfg config.DatabaseConfig, logger *slog.Logger, open func() (*gorm.DB, error)) (*gorm.DB, error) {
+	ctx, cancel := context.WithTimeout(ctx, cfg.ConnectTimeout)
+	defer cancel()
+
+	backoff := cfg.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		db, err := open()
+		if err == nil {
+			if err := ConfigurePool(db, cfg); err != nil {
+				return nil, err
+			}
+			return db, nil
+		}
+
+		logger.Warn("Database not reachable, retrying", "attempt", attempt, "backoff", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("database not reachable after %d attempts: %w", attempt, err)
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, cfg.RetryMaxBackoff)
+	}
+}
+
+// ConfigurePool applies the connection pool limits from cfg.
+func ConfigurePool(db *gorm.DB, cfg config.DatabaseConfig) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	return nil
+}
+
+// Migrate brings the schema up to date.
+func Migrate(db *gorm.DB) error {
+	// Disabled coupons became paused ones, which can be resumed.
+	if db.Migrator().HasColumn(&domain.Coupon{}, "disabled") && !db.Migrator().HasColumn(&domain.Coupon{}, "paused") {
+		if err := db.Migrator().RenameColumn(&domain.Coupon{}, "disabled", "paused"); err != nil {
+			return err
+		}
+	}
+
+	if err := db.AutoMigrate(&domain.Coupon{}, &domain.APIKey{}, &domain.Redemption{}, &domain.Campaign{}, &domain.Blackout{}); err != nil {
+		return err
+	}
+
+	// Coupon codes used to be globally unique; they are now unique per tenant.
+	if db.Migrator().HasIndex(&domain.Coupon{}, "idx_coupons_code") {
+		if err := db.Migrator().DropIndex(&domain.Coupon{}, "idx_coupons_code"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
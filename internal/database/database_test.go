@@ -0,0 +1,93 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/farmako/coupon-system/internal/config"
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/farmako/coupon-system/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func testConfig() config.DatabaseConfig {
+	cfg := config.Default().Database
+	cfg.ConnectTimeout = time.Second
+	cfg.RetryBackoff = time.Millisecond
+	cfg.RetryMaxBackoff = 4 * time.Millisecond
+	cfg.MaxOpenConns = 7
+	cfg.MaxIdleConns = 3
+	return cfg
+}
+
+func TestConnect(t *testing.T) {
+	t.Run("should retry until the database is reachable", func(t *testing.T) {
+		attempts := 0
+		db, err := connect(context.Background(), testConfig(), logging.Discard(), func() (*gorm.DB, error) {
+			attempts++
+			if attempts < 3 {
+				return nil, errors.New("connection refused")
+			}
+			return gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 3, attempts)
+
+		sqlDB, err := db.DB()
+		require.NoError(t, err)
+		assert.Equal(t, 7, sqlDB.Stats().MaxOpenConnections)
+	})
+
+	t.Run("should give up after the connect timeout", func(t *testing.T) {
+		cfg := testConfig()
+		cfg.ConnectTimeout = 20 * time.Millisecond
+
+		attempts := 0
+		_, err := connect(context.Background(), cfg, logging.Discard(), func() (*gorm.DB, error) {
+			attempts++
+			return nil, errors.New("connection refused")
+		})
+		assert.ErrorContains(t, err, "connection refused")
+		assert.Greater(t, attempts, 1)
+	})
+}
+
+func TestMigrate(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	assert.NoError(t, Migrate(db))
+}
+
+func TestMigrateRenamesDisabledToPaused(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.Exec(`CREATE TABLE coupons (id text PRIMARY KEY, code text, disabled numeric NOT NULL DEFAULT false)`).Error)
+	require.NoError(t, db.Exec(`INSERT INTO coupons (id, code, disabled) VALUES ('6f1c2b4e-9a7d-4c3e-8b5a-2d1e0f9c8b7a', 'OLD', true)`).Error)
+
+	require.NoError(t, Migrate(db))
+	assert.False(t, db.Migrator().HasColumn(&domain.Coupon{}, "disabled"))
+
+	var coupon domain.Coupon
+	require.NoError(t, db.Where("code = ?", "OLD").First(&coupon).Error)
+	assert.True(t, coupon.Paused)
+}
+
+func TestMigrateKeepsAmountsFromFloatColumns(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.Exec(`CREATE TABLE coupons (id text PRIMARY KEY, code text, discount_value real, min_order_value real)`).Error)
+	require.NoError(t, db.Exec(`INSERT INTO coupons (id, code, discount_value, min_order_value) VALUES ('6f1c2b4e-9a7d-4c3e-8b5a-2d1e0f9c8b7a', 'OLD', 12.5, 499.99)`).Error)
+
+	require.NoError(t, Migrate(db))
+
+	var coupon domain.Coupon
+	require.NoError(t, db.Where("code = ?", "OLD").First(&coupon).Error)
+	assert.Equal(t, domain.MustParseMoney("12.5"), coupon.DiscountValue)
+	assert.Equal(t, domain.MustParseMoney("499.99"), coupon.MinOrderValue)
+	assert.Equal(t, domain.DefaultCurrency, coupon.Currency)
+}
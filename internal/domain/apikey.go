@@ -0,0 +1,83 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ScopeCouponsRead     = "coupons:read"
+	ScopeCouponsValidate = "coupons:validate"
+	ScopeCouponsRedeem   = "coupons:redeem"
+	ScopeCouponsList     = "coupons:list"
+	ScopeCouponsWrite    = "coupons:write"
+	ScopeCouponsApprove  = "coupons:approve"
+	ScopeAdmin           = "admin"
+)
+
+// KnownScopes lists every scope that can be granted to an API key.
+var KnownScopes = []string{
+	ScopeCouponsRead,
+	ScopeCouponsValidate,
+	ScopeCouponsRedeem,
+	ScopeCouponsList,
+	ScopeCouponsWrite,
+	ScopeCouponsApprove,
+	ScopeAdmin,
+}
+
+// @Description API key issued to a partner or administrator
+type APIKey struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:uuid;primary_key"`
+	Name      string     `json:"name"`
+	TenantID  string     `json:"tenant_id,omitempty" gorm:"type:varchar(64);index"`
+	Prefix    string     `json:"prefix" gorm:"type:varchar(16);index"`
+	KeyHash   string     `json:"-" gorm:"type:varchar(64);uniqueIndex"`
+	Scopes    StringList `json:"scopes" gorm:"type:text"`
+	Role      Role       `json:"role,omitempty" gorm:"type:varchar(20)"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// IsActive reports whether the key can still be used to authenticate at t.
+func (k *APIKey) IsActive(t time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || t.Before(*k.ExpiresAt)
+}
+
+// @Description Request to issue a new API key
+type APIKeyRequest struct {
+	Name      string     `json:"name" binding:"required"`
+	TenantID  string     `json:"tenant_id,omitempty"`
+	Scopes    []string   `json:"scopes"`
+	Role      Role       `json:"role,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// @Description Newly issued API key. The plaintext key is only returned once.
+type IssuedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+type APIKeyNotFoundError struct {
+	ID string
+}
+
+func (e *APIKeyNotFoundError) Error() string {
+	return fmt.Sprintf("api key not found: %s", e.ID)
+}
+
+type InvalidCredentialsError struct {
+	Reason string
+}
+
+func (e *InvalidCredentialsError) Error() string {
+	return fmt.Sprintf("invalid credentials: %s", e.Reason)
+}
@@ -0,0 +1,74 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// @Description Period during which a coupon cannot be used, from starts_at up to but excluding ends_at
+type BlackoutPeriod struct {
+	Name     string    `json:"name" example:"Diwali sale"`
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+}
+
+// Covers reports whether t falls within the period.
+func (p *BlackoutPeriod) Covers(t time.Time) bool {
+	return !t.Before(p.StartsAt) && t.Before(p.EndsAt)
+}
+
+func (p *BlackoutPeriod) Validate() error {
+	if p.StartsAt.IsZero() || p.EndsAt.IsZero() {
+		return errors.New("starts_at and ends_at are required")
+	}
+	if !p.EndsAt.After(p.StartsAt) {
+		return errors.New("ends_at must be after starts_at")
+	}
+	return nil
+}
+
+// BlackoutPeriods is a coupon's own list of blackout periods.
+type BlackoutPeriods []BlackoutPeriod
+
+func (p BlackoutPeriods) Value() (driver.Value, error) {
+	if p == nil {
+		return nil, nil
+	}
+	return json.Marshal(p)
+}
+
+func (p *BlackoutPeriods) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*p = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, p)
+	case string:
+		return json.Unmarshal([]byte(v), p)
+	default:
+		return fmt.Errorf("failed to unmarshal BlackoutPeriods value: %v", value)
+	}
+}
+
+// @Description Blackout period applying to every coupon of the tenant
+type Blackout struct {
+	ID             uuid.UUID `json:"id" gorm:"type:uuid;primary_key"`
+	TenantID       string    `json:"tenant_id" gorm:"type:varchar(64);not null;default:default;index"`
+	BlackoutPeriod `gorm:"embedded"`
+	CreatedBy      string    `json:"created_by"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type BlackoutNotFoundError struct {
+	ID uuid.UUID
+}
+
+func (e *BlackoutNotFoundError) Error() string {
+	return fmt.Sprintf("blackout not found: %s", e.ID)
+}
@@ -0,0 +1,100 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// @Description Campaign holding the rules shared by its generated coupons
+type Campaign struct {
+	ID                    uuid.UUID       `json:"id" gorm:"type:uuid;primary_key"`
+	TenantID              string          `json:"tenant_id" gorm:"type:varchar(64);not null;default:default;uniqueIndex:idx_campaigns_tenant_name"`
+	Name                  string          `json:"name" gorm:"uniqueIndex:idx_campaigns_tenant_name"`
+	StartDate             *time.Time      `json:"start_date,omitempty"`
+	ExpiryDate            time.Time       `json:"expiry_date"`
+	UsageType             UsageType       `json:"usage_type" gorm:"type:varchar(20)"`
+	ApplicableMedicineIDs []string        `json:"applicable_medicine_ids" gorm:"type:text[]"`
+	ApplicableCategories  []string        `json:"applicable_categories" gorm:"type:text[]"`
+	MinOrderValue         Money           `json:"min_order_value"`
+	Schedule              *Schedule       `json:"schedule,omitempty" gorm:"type:jsonb"`
+	Blackouts             BlackoutPeriods `json:"blackouts,omitempty" gorm:"type:jsonb"`
+	TermsAndConditions    string          `json:"terms_and_conditions"`
+	Currency              string          `json:"currency" gorm:"type:varchar(3);not null;default:INR"`
+	DiscountType          DiscountType    `json:"discount_type" gorm:"type:varchar(20)"`
+	DiscountValue         Money           `json:"discount_value"`
+	Tiers                 DiscountTiers   `json:"tiers,omitempty" gorm:"type:jsonb"`
+	BuyQuantity           int             `json:"buy_quantity,omitempty"`
+	GetQuantity           int             `json:"get_quantity,omitempty"`
+	MaxUsagePerUser       int             `json:"max_usage_per_user"`
+	ApprovalStatus        ApprovalStatus  `json:"approval_status" gorm:"type:varchar(20);default:approved"`
+	CreatedBy             string          `json:"created_by"`
+	ApprovalRequestedBy   string          `json:"approval_requested_by,omitempty"`
+	ApprovedBy            string          `json:"approved_by,omitempty"`
+	ApprovedAt            *time.Time      `json:"approved_at,omitempty"`
+	CodesGenerated        int             `json:"codes_generated"`
+	CreatedAt             time.Time       `json:"created_at"`
+	UpdatedAt             time.Time       `json:"updated_at"`
+}
+
+// IsApproved reports whether codes may be generated for the campaign.
+func (c *Campaign) IsApproved() bool {
+	return c.ApprovalStatus != PendingApproval
+}
+
+// NewCoupon returns a coupon with the given code and the campaign's rules.
+// Generated coupons inherit the campaign's approval.
+func (c *Campaign) NewCoupon(code string) Coupon {
+	campaignID := c.ID
+	return Coupon{
+		Code:                  code,
+		CampaignID:            &campaignID,
+		StartDate:             c.StartDate,
+		ExpiryDate:            c.ExpiryDate,
+		UsageType:             c.UsageType,
+		ApplicableMedicineIDs: c.ApplicableMedicineIDs,
+		ApplicableCategories:  c.ApplicableCategories,
+		MinOrderValue:         c.MinOrderValue,
+		Schedule:              c.Schedule,
+		Blackouts:             c.Blackouts,
+		TermsAndConditions:    c.TermsAndConditions,
+		Currency:              c.Currency,
+		DiscountType:          c.DiscountType,
+		DiscountValue:         c.DiscountValue,
+		Tiers:                 c.Tiers,
+		BuyQuantity:           c.BuyQuantity,
+		GetQuantity:           c.GetQuantity,
+		MaxUsagePerUser:       c.MaxUsagePerUser,
+		ApprovalStatus:        c.ApprovalStatus,
+		CreatedBy:             c.CreatedBy,
+		ApprovalRequestedBy:   c.ApprovalRequestedBy,
+		ApprovedBy:            c.ApprovedBy,
+		ApprovedAt:            c.ApprovedAt,
+	}
+}
+
+// @Description Request to generate codes for a campaign
+type CodeGenerationRequest struct {
+	Count int `json:"count" binding:"required"`
+	// Prefix is prepended to every code, e.g. "SUMMER-".
+	Prefix string `json:"prefix"`
+	// Length is the number of random characters after the prefix.
+	Length int `json:"length"`
+	// Alphabet overrides the characters codes are drawn from.
+	Alphabet string `json:"alphabet"`
+}
+
+// @Description Result of generating codes for a campaign
+type CodeGenerationResponse struct {
+	Campaign  *Campaign `json:"campaign"`
+	Generated int       `json:"generated"`
+}
+
+type CampaignNotFoundError struct {
+	ID uuid.UUID
+}
+
+func (e *CampaignNotFoundError) Error() string {
+	return fmt.Sprintf("campaign not found: %s", e.ID)
+}
@@ -0,0 +1,37 @@
+package domain
+
+// @Description Line item in the cart
+type CartItem struct {
+	ID       string `json:"id"`
+	Category string `json:"category"`
+	Price    Money  `json:"price" binding:"gte=0"`
+	// Quantity is the number of units, each costing Price. It defaults to 1.
+	Quantity int `json:"quantity,omitempty" binding:"gte=0"`
+}
+
+// Units returns the item's quantity, which is 1 when it is not set.
+func (i CartItem) Units() int {
+	if i.Quantity <= 0 {
+		return 1
+	}
+	return i.Quantity
+}
+
+// Total returns the price of all the item's units.
+func (i CartItem) Total() Money {
+	return i.Price * Money(i.Units())
+}
+
+// @Description Part of a coupon's discount given on one cart item
+type ItemDiscount struct {
+	ID       string `json:"id"`
+	Quantity int    `json:"quantity"`
+	// FreeQuantity is how many of the item's units a buy_x_get_y coupon
+	// made free.
+	FreeQuantity int `json:"free_quantity,omitempty"`
+	// Total is the price of all the item's units before the discount, and
+	// DiscountedTotal after it.
+	Total           Money `json:"total"`
+	Discount        Money `json:"discount"`
+	DiscountedTotal Money `json:"discounted_total"`
+}
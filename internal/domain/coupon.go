@@ -4,6 +4,7 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
@@ -22,24 +23,197 @@ type DiscountType string
 const (
 	Percentage DiscountType = "percentage"
 	Fixed      DiscountType = "fixed"
+	// PerUnit takes DiscountValue off every eligible unit in the cart.
+	PerUnit DiscountType = "per_unit"
+	// BuyXGetY makes GetQuantity units free for every BuyQuantity eligible
+	// units bought, the cheapest units going free.
+	BuyXGetY DiscountType = "buy_x_get_y"
+)
+
+type ApprovalStatus string
+
+const (
+	Approved        ApprovalStatus = "approved"
+	PendingApproval ApprovalStatus = "pending_approval"
 )
 
 // @Description Coupon information
 type Coupon struct {
-	ID                    uuid.UUID    `json:"id" gorm:"type:uuid;primary_key"`
-	Code                  string       `json:"code" gorm:"uniqueIndex"`
-	ExpiryDate            time.Time    `json:"expiry_date"`
-	UsageType             UsageType    `json:"usage_type" gorm:"type:varchar(20)"`
-	ApplicableMedicineIDs []string     `json:"applicable_medicine_ids" gorm:"type:text[]"`
-	ApplicableCategories  []string     `json:"applicable_categories" gorm:"type:text[]"`
-	MinOrderValue         float64      `json:"min_order_value"`
-	ValidTimeWindow       *TimeWindow  `json:"valid_time_window,omitempty" gorm:"type:jsonb"`
-	TermsAndConditions    string       `json:"terms_and_conditions"`
-	DiscountType          DiscountType `json:"discount_type" gorm:"type:varchar(20)"`
-	DiscountValue         float64      `json:"discount_value"`
-	MaxUsagePerUser       int          `json:"max_usage_per_user"`
-	CreatedAt             time.Time    `json:"created_at"`
-	UpdatedAt             time.Time    `json:"updated_at"`
+	ID                    uuid.UUID       `json:"id" gorm:"type:uuid;primary_key"`
+	TenantID              string          `json:"tenant_id" gorm:"type:varchar(64);not null;default:default;uniqueIndex:idx_coupons_tenant_code"`
+	Code                  string          `json:"code" gorm:"uniqueIndex:idx_coupons_tenant_code"`
+	CampaignID            *uuid.UUID      `json:"campaign_id,omitempty" gorm:"type:uuid;index"`
+	StartDate             *time.Time      `json:"start_date,omitempty"`
+	ExpiryDate            time.Time       `json:"expiry_date"`
+	UsageType             UsageType       `json:"usage_type" gorm:"type:varchar(20)"`
+	ApplicableMedicineIDs []string        `json:"applicable_medicine_ids" gorm:"type:text[]"`
+	ApplicableCategories  []string        `json:"applicable_categories" gorm:"type:text[]"`
+	MinOrderValue         Money           `json:"min_order_value"`
+	ValidTimeWindow       *TimeWindow     `json:"valid_time_window,omitempty" gorm:"type:jsonb"`
+	Schedule              *Schedule       `json:"schedule,omitempty" gorm:"type:jsonb"`
+	Blackouts             BlackoutPeriods `json:"blackouts,omitempty" gorm:"type:jsonb"`
+	TermsAndConditions    string          `json:"terms_and_conditions"`
+	Currency              string          `json:"currency" gorm:"type:varchar(3);not null;default:INR"`
+	DiscountType          DiscountType    `json:"discount_type" gorm:"type:varchar(20)"`
+	DiscountValue         Money           `json:"discount_value"`
+	Tiers                 DiscountTiers   `json:"tiers,omitempty" gorm:"type:jsonb"`
+	BuyQuantity           int             `json:"buy_quantity,omitempty"`
+	GetQuantity           int             `json:"get_quantity,omitempty"`
+	MaxUsagePerUser       int             `json:"max_usage_per_user"`
+	MaxTotalUsage         int             `json:"max_total_usage"`
+	Budget                Money           `json:"budget"`
+	RedemptionCount       int             `json:"redemption_count" gorm:"not null;default:0"`
+	DiscountSpent         Money           `json:"discount_spent" gorm:"not null;default:0"`
+	ApprovalStatus        ApprovalStatus  `json:"approval_status" gorm:"type:varchar(20);default:approved"`
+	CreatedBy             string          `json:"created_by"`
+	ApprovalRequestedBy   string          `json:"approval_requested_by,omitempty"`
+	ApprovedBy            string          `json:"approved_by,omitempty"`
+	ApprovedAt            *time.Time      `json:"approved_at,omitempty"`
+	Draft                 bool            `json:"draft" gorm:"not null;default:false"`
+	Paused                bool            `json:"paused" gorm:"not null;default:false"`
+	CreatedAt             time.Time       `json:"created_at"`
+	UpdatedAt             time.Time       `json:"updated_at"`
+}
+
+// CouponStatus is where a coupon is in its lifecycle.
+type CouponStatus string
+
+const (
+	StatusDraft           CouponStatus = "draft"
+	StatusPendingApproval CouponStatus = "pending_approval"
+	StatusPaused          CouponStatus = "paused"
+	StatusExhausted       CouponStatus = "exhausted"
+	StatusExpired         CouponStatus = "expired"
+	StatusScheduled       CouponStatus = "scheduled"
+	StatusActive          CouponStatus = "active"
+)
+
+// CouponStatuses lists every status, in the order Status checks them.
+var CouponStatuses = []CouponStatus{
+	StatusDraft,
+	StatusPendingApproval,
+	StatusPaused,
+	StatusExhausted,
+	StatusExpired,
+	StatusScheduled,
+	StatusActive,
+}
+
+// Status reports the coupon's lifecycle status at now. Drafts and coupons
+// pending approval keep that status until they are published or approved,
+// whatever their dates.
+func (c *Coupon) Status(now time.Time) CouponStatus {
+	switch {
+	case c.Draft:
+		return StatusDraft
+	case !c.IsApproved():
+		return StatusPendingApproval
+	case c.Paused:
+		return StatusPaused
+	case c.Exhausted():
+		return StatusExhausted
+	case now.After(c.ExpiryDate):
+		return StatusExpired
+	case c.StartDate != nil && now.Before(*c.StartDate):
+		return StatusScheduled
+	default:
+		return StatusActive
+	}
+}
+
+// IsActive reports whether the coupon can be offered and redeemed at now.
+func (c *Coupon) IsActive(now time.Time) bool {
+	return c.Status(now) == StatusActive && c.InSchedule(now)
+}
+
+// InSchedule reports whether now falls within the coupon's recurring
+// schedule. Coupons without a schedule are always in schedule.
+func (c *Coupon) InSchedule(now time.Time) bool {
+	return c.Schedule == nil || c.Schedule.Contains(now)
+}
+
+// NextValidAt returns the earliest time at or after now when the coupon's
+// start date and schedule allow it to be used, or false if that would be
+// after it expires. It ignores whether the coupon is a draft, pending
+// approval or paused.
+func (c *Coupon) NextValidAt(now time.Time) (time.Time, bool) {
+	next := now
+	if c.StartDate != nil && c.StartDate.After(next) {
+		next = *c.StartDate
+	}
+	if c.Schedule != nil {
+		var ok bool
+		if next, ok = c.Schedule.Next(next); !ok {
+			return time.Time{}, false
+		}
+	}
+	if next.After(c.ExpiryDate) {
+		return time.Time{}, false
+	}
+	return next, true
+}
+
+// Exhausted reports whether the coupon has used up its total redemption
+// count or its budget.
+func (c *Coupon) Exhausted() bool {
+	return (c.MaxTotalUsage > 0 && c.RedemptionCount >= c.MaxTotalUsage) ||
+		(c.Budget > 0 && c.DiscountSpent >= c.Budget)
+}
+
+// RemainingUsage returns how many more times the coupon can be redeemed, or
+// nil if that is unlimited.
+func (c *Coupon) RemainingUsage() *int {
+	if c.MaxTotalUsage <= 0 {
+		return nil
+	}
+	remaining := max(c.MaxTotalUsage-c.RedemptionCount, 0)
+	return &remaining
+}
+
+// RemainingBudget returns how much discount the coupon can still give, or nil
+// if that is unlimited.
+func (c *Coupon) RemainingBudget() *Money {
+	if c.Budget <= 0 {
+		return nil
+	}
+	remaining := max(c.Budget-c.DiscountSpent, 0)
+	return &remaining
+}
+
+// MarshalJSON adds the coupon's current status and remaining caps to its
+// fields.
+func (c Coupon) MarshalJSON() ([]byte, error) {
+	type coupon Coupon
+	return json.Marshal(struct {
+		coupon
+		Status          CouponStatus `json:"status"`
+		RemainingUsage  *int         `json:"remaining_usage,omitempty"`
+		RemainingBudget *Money       `json:"remaining_budget,omitempty"`
+	}{coupon(c), c.Status(time.Now()), c.RemainingUsage(), c.RemainingBudget()})
+}
+
+// MaxDiscountValue returns the largest discount value the coupon can give,
+// which is that of its top tier if it has tiers.
+func (c *Coupon) MaxDiscountValue() Money {
+	if len(c.Tiers) > 0 {
+		return c.Tiers[len(c.Tiers)-1].DiscountValue
+	}
+	return c.DiscountValue
+}
+
+// AppliesTo reports whether the coupon's per_unit or buy_x_get_y discount
+// covers the item: its ID or category must be listed, if the coupon lists any.
+func (c *Coupon) AppliesTo(item CartItem) bool {
+	if len(c.ApplicableMedicineIDs) == 0 && len(c.ApplicableCategories) == 0 {
+		return true
+	}
+	return slices.Contains(c.ApplicableMedicineIDs, item.ID) || slices.Contains(c.ApplicableCategories, item.Category)
+}
+
+// IsApproved reports whether the coupon may be offered to customers. Coupons
+// created before approvals existed have an empty status and count as approved.
+func (c *Coupon) IsApproved() bool {
+	return c.ApprovalStatus != PendingApproval
 }
 
 // @Description Time window for coupon validity
@@ -50,10 +224,13 @@ type TimeWindow struct {
 
 // @Description Request to get applicable coupons
 type CouponRequest struct {
-	MedicineIDs []string `json:"medicine_ids"`
-	Categories  []string `json:"categories"`
-	OrderValue  float64  `json:"order_value"`
-	UserID      string   `json:"user_id"`
+	MedicineIDs []string   `json:"medicine_ids"`
+	Categories  []string   `json:"categories"`
+	OrderValue  Money      `json:"order_value"`
+	UserID      string     `json:"user_id"`
+	Items       []CartItem `json:"items,omitempty" binding:"dive"`
+	// Currency, if given, limits the results to coupons in that currency.
+	Currency string `json:"currency,omitempty"`
 }
 
 // @Description Request to validate a coupon
@@ -61,16 +238,57 @@ type CouponValidationRequest struct {
 	Code        string   `json:"code"`
 	MedicineIDs []string `json:"medicine_ids"`
 	Categories  []string `json:"categories"`
-	OrderValue  float64  `json:"order_value"`
+	OrderValue  Money    `json:"order_value"`
 	UserID      string   `json:"user_id"`
+	// Currency is the currency of the order. If given, it must be the
+	// coupon's.
+	Currency string `json:"currency,omitempty"`
+	// Items are needed by per_unit and buy_x_get_y coupons. Their IDs and
+	// categories count as medicine_ids and categories, and their total as
+	// the order value when order_value is left out.
+	Items []CartItem `json:"items,omitempty" binding:"dive"`
 }
 
+// Machine-readable reasons a coupon was rejected.
+const (
+	ReasonNotActive            = "not_active"
+	ReasonNotStarted           = "not_started"
+	ReasonPaused               = "paused"
+	ReasonOutsideSchedule      = "outside_schedule"
+	ReasonBlackout             = "blackout"
+	ReasonExpired              = "expired"
+	ReasonBelowMinimum         = "below_minimum"
+	ReasonNoApplicableMedicine = "no_applicable_medicine"
+	ReasonNoApplicableCategory = "no_applicable_category"
+	ReasonUsageLimitReached    = "usage_limit_reached"
+	ReasonExhausted            = "exhausted"
+	ReasonNoEligibleItems      = "no_eligible_items"
+	ReasonNotEnoughItems       = "not_enough_items"
+	ReasonCurrencyMismatch     = "currency_mismatch"
+)
+
 // @Description Response for coupon validation
 type CouponValidationResponse struct {
-	IsValid     bool    `json:"is_valid"`
-	Message     string  `json:"message"`
-	Discount    float64 `json:"discount"`
-	FinalAmount float64 `json:"final_amount"`
+	IsValid     bool   `json:"is_valid"`
+	Message     string `json:"message"`
+	Reason      string `json:"reason,omitempty"`
+	Currency    string `json:"currency,omitempty"`
+	Discount    Money  `json:"discount"`
+	FinalAmount Money  `json:"final_amount"`
+	// NextValidAt is when a coupon that is not yet started, outside its
+	// schedule or blacked out can next be used.
+	NextValidAt *time.Time `json:"next_valid_at,omitempty"`
+	// AppliedTier is the tier of a tiered coupon that set the discount, and
+	// NextTier the one above it, which the order reaches by spending
+	// AmountToNextTier more.
+	AppliedTier      *DiscountTier `json:"applied_tier,omitempty"`
+	NextTier         *DiscountTier `json:"next_tier,omitempty"`
+	AmountToNextTier Money         `json:"amount_to_next_tier,omitempty"`
+	// ItemDiscounts attribute the discount to the request's items, in the
+	// same order. They add up to Discount exactly, unless Discount exceeds
+	// the items' total, e.g. because OrderValue includes delivery charges;
+	// then each item is discounted in full and the rest is not attributed.
+	ItemDiscounts []ItemDiscount `json:"item_discounts,omitempty"`
 }
 
 type CouponNotFoundError struct {
@@ -93,26 +311,20 @@ func (tw *TimeWindow) Scan(value interface{}) error {
 	return json.Unmarshal(bytes, tw)
 }
 
-type CartItem struct {
-	ID       string  `json:"id"`
-	Category string  `json:"category"`
-	Price    float64 `json:"price"`
-}
-
 type Discount struct {
-	ItemsDiscount   float64 `json:"items_discount"`
-	ChargesDiscount float64 `json:"charges_discount"`
+	ItemsDiscount   Money `json:"items_discount"`
+	ChargesDiscount Money `json:"charges_discount"`
 }
 
 type ApplicableCouponsRequest struct {
 	CartItems  []CartItem `json:"cart_items"`
-	OrderTotal float64    `json:"order_total"`
+	OrderTotal Money      `json:"order_total"`
 	Timestamp  time.Time  `json:"timestamp"`
 }
 
 type ApplicableCoupon struct {
-	CouponCode    string  `json:"coupon_code"`
-	DiscountValue float64 `json:"discount_value"`
+	CouponCode    string `json:"coupon_code"`
+	DiscountValue Money  `json:"discount_value"`
 }
 
 type ApplicableCouponsResponse struct {
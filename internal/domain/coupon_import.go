@@ -0,0 +1,26 @@
+package domain
+
+// CouponImportRow is one parsed row of a coupon import. ParseError is set when
+// the row could not be turned into a coupon.
+type CouponImportRow struct {
+	Line       int
+	Coupon     Coupon
+	ParseError string
+}
+
+// @Description Outcome of a coupon import
+type CouponImportResult struct {
+	DryRun          bool                `json:"dry_run"`
+	Rows            int                 `json:"rows"`
+	Valid           int                 `json:"valid"`
+	Imported        int                 `json:"imported"`
+	PendingApproval int                 `json:"pending_approval"`
+	Errors          []CouponImportError `json:"errors,omitempty"`
+}
+
+// @Description Problem with one row of a coupon import
+type CouponImportError struct {
+	Line  int    `json:"line"`
+	Code  string `json:"code,omitempty"`
+	Error string `json:"error"`
+}
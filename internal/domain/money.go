@@ -0,0 +1,212 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the currency of coupons created without one.
+const DefaultCurrency = "INR"
+
+// moneyScale is the number of minor units in a unit of currency.
+const moneyScale = 100
+
+// currencies are the ISO 4217 codes whose minor unit is a hundredth, the
+// only scale Money represents. Currencies such as JPY (no minor unit) or
+// KWD (thousandths) are not supported.
+var currencies = map[string]bool{
+	"AED": true, "AUD": true, "BDT": true, "BRL": true, "CAD": true,
+	"CHF": true, "CNY": true, "DKK": true, "EUR": true, "GBP": true,
+	"HKD": true, "IDR": true, "INR": true, "LKR": true, "MXN": true,
+	"MYR": true, "NOK": true, "NPR": true, "NZD": true, "PHP": true,
+	"PKR": true, "QAR": true, "SAR": true, "SEK": true, "SGD": true,
+	"THB": true, "USD": true, "ZAR": true,
+}
+
+// ValidCurrency reports whether code is a supported ISO 4217 currency code,
+// one with two decimal places.
+func ValidCurrency(code string) bool {
+	return currencies[code]
+}
+
+// Money is an exact amount in minor units, such as paise for INR. It is
+// written to JSON as a decimal number, e.g. 119.99, and stored as
+// numeric(19,2). Amounts with more than two decimal places are rejected
+// rather than rounded.
+type Money int64
+
+// MoneyFromInt returns a whole number of currency units.
+func MoneyFromInt(units int64) Money {
+	return Money(units * moneyScale)
+}
+
+// ParseMoney parses a decimal amount such as "119.99" or "1e3".
+func ParseMoney(value string) (Money, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(value))
+	if !ok {
+		return 0, fmt.Errorf("%q is not a number", value)
+	}
+	r.Mul(r, big.NewRat(moneyScale, 1))
+	if !r.IsInt() {
+		return 0, fmt.Errorf("%q has more than two decimal places", value)
+	}
+	if !r.Num().IsInt64() {
+		return 0, fmt.Errorf("%q is out of range", value)
+	}
+	return Money(r.Num().Int64()), nil
+}
+
+// MustParseMoney is like ParseMoney but panics if value is invalid.
+func MustParseMoney(value string) Money {
+	m, err := ParseMoney(value)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// String returns the amount as a decimal without trailing zeros, e.g. "119.9"
+// or "100".
+func (m Money) String() string {
+	s := m.StringFixed()
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// StringFixed returns the amount with both decimal places, e.g. "100.00".
+func (m Money) StringFixed() string {
+	sign := ""
+	minor := int64(m)
+	if minor < 0 {
+		sign = "-"
+	}
+	units := minor / moneyScale
+	fraction := minor % moneyScale
+	if units < 0 {
+		units = -units
+	}
+	if fraction < 0 {
+		fraction = -fraction
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, units, fraction)
+}
+
+// Float64 returns the amount in currency units, for metrics and other uses
+// that do not need it exact.
+func (m Money) Float64() float64 {
+	return float64(m) / moneyScale
+}
+
+// RoundingMode chooses how amounts that fall between two minor units are
+// rounded.
+type RoundingMode int
+
+const (
+	// RoundHalfUp rounds halves away from zero.
+	RoundHalfUp RoundingMode = iota
+	// RoundHalfEven rounds halves to the nearest even minor unit.
+	RoundHalfEven
+	// RoundDown rounds towards zero.
+	RoundDown
+	// RoundUp rounds away from zero.
+	RoundUp
+)
+
+// MulRatio returns m * num / den, rounded to a minor unit with mode.
+func (m Money) MulRatio(num, den int64, mode RoundingMode) Money {
+	n := new(big.Int).Mul(big.NewInt(int64(m)), big.NewInt(num))
+	d := big.NewInt(den)
+	q, r := new(big.Int).QuoRem(n, d, new(big.Int))
+	if r.Sign() != 0 {
+		away := false
+		switch mode {
+		case RoundUp:
+			away = true
+		case RoundHalfUp, RoundHalfEven:
+			switch twice := new(big.Int).Mul(new(big.Int).Abs(r), big.NewInt(2)).CmpAbs(d); {
+			case twice > 0:
+				away = true
+			case twice == 0:
+				away = mode == RoundHalfUp || q.Bit(0) == 1
+			}
+		}
+		if away {
+			q.Add(q, big.NewInt(int64(n.Sign()*d.Sign())))
+		}
+	}
+	return Money(q.Int64())
+}
+
+// Percent returns rate percent of m, where rate is itself a two-decimal
+// amount, so that 12.5% is MustParseMoney("12.5").
+func (m Money) Percent(rate Money, mode RoundingMode) Money {
+	return m.MulRatio(int64(rate), 100*moneyScale, mode)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a string holding one.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	value := string(data)
+	if value == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		value = unquoted
+	}
+	parsed, err := ParseMoney(value)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// UnmarshalText parses a decimal amount, e.g. from a configuration file.
+func (m *Money) UnmarshalText(text []byte) error {
+	return m.Set(string(text))
+}
+
+// Set parses a command-line flag value.
+func (m *Money) Set(value string) error {
+	parsed, err := ParseMoney(value)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+func (Money) GormDataType() string {
+	return "numeric(19,2)"
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return m.StringFixed(), nil
+}
+
+func (m *Money) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*m = 0
+		return nil
+	case int64:
+		*m = MoneyFromInt(v)
+		return nil
+	case float64:
+		*m = Money(math.Round(v * moneyScale))
+		return nil
+	case []byte:
+		return m.Set(string(v))
+	case string:
+		return m.Set(v)
+	default:
+		return fmt.Errorf("failed to scan Money value: %v", value)
+	}
+}
@@ -0,0 +1,90 @@
+package domain
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMoney(t *testing.T) {
+	for value, want := range map[string]Money{
+		"119.99": 11999,
+		"120":    12000,
+		"0.1":    10,
+		"-5.5":   -550,
+		"1e3":    100000,
+		" 7.00 ": 700,
+	} {
+		got, err := ParseMoney(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, want, got, value)
+	}
+
+	for _, value := range []string{"", "ten", "10.005", "1e30"} {
+		_, err := ParseMoney(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestMoneyFormatting(t *testing.T) {
+	assert.Equal(t, "119.9", Money(11990).String())
+	assert.Equal(t, "100", Money(10000).String())
+	assert.Equal(t, "-0.05", Money(-5).String())
+	assert.Equal(t, "100.00", Money(10000).StringFixed())
+	assert.Equal(t, "-1.50", Money(-150).StringFixed())
+}
+
+func TestMoneyJSON(t *testing.T) {
+	var request CouponValidationRequest
+	require.NoError(t, json.Unmarshal([]byte(`{"order_value": 119.99, "items": [{"price": "40.10"}]}`), &request))
+	assert.Equal(t, Money(11999), request.OrderValue)
+	assert.Equal(t, Money(4010), request.Items[0].Price)
+
+	data, err := json.Marshal(CouponValidationResponse{Discount: 12, FinalAmount: 11987})
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"discount":0.12,"final_amount":119.87`)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"order_value": 119.999}`), &request))
+}
+
+func TestMoneyRounding(t *testing.T) {
+	for _, tc := range []struct {
+		amount Money
+		mode   RoundingMode
+		want   Money
+	}{
+		{250, RoundHalfUp, 3},
+		{250, RoundHalfEven, 2},
+		{350, RoundHalfEven, 4},
+		{-250, RoundHalfUp, -3},
+		{251, RoundDown, 2},
+		{201, RoundUp, 3},
+		{-201, RoundUp, -3},
+	} {
+		assert.Equal(t, tc.want, tc.amount.MulRatio(1, 100, tc.mode), "%d with mode %d", tc.amount, tc.mode)
+	}
+
+	// 5% of 800.10 is 40.005.
+	assert.Equal(t, Money(4001), Money(80010).Percent(MoneyFromInt(5), RoundHalfUp))
+	assert.Equal(t, Money(4000), Money(80010).Percent(MoneyFromInt(5), RoundHalfEven))
+	assert.Equal(t, Money(1250), MoneyFromInt(100).Percent(MustParseMoney("12.5"), RoundHalfUp))
+}
+
+func TestMoneyScan(t *testing.T) {
+	for _, tc := range []struct {
+		value any
+		want  Money
+	}{
+		{int64(12), 1200},
+		{119.99, 11999},
+		{"119.99", 11999},
+		{[]byte("0.10"), 10},
+		{nil, 0},
+	} {
+		m := Money(1)
+		require.NoError(t, m.Scan(tc.value))
+		assert.Equal(t, tc.want, m, "%v", tc.value)
+	}
+}
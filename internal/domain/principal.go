@@ -0,0 +1,56 @@
+package domain
+
+import "context"
+
+type PrincipalType string
+
+const (
+	PrincipalAPIKey PrincipalType = "api_key"
+	PrincipalUser   PrincipalType = "user"
+	// PrincipalCLI is an operator running admin commands from a shell.
+	PrincipalCLI PrincipalType = "cli"
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	ID     string        `json:"id"`
+	Name   string        `json:"name"`
+	Type   PrincipalType `json:"type"`
+	Scopes []string      `json:"scopes"`
+	Role   Role          `json:"role,omitempty"`
+	// TenantID binds the principal to a single tenant. Principals without a
+	// tenant may act for any tenant named in the X-Tenant-ID header.
+	TenantID string `json:"tenant_id,omitempty"`
+	// UserID is set for end users authenticated with a bearer token and is
+	// empty for API keys.
+	UserID string `json:"user_id,omitempty"`
+}
+
+// HasScope reports whether the principal was granted scope, either directly
+// or through its role. The admin scope implies every other scope.
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	for _, s := range p.Role.Scopes() {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+type principalContextKey struct{}
+
+func ContextWithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, p)
+}
+
+// PrincipalFromContext returns the principal attached by the auth middleware,
+// or nil for unauthenticated requests.
+func PrincipalFromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalContextKey{}).(*Principal)
+	return p
+}
@@ -0,0 +1,61 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// @Description Record of a coupon applied to an order
+type Redemption struct {
+	ID         uuid.UUID `json:"id" gorm:"type:uuid;primary_key"`
+	TenantID   string    `json:"tenant_id" gorm:"type:varchar(64);not null;default:default;uniqueIndex:idx_redemptions_tenant_order;index:idx_redemptions_tenant_coupon_user"`
+	CouponCode string    `json:"coupon_code" gorm:"index:idx_redemptions_tenant_coupon_user"`
+	UserID     string    `json:"user_id" gorm:"index:idx_redemptions_tenant_coupon_user"`
+	OrderID    string    `json:"order_id" gorm:"uniqueIndex:idx_redemptions_tenant_order"`
+	Currency   string    `json:"currency" gorm:"type:varchar(3);not null;default:INR"`
+	OrderValue Money     `json:"order_value"`
+	Discount   Money     `json:"discount"`
+	// RefundedAmount is how much of the order value has been refunded, and
+	// ReversedDiscount the share of the discount given back with it.
+	RefundedAmount   Money `json:"refunded_amount,omitempty" gorm:"not null;default:0"`
+	ReversedDiscount Money `json:"reversed_discount,omitempty" gorm:"not null;default:0"`
+	// ReversedAt is set once the whole order has been cancelled or refunded.
+	ReversedAt *time.Time `json:"reversed_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Reversed reports whether the redemption has been fully reversed, giving the
+// user their use of the coupon back.
+func (r *Redemption) Reversed() bool {
+	return r.ReversedAt != nil
+}
+
+// @Description Request to redeem a coupon against an order
+type CouponRedemptionRequest struct {
+	CouponValidationRequest
+	OrderID string `json:"order_id" binding:"required"`
+}
+
+// @Description Response for coupon redemption
+type CouponRedemptionResponse struct {
+	CouponValidationResponse
+	Redemption *Redemption `json:"redemption,omitempty"`
+}
+
+// @Description Request to reverse a redemption after an order is cancelled or refunded
+type RedemptionReversalRequest struct {
+	// RefundedAmount is the total refunded so far, not the amount of this
+	// refund, so that retries are harmless. It defaults to the whole order
+	// value, which reverses the redemption.
+	RefundedAmount *Money `json:"refunded_amount,omitempty"`
+}
+
+type RedemptionNotFoundError struct {
+	OrderID string
+}
+
+func (e *RedemptionNotFoundError) Error() string {
+	return fmt.Sprintf("no redemption found for order %s", e.OrderID)
+}
@@ -0,0 +1,27 @@
+package domain
+
+type Role string
+
+const (
+	RoleViewer   Role = "viewer"
+	RoleMarketer Role = "marketer"
+	RoleAdmin    Role = "admin"
+)
+
+// Scopes returns the scopes granted by the role. Unknown roles grant nothing.
+func (r Role) Scopes() []string {
+	switch r {
+	case RoleViewer:
+		return []string{ScopeCouponsList}
+	case RoleMarketer:
+		return []string{ScopeCouponsList, ScopeCouponsWrite}
+	case RoleAdmin:
+		return []string{ScopeAdmin}
+	default:
+		return nil
+	}
+}
+
+func (r Role) IsValid() bool {
+	return r == RoleViewer || r == RoleMarketer || r == RoleAdmin
+}
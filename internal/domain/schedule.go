@@ -0,0 +1,248 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Weekday is a lowercase three-letter day name, e.g. "mon".
+type Weekday string
+
+var weekdays = map[Weekday]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// @Description Daily time range, e.g. 18:00 to 21:00. Ranges whose end is not after their start run past midnight.
+type HourRange struct {
+	Start string `json:"start" example:"18:00"`
+	End   string `json:"end" example:"21:00"`
+}
+
+// @Description Recurring schedule restricting when a coupon can be used
+type Schedule struct {
+	// Days the schedule applies to. Empty means every day.
+	Days []Weekday `json:"days,omitempty"`
+	// Hours within those days. Empty means all day.
+	Hours []HourRange `json:"hours,omitempty"`
+	// TimeZone is an IANA time zone name such as "Asia/Kolkata". Empty means UTC.
+	TimeZone string `json:"time_zone,omitempty"`
+}
+
+// ParseHourRange parses a range written as "18:00-21:00".
+func ParseHourRange(value string) (HourRange, error) {
+	start, end, ok := strings.Cut(value, "-")
+	if !ok {
+		return HourRange{}, fmt.Errorf("hour range %q must be HH:MM-HH:MM", value)
+	}
+	return HourRange{Start: strings.TrimSpace(start), End: strings.TrimSpace(end)}, nil
+}
+
+func (s Schedule) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+func (s *Schedule) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, s)
+	case string:
+		return json.Unmarshal([]byte(v), s)
+	default:
+		return fmt.Errorf("failed to unmarshal Schedule value: %v", value)
+	}
+}
+
+// Validate reports the first problem with the schedule.
+func (s *Schedule) Validate() error {
+	if _, err := s.location(); err != nil {
+		return fmt.Errorf("unknown time_zone %q", s.TimeZone)
+	}
+	for _, day := range s.Days {
+		if _, ok := weekdays[day]; !ok {
+			return fmt.Errorf("invalid day %q, use mon, tue, wed, thu, fri, sat or sun", day)
+		}
+	}
+	for _, hours := range s.Hours {
+		start, err := parseClock(hours.Start, false)
+		if err != nil {
+			return err
+		}
+		end, err := parseClock(hours.End, true)
+		if err != nil {
+			return err
+		}
+		if start == end {
+			return fmt.Errorf("hour range %s-%s is empty", hours.Start, hours.End)
+		}
+	}
+	return nil
+}
+
+// Contains reports whether the schedule is in effect at t. An invalid schedule
+// is never in effect.
+func (s *Schedule) Contains(t time.Time) bool {
+	loc, err := s.location()
+	if err != nil {
+		return false
+	}
+	t = t.In(loc)
+	if len(s.Hours) == 0 {
+		return s.allows(t.Weekday())
+	}
+
+	minute := t.Hour()*60 + t.Minute()
+	for _, hours := range s.Hours {
+		start, end, err := hours.minutes()
+		if err != nil {
+			return false
+		}
+		if start < end {
+			if s.allows(t.Weekday()) && minute >= start && minute < end {
+				return true
+			}
+			continue
+		}
+		// The range runs past midnight and belongs to the day it starts on.
+		if s.allows(t.Weekday()) && minute >= start {
+			return true
+		}
+		if s.allows((t.Weekday()+6)%7) && minute < end {
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns the earliest time at or after t when the schedule is in effect,
+// or false if it never is.
+func (s *Schedule) Next(t time.Time) (time.Time, bool) {
+	if s.Contains(t) {
+		return t, true
+	}
+	loc, err := s.location()
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	local := t.In(loc)
+	for offset := 0; offset <= 7; offset++ {
+		day := time.Date(local.Year(), local.Month(), local.Day()+offset, 0, 0, 0, 0, loc)
+		if !s.allows(day.Weekday()) {
+			continue
+		}
+		if len(s.Hours) == 0 {
+			if day.After(t) {
+				return day, true
+			}
+			continue
+		}
+
+		var earliest time.Time
+		for _, hours := range s.Hours {
+			start, _, err := hours.minutes()
+			if err != nil {
+				return time.Time{}, false
+			}
+			candidate := time.Date(day.Year(), day.Month(), day.Day(), start/60, start%60, 0, 0, loc)
+			if candidate.After(t) && (earliest.IsZero() || candidate.Before(earliest)) {
+				earliest = candidate
+			}
+		}
+		if !earliest.IsZero() {
+			return earliest, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// String describes the schedule for messages, e.g. "mon, tue 18:00-21:00 Asia/Kolkata".
+func (s *Schedule) String() string {
+	days := "every day"
+	if len(s.Days) > 0 {
+		names := make([]string, len(s.Days))
+		for i, day := range s.Days {
+			names[i] = string(day)
+		}
+		days = strings.Join(names, ", ")
+	}
+
+	hours := "all day"
+	if len(s.Hours) > 0 {
+		ranges := make([]string, len(s.Hours))
+		for i, h := range s.Hours {
+			ranges[i] = h.Start + "-" + h.End
+		}
+		hours = strings.Join(ranges, ", ")
+	}
+
+	zone := s.TimeZone
+	if zone == "" {
+		zone = "UTC"
+	}
+	return fmt.Sprintf("%s %s %s", days, hours, zone)
+}
+
+// Location returns the schedule's time zone.
+func (s *Schedule) Location() *time.Location {
+	loc, err := s.location()
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+func (s *Schedule) location() (*time.Location, error) {
+	if s.TimeZone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(s.TimeZone)
+}
+
+func (s *Schedule) allows(day time.Weekday) bool {
+	if len(s.Days) == 0 {
+		return true
+	}
+	for _, d := range s.Days {
+		if weekdays[d] == day {
+			return true
+		}
+	}
+	return false
+}
+
+// minutes returns the range as minutes since midnight, with an end of 24:00
+// as 0 so that it reads as running up to midnight.
+func (h HourRange) minutes() (int, int, error) {
+	start, err := parseClock(h.Start, false)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseClock(h.End, true)
+	if err != nil {
+		return 0, 0, err
+	}
+	return start, end % (24 * 60), nil
+}
+
+// parseClock parses HH:MM into minutes since midnight. 24:00 is only allowed
+// as the end of a range.
+func parseClock(value string, isEnd bool) (int, error) {
+	if isEnd && value == "24:00" {
+		return 24 * 60, nil
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, errors.New("hours must be HH:MM, e.g. 18:00")
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
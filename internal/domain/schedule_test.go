@@ -0,0 +1,56 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedule(t *testing.T) {
+	ist, err := time.LoadLocation("Asia/Kolkata")
+	require.NoError(t, err)
+	// 2 June 2025 is a Monday.
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2025, time.June, day, hour, minute, 0, 0, ist)
+	}
+
+	weekdayEvenings := &Schedule{
+		Days:     []Weekday{"mon", "tue", "wed", "thu", "fri"},
+		Hours:    []HourRange{{Start: "18:00", End: "21:00"}},
+		TimeZone: "Asia/Kolkata",
+	}
+	lateNights := &Schedule{
+		Days:     []Weekday{"fri"},
+		Hours:    []HourRange{{Start: "22:00", End: "02:00"}},
+		TimeZone: "Asia/Kolkata",
+	}
+	require.NoError(t, weekdayEvenings.Validate())
+	require.NoError(t, lateNights.Validate())
+
+	tests := []struct {
+		name     string
+		schedule *Schedule
+		at       time.Time
+		contains bool
+		next     time.Time
+	}{
+		{name: "inside the hours", schedule: weekdayEvenings, at: at(2, 19, 30), contains: true, next: at(2, 19, 30)},
+		{name: "same instant in another zone", schedule: weekdayEvenings, at: at(2, 19, 30).UTC(), contains: true, next: at(2, 19, 30)},
+		{name: "before the hours", schedule: weekdayEvenings, at: at(2, 9, 0), next: at(2, 18, 0)},
+		{name: "end is exclusive", schedule: weekdayEvenings, at: at(6, 21, 0), next: at(9, 18, 0)},
+		{name: "weekend", schedule: weekdayEvenings, at: at(7, 19, 0), next: at(9, 18, 0)},
+		{name: "overnight after midnight", schedule: lateNights, at: at(7, 1, 30), contains: true, next: at(7, 1, 30)},
+		{name: "overnight on the wrong day", schedule: lateNights, at: at(6, 1, 30), next: at(6, 22, 0)},
+		{name: "overnight after it ends", schedule: lateNights, at: at(7, 2, 0), next: at(13, 22, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.contains, tt.schedule.Contains(tt.at))
+			next, ok := tt.schedule.Next(tt.at)
+			require.True(t, ok)
+			assert.True(t, tt.next.Equal(next), "next = %s, want %s", next, tt.next)
+		})
+	}
+}
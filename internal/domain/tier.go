@@ -0,0 +1,101 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// @Description Discount given to orders of at least min_order_value, in the coupon's discount type
+type DiscountTier struct {
+	MinOrderValue Money `json:"min_order_value" example:"1000"`
+	DiscountValue Money `json:"discount_value" example:"10"`
+}
+
+// ParseDiscountTier parses a tier written as "1000:10", meaning a discount of
+// 10 on orders of 1000 or more.
+func ParseDiscountTier(value string) (DiscountTier, error) {
+	minOrder, discount, ok := strings.Cut(value, ":")
+	if !ok {
+		return DiscountTier{}, fmt.Errorf("%q is not MIN_ORDER:DISCOUNT", value)
+	}
+	var tier DiscountTier
+	var err error
+	if tier.MinOrderValue, err = ParseMoney(minOrder); err != nil {
+		return DiscountTier{}, fmt.Errorf("%q is not MIN_ORDER:DISCOUNT", value)
+	}
+	if tier.DiscountValue, err = ParseMoney(discount); err != nil {
+		return DiscountTier{}, fmt.Errorf("%q is not MIN_ORDER:DISCOUNT", value)
+	}
+	return tier, nil
+}
+
+func (t DiscountTier) String() string {
+	return t.MinOrderValue.String() + ":" + t.DiscountValue.String()
+}
+
+// DiscountTiers replace a coupon's single discount value with one that grows
+// with the order value. They are ordered by ascending min_order_value.
+type DiscountTiers []DiscountTier
+
+// Validate checks that tiers are in ascending order and that each discount is
+// valid for discountType.
+func (t DiscountTiers) Validate(discountType DiscountType) error {
+	for i, tier := range t {
+		if tier.MinOrderValue < 0 {
+			return fmt.Errorf("tier %d: min_order_value must not be negative", i+1)
+		}
+		if i > 0 && tier.MinOrderValue <= t[i-1].MinOrderValue {
+			return errors.New("tiers must be in ascending order of min_order_value")
+		}
+		if i > 0 && tier.DiscountValue <= t[i-1].DiscountValue {
+			return errors.New("each tier must give a larger discount than the one below")
+		}
+		switch discountType {
+		case Percentage:
+			if tier.DiscountValue <= 0 || tier.DiscountValue > MoneyFromInt(100) {
+				return fmt.Errorf("tier %d: percentage discount_value must be between 0 and 100", i+1)
+			}
+		case Fixed:
+			if tier.DiscountValue <= 0 {
+				return fmt.Errorf("tier %d: fixed discount_value must be positive", i+1)
+			}
+		}
+	}
+	return nil
+}
+
+// At returns the highest tier the order value reaches and the tier above it.
+// Either is nil if there is no such tier.
+func (t DiscountTiers) At(orderValue Money) (applied, next *DiscountTier) {
+	for i := range t {
+		if orderValue < t[i].MinOrderValue {
+			return applied, &t[i]
+		}
+		applied = &t[i]
+	}
+	return applied, nil
+}
+
+func (t DiscountTiers) Value() (driver.Value, error) {
+	if t == nil {
+		return nil, nil
+	}
+	return json.Marshal(t)
+}
+
+func (t *DiscountTiers) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*t = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, t)
+	case string:
+		return json.Unmarshal([]byte(v), t)
+	default:
+		return fmt.Errorf("failed to unmarshal DiscountTiers value: %v", value)
+	}
+}
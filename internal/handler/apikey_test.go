@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockAPIKeyService struct {
+	mock.Mock
+}
+
+func (m *MockAPIKeyService) IssueKey(ctx context.Context, req domain.APIKeyRequest) (*domain.IssuedAPIKey, error) {
+	args := m.Called(ctx, req)
+	key, _ := args.Get(0).(*domain.IssuedAPIKey)
+	return key, args.Error(1)
+}
+
+func (m *MockAPIKeyService) RegisterKey(ctx context.Context, name, rawKey string, scopes []string) error {
+	args := m.Called(ctx, name, rawKey, scopes)
+	return args.Error(0)
+}
+
+func (m *MockAPIKeyService) ListKeys(ctx context.Context) ([]domain.APIKey, error) {
+	args := m.Called(ctx)
+	keys, _ := args.Get(0).([]domain.APIKey)
+	return keys, args.Error(1)
+}
+
+func (m *MockAPIKeyService) RevokeKey(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockAPIKeyService) Authenticate(ctx context.Context, rawKey string) (*domain.Principal, error) {
+	args := m.Called(ctx, rawKey)
+	principal, _ := args.Get(0).(*domain.Principal)
+	return principal, args.Error(1)
+}
+
+func TestAPIKeyHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockService := new(MockAPIKeyService)
+	handler := NewAPIKeyHandler(mockService)
+	router := gin.New()
+	router.POST("/admin/api-keys", handler.CreateAPIKey)
+	router.DELETE("/admin/api-keys/:id", handler.RevokeAPIKey)
+
+	t.Run("create returns the plaintext key", func(t *testing.T) {
+		request := domain.APIKeyRequest{
+			Name:   "partner-a",
+			Scopes: []string{domain.ScopeCouponsValidate},
+		}
+		issued := &domain.IssuedAPIKey{
+			APIKey: domain.APIKey{ID: uuid.New(), Name: "partner-a", Scopes: request.Scopes},
+			Key:    "fk_secret",
+		}
+		mockService.On("IssueKey", mock.Anything, request).Return(issued, nil)
+
+		body, _ := json.Marshal(request)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/admin/api-keys", bytes.NewBuffer(body))
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var response domain.IssuedAPIKey
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "fk_secret", response.Key)
+		assert.NotContains(t, w.Body.String(), "key_hash")
+	})
+
+	t.Run("create rejects unknown scopes", func(t *testing.T) {
+		request := domain.APIKeyRequest{Name: "bad", Scopes: []string{"everything"}}
+		mockService.On("IssueKey", mock.Anything, request).Return(nil, &domain.InvalidRequestError{Reason: "unknown scope: everything"})
+
+		body, _ := json.Marshal(request)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/admin/api-keys", bytes.NewBuffer(body))
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("revoke unknown key", func(t *testing.T) {
+		id := uuid.New()
+		mockService.On("RevokeKey", mock.Anything, id).Return(&domain.APIKeyNotFoundError{ID: id.String()})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("DELETE", "/admin/api-keys/"+id.String(), nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("revoke with malformed id", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("DELETE", "/admin/api-keys/not-a-uuid", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
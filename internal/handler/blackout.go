@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/farmako/coupon-system/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type BlackoutHandler struct {
+	service service.BlackoutService
+}
+
+func NewBlackoutHandler(service service.BlackoutService) *BlackoutHandler {
+	return &BlackoutHandler{service: service}
+}
+
+// ListBlackouts godoc
+// @Summary List blackouts
+// @Description List the blackout periods that apply to every coupon
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} domain.Blackout
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/blackouts [get]
+func (h *BlackoutHandler) ListBlackouts(c *gin.Context) {
+	blackouts, err := h.service.ListBlackouts(c.Request.Context())
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, blackouts)
+}
+
+// CreateBlackout godoc
+// @Summary Create a blackout
+// @Description Create a period, such as a sale day or holiday, during which no coupon can be used
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body domain.BlackoutPeriod true "Blackout period"
+// @Success 201 {object} domain.Blackout
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/blackouts [post]
+func (h *BlackoutHandler) CreateBlackout(c *gin.Context) {
+	var request domain.BlackoutPeriod
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	blackout, err := h.service.CreateBlackout(c.Request.Context(), request)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, blackout)
+}
+
+// DeleteBlackout godoc
+// @Summary Delete a blackout
+// @Tags admin
+// @Security ApiKeyAuth
+// @Param id path string true "Blackout ID"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/blackouts/{id} [delete]
+func (h *BlackoutHandler) DeleteBlackout(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid blackout id"})
+		return
+	}
+
+	if err := h.service.DeleteBlackout(c.Request.Context(), id); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
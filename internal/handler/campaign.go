@@ -0,0 +1,219 @@
+package handler
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/farmako/coupon-system/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type CampaignHandler struct {
+	service service.CampaignService
+}
+
+func NewCampaignHandler(service service.CampaignService) *CampaignHandler {
+	return &CampaignHandler{service: service}
+}
+
+// ListCampaigns godoc
+// @Summary List campaigns
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} domain.Campaign
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/campaigns [get]
+func (h *CampaignHandler) ListCampaigns(c *gin.Context) {
+	campaigns, err := h.service.ListCampaigns(c.Request.Context())
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, campaigns)
+}
+
+// GetCampaign godoc
+// @Summary Get a campaign
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Campaign ID"
+// @Success 200 {object} domain.Campaign
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/campaigns/{id} [get]
+func (h *CampaignHandler) GetCampaign(c *gin.Context) {
+	id, ok := campaignID(c)
+	if !ok {
+		return
+	}
+
+	campaign, err := h.service.GetCampaign(c.Request.Context(), id)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, campaign)
+}
+
+// CreateCampaign godoc
+// @Summary Create a campaign
+// @Description Create a campaign holding the rules for its generated coupons. Campaigns whose discount exceeds the approval threshold are created pending approval.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body domain.Campaign true "Campaign"
+// @Success 201 {object} domain.Campaign
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/campaigns [post]
+func (h *CampaignHandler) CreateCampaign(c *gin.Context) {
+	var request domain.Campaign
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	campaign, err := h.service.CreateCampaign(c.Request.Context(), &request)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, campaign)
+}
+
+// ApproveCampaign godoc
+// @Summary Approve a campaign
+// @Description Approve a campaign pending approval. The approver must differ from the principal that created it.
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Campaign ID"
+// @Success 200 {object} domain.Campaign
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/campaigns/{id}/approve [post]
+func (h *CampaignHandler) ApproveCampaign(c *gin.Context) {
+	id, ok := campaignID(c)
+	if !ok {
+		return
+	}
+
+	campaign, err := h.service.ApproveCampaign(c.Request.Context(), id)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, campaign)
+}
+
+// GenerateCodes godoc
+// @Summary Generate campaign codes
+// @Description Generate unique, random single coupons sharing the campaign's rules. Codes exclude confusable characters unless a custom alphabet is given.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Campaign ID"
+// @Param request body domain.CodeGenerationRequest true "Code Generation Request"
+// @Success 201 {object} domain.CodeGenerationResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/campaigns/{id}/codes [post]
+func (h *CampaignHandler) GenerateCodes(c *gin.Context) {
+	id, ok := campaignID(c)
+	if !ok {
+		return
+	}
+
+	var request domain.CodeGenerationRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := h.service.GenerateCodes(c.Request.Context(), id, request)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// ExportCodes godoc
+// @Summary Export campaign codes
+// @Description Download every code generated for the campaign as CSV
+// @Tags admin
+// @Produce text/csv
+// @Security ApiKeyAuth
+// @Param id path string true "Campaign ID"
+// @Success 200 {string} string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/campaigns/{id}/codes [get]
+func (h *CampaignHandler) ExportCodes(c *gin.Context) {
+	id, ok := campaignID(c)
+	if !ok {
+		return
+	}
+
+	codes, err := h.service.ExportCodes(c.Request.Context(), id)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="campaign-%s-codes.csv"`, id))
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	_ = w.Write([]string{"code"})
+	for _, code := range codes {
+		_ = w.Write([]string{code})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		_ = c.Error(err)
+	}
+}
+
+// campaignID parses the :id path parameter, responding with 400 if it is
+// not a UUID.
+func campaignID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid campaign id"})
+		return uuid.Nil, false
+	}
+	return id, true
+}
@@ -1,19 +1,25 @@
 package handler
 
 import (
+	"log/slog"
 	"net/http"
 
 	"github.com/farmako/coupon-system/internal/domain"
 	"github.com/farmako/coupon-system/internal/service"
+	"github.com/farmako/coupon-system/internal/tracing"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
 )
 
+var tracer = otel.Tracer("github.com/farmako/coupon-system/internal/handler")
+
 type CouponHandler struct {
 	service service.CouponService
+	logger  *slog.Logger
 }
 
-func NewCouponHandler(service service.CouponService) *CouponHandler {
-	return &CouponHandler{service: service}
+func NewCouponHandler(service service.CouponService, logger *slog.Logger) *CouponHandler {
+	return &CouponHandler{service: service, logger: logger}
 }
 
 // GetApplicableCoupons godoc
@@ -25,17 +31,26 @@ func NewCouponHandler(service service.CouponService) *CouponHandler {
 // @Param request body domain.CouponRequest true "Coupon Request"
 // @Success 200 {array} domain.Coupon
 // @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /coupons/applicable [get]
 func (h *CouponHandler) GetApplicableCoupons(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "CouponHandler.GetApplicableCoupons")
+	defer span.End()
+
 	var request domain.CouponRequest
 	if err := c.ShouldBindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !bindUserID(c, &request.UserID) {
+		return
+	}
 
-	coupons, err := h.service.GetApplicableCoupons(c.Request.Context(), request)
+	coupons, err := h.service.GetApplicableCoupons(ctx, request)
 	if err != nil {
+		tracing.RecordError(span, err)
+		h.logger.ErrorContext(ctx, "failed to get applicable coupons", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -52,22 +67,31 @@ func (h *CouponHandler) GetApplicableCoupons(c *gin.Context) {
 // @Param request body domain.CouponValidationRequest true "Coupon Validation Request"
 // @Success 200 {object} domain.CouponValidationResponse
 // @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
 // @Failure 404 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /coupons/validate [post]
 func (h *CouponHandler) ValidateCoupon(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "CouponHandler.ValidateCoupon")
+	defer span.End()
+
 	var request domain.CouponValidationRequest
 	if err := c.ShouldBindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !bindUserID(c, &request.UserID) {
+		return
+	}
 
-	response, err := h.service.ValidateCoupon(c.Request.Context(), request)
+	response, err := h.service.ValidateCoupon(ctx, request)
 	if err != nil {
+		tracing.RecordError(span, err)
 		switch err.(type) {
 		case *domain.CouponNotFoundError:
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		default:
+			h.logger.ErrorContext(ctx, "failed to validate coupon", "code", request.Code, "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		}
 		return
@@ -75,3 +99,104 @@ func (h *CouponHandler) ValidateCoupon(c *gin.Context) {
 
 	c.JSON(http.StatusOK, response)
 }
+
+// RedeemCoupon godoc
+// @Summary Redeem a coupon
+// @Description Validate a coupon against an order and record the redemption
+// @Tags coupons
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body domain.CouponRedemptionRequest true "Coupon Redemption Request"
+// @Success 200 {object} domain.CouponRedemptionResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /coupons/redeem [post]
+func (h *CouponHandler) RedeemCoupon(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "CouponHandler.RedeemCoupon")
+	defer span.End()
+
+	var request domain.CouponRedemptionRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !bindUserID(c, &request.UserID) {
+		return
+	}
+
+	response, err := h.service.RedeemCoupon(ctx, request)
+	if err != nil {
+		tracing.RecordError(span, err)
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ReverseRedemption godoc
+// @Summary Reverse a redemption
+// @Description Record that an order was cancelled or refunded. Without a body the whole order is reversed, giving the use back to the user and the coupon; a partial refund gives back its share of the discount. Retrying with the same refunded_amount changes nothing. End users authenticated with a bearer token may not reverse redemptions.
+// @Tags coupons
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param order_id path string true "Order ID"
+// @Param request body domain.RedemptionReversalRequest false "Total refunded so far"
+// @Success 200 {object} domain.Redemption
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /coupons/redemptions/{order_id}/reverse [post]
+func (h *CouponHandler) ReverseRedemption(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "CouponHandler.ReverseRedemption")
+	defer span.End()
+
+	// Orders are reversed by the merchant's backend when they are cancelled
+	// or refunded, never by the user who placed them.
+	if principal := domain.PrincipalFromContext(ctx); principal != nil && principal.UserID != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "end users cannot reverse redemptions"})
+		return
+	}
+
+	var request domain.RedemptionReversalRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	redemption, err := h.service.ReverseRedemption(ctx, c.Param("order_id"), request)
+	if err != nil {
+		tracing.RecordError(span, err)
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, redemption)
+}
+
+// bindUserID ties the request's user ID to the end user identified by a bearer
+// token. An empty user ID is filled in from the token and a different one is
+// rejected. API key principals act on behalf of users and are trusted as-is.
+func bindUserID(c *gin.Context, userID *string) bool {
+	principal := domain.PrincipalFromContext(c.Request.Context())
+	if principal == nil || principal.UserID == "" {
+		return true
+	}
+
+	if *userID != "" && *userID != principal.UserID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "user_id does not match the authenticated user"})
+		return false
+	}
+
+	*userID = principal.UserID
+	return true
+}
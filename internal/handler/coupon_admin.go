@@ -0,0 +1,456 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/farmako/coupon-system/internal/couponcsv"
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/farmako/coupon-system/internal/repository"
+	"github.com/farmako/coupon-system/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+type CouponAdminHandler struct {
+	service service.CouponAdminService
+}
+
+func NewCouponAdminHandler(service service.CouponAdminService) *CouponAdminHandler {
+	return &CouponAdminHandler{service: service}
+}
+
+// ListCoupons godoc
+// @Summary List coupons
+// @Description List coupons one page at a time, including ones pending approval. Pass next_cursor from a response as cursor to fetch the following page with the same filters and sort.
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param status query string false "draft, pending_approval, paused, expired, scheduled or active"
+// @Param usage_type query string false "Usage type"
+// @Param discount_type query string false "Discount type"
+// @Param category query string false "Only coupons applicable to this category"
+// @Param medicine_id query string false "Only coupons applicable to this medicine"
+// @Param expires_after query string false "Expiry on or after this date (YYYY-MM-DD or RFC 3339)"
+// @Param expires_before query string false "Expiry before this date (YYYY-MM-DD or RFC 3339)"
+// @Param code_prefix query string false "Code prefix, ignoring case"
+// @Param sort query string false "created_at, code, expiry_date or discount_value; prefix with - for descending" default(-created_at)
+// @Param limit query int false "Page size" default(50)
+// @Param cursor query string false "Cursor from the previous page"
+// @Success 200 {object} repository.CouponPage
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/coupons [get]
+func (h *CouponAdminHandler) ListCoupons(c *gin.Context) {
+	query, err := parseCouponQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := h.service.SearchCoupons(c.Request.Context(), query)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// parseCouponQuery reads the listing parameters. Values the repository checks,
+// such as the sort field and status, are passed through unchecked.
+func parseCouponQuery(c *gin.Context) (repository.CouponQuery, error) {
+	query := repository.CouponQuery{
+		Filter: repository.CouponFilter{
+			Status:       domain.CouponStatus(c.Query("status")),
+			UsageType:    domain.UsageType(c.Query("usage_type")),
+			DiscountType: domain.DiscountType(c.Query("discount_type")),
+			Category:     c.Query("category"),
+			MedicineID:   c.Query("medicine_id"),
+			CodePrefix:   c.Query("code_prefix"),
+		},
+		Cursor:     c.Query("cursor"),
+		Descending: true,
+	}
+
+	if sort := c.Query("sort"); sort != "" {
+		query.SortBy, query.Descending = strings.TrimPrefix(sort, "-"), strings.HasPrefix(sort, "-")
+	}
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			return query, fmt.Errorf("limit must be a number")
+		}
+		query.Limit = n
+	}
+
+	for param, target := range map[string]**time.Time{
+		"expires_after":  &query.Filter.ExpiresAfter,
+		"expires_before": &query.Filter.ExpiresBefore,
+	} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			if t, err = time.Parse(time.RFC3339, value); err != nil {
+				return query, fmt.Errorf("%s must be YYYY-MM-DD or RFC 3339", param)
+			}
+		}
+		*target = &t
+	}
+	return query, nil
+}
+
+// GetCoupon godoc
+// @Summary Get a coupon
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param code path string true "Coupon Code"
+// @Success 200 {object} domain.Coupon
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/coupons/{code} [get]
+func (h *CouponAdminHandler) GetCoupon(c *gin.Context) {
+	coupon, err := h.service.GetCoupon(c.Request.Context(), c.Param("code"))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, coupon)
+}
+
+// CreateCoupon godoc
+// @Summary Create a coupon
+// @Description Create a coupon. Coupons whose discount exceeds the approval threshold are created pending approval.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body domain.Coupon true "Coupon"
+// @Success 201 {object} domain.Coupon
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/coupons [post]
+func (h *CouponAdminHandler) CreateCoupon(c *gin.Context) {
+	var request domain.Coupon
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	coupon, err := h.service.CreateCoupon(c.Request.Context(), &request)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, coupon)
+}
+
+// UpdateCoupon godoc
+// @Summary Update a coupon
+// @Description Replace a coupon's rules. Changing the discount re-applies the approval policy.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param code path string true "Coupon Code"
+// @Param request body domain.Coupon true "Coupon"
+// @Success 200 {object} domain.Coupon
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/coupons/{code} [put]
+func (h *CouponAdminHandler) UpdateCoupon(c *gin.Context) {
+	var request domain.Coupon
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	coupon, err := h.service.UpdateCoupon(c.Request.Context(), c.Param("code"), &request)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, coupon)
+}
+
+// DeleteCoupon godoc
+// @Summary Delete a coupon
+// @Tags admin
+// @Security ApiKeyAuth
+// @Param code path string true "Coupon Code"
+// @Success 204
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/coupons/{code} [delete]
+func (h *CouponAdminHandler) DeleteCoupon(c *gin.Context) {
+	if err := h.service.DeleteCoupon(c.Request.Context(), c.Param("code")); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ApproveCoupon godoc
+// @Summary Approve a coupon
+// @Description Approve a coupon pending approval. The approver must differ from the principal that requested approval.
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param code path string true "Coupon Code"
+// @Success 200 {object} domain.Coupon
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/coupons/{code}/approve [post]
+func (h *CouponAdminHandler) ApproveCoupon(c *gin.Context) {
+	coupon, err := h.service.ApproveCoupon(c.Request.Context(), c.Param("code"))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, coupon)
+}
+
+// PublishCoupon godoc
+// @Summary Publish a draft coupon
+// @Description Take a coupon out of draft. It becomes active at its start date, once approved if it needs approval.
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param code path string true "Coupon Code"
+// @Success 200 {object} domain.Coupon
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/coupons/{code}/publish [post]
+func (h *CouponAdminHandler) PublishCoupon(c *gin.Context) {
+	coupon, err := h.service.PublishCoupon(c.Request.Context(), c.Param("code"))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, coupon)
+}
+
+// PauseCoupon godoc
+// @Summary Pause a coupon
+// @Description Stop a coupon from being offered or redeemed until it is resumed
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param code path string true "Coupon Code"
+// @Success 200 {object} domain.Coupon
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/coupons/{code}/pause [post]
+func (h *CouponAdminHandler) PauseCoupon(c *gin.Context) {
+	coupon, err := h.service.PauseCoupon(c.Request.Context(), c.Param("code"))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, coupon)
+}
+
+// ResumeCoupon godoc
+// @Summary Resume a paused coupon
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param code path string true "Coupon Code"
+// @Success 200 {object} domain.Coupon
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/coupons/{code}/resume [post]
+func (h *CouponAdminHandler) ResumeCoupon(c *gin.Context) {
+	coupon, err := h.service.ResumeCoupon(c.Request.Context(), c.Param("code"))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, coupon)
+}
+
+// SetCouponBlackouts godoc
+// @Summary Set a coupon's blackout periods
+// @Description Replace the periods during which the coupon cannot be used. An empty list removes them.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param code path string true "Coupon Code"
+// @Param request body []domain.BlackoutPeriod true "Blackout periods"
+// @Success 200 {object} domain.Coupon
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/coupons/{code}/blackouts [put]
+func (h *CouponAdminHandler) SetCouponBlackouts(c *gin.Context) {
+	var request domain.BlackoutPeriods
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	coupon, err := h.service.SetCouponBlackouts(c.Request.Context(), c.Param("code"), request)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, coupon)
+}
+
+// maxImportBytes bounds the size of an uploaded coupon CSV.
+const maxImportBytes = 10 << 20
+
+// ImportCoupons godoc
+// @Summary Import coupons from CSV
+// @Description Create coupons from a CSV file, sent as the request body or as the "file" field of a multipart form. Every row is validated first and nothing is created if any row has an error. With dry_run=true the file is only validated.
+// @Tags admin
+// @Accept text/csv
+// @Accept multipart/form-data
+// @Produce json
+// @Security ApiKeyAuth
+// @Param dry_run query bool false "Validate without creating coupons"
+// @Success 200 {object} domain.CouponImportResult "Dry run"
+// @Success 201 {object} domain.CouponImportResult
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 422 {object} domain.CouponImportResult
+// @Failure 500 {object} map[string]string
+// @Router /admin/coupons/import [post]
+func (h *CouponAdminHandler) ImportCoupons(c *gin.Context) {
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "dry_run must be true or false"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes)
+	var body io.Reader = c.Request.Body
+	if c.ContentType() == "multipart/form-data" {
+		file, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "multipart upload needs a \"file\" field"})
+			return
+		}
+		f, err := file.Open()
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		defer f.Close()
+		body = f
+	}
+
+	rows, err := couponcsv.Decode(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid CSV: " + err.Error()})
+		return
+	}
+
+	result, err := h.service.ImportCoupons(c.Request.Context(), rows, dryRun)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	switch {
+	case len(result.Errors) > 0:
+		c.JSON(http.StatusUnprocessableEntity, result)
+	case dryRun:
+		c.JSON(http.StatusOK, result)
+	default:
+		c.JSON(http.StatusCreated, result)
+	}
+}
+
+// ExportCoupons godoc
+// @Summary Export coupons as CSV
+// @Description Download every coupon in the format accepted by the import endpoint
+// @Tags admin
+// @Produce text/csv
+// @Security ApiKeyAuth
+// @Success 200 {string} string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/coupons/export [get]
+func (h *CouponAdminHandler) ExportCoupons(c *gin.Context) {
+	coupons, err := h.service.ListCoupons(c.Request.Context())
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	// Encoding fails before writing anything when a coupon cannot be
+	// represented in CSV, so the error can still be reported.
+	var buf bytes.Buffer
+	if err := couponcsv.Encode(&buf, coupons); err != nil {
+		writeError(c, &domain.ConflictError{Reason: err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="coupons.csv"`)
+	c.Data(http.StatusOK, "text/csv", buf.Bytes())
+}
+
+// writeError maps domain errors to HTTP status codes.
+func writeError(c *gin.Context, err error) {
+	switch err.(type) {
+	case *domain.InvalidRequestError:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case *domain.ForbiddenError:
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case *domain.CouponNotFoundError, *domain.CampaignNotFoundError, *domain.BlackoutNotFoundError, *domain.RedemptionNotFoundError:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case *domain.ConflictError:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		// Unexpected errors are attached to the context for the access log.
+		_ = c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/farmako/coupon-system/internal/repository"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCouponQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	parse := func(rawQuery string) (repository.CouponQuery, error) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/admin/coupons?"+rawQuery, nil)
+		return parseCouponQuery(c)
+	}
+
+	t.Run("defaults to newest first", func(t *testing.T) {
+		query, err := parse("")
+		require.NoError(t, err)
+		assert.Equal(t, repository.CouponQuery{Descending: true}, query)
+	})
+
+	t.Run("reads filters, sort and paging", func(t *testing.T) {
+		query, err := parse("status=active&usage_type=one_time&discount_type=fixed&category=vitamins" +
+			"&medicine_id=med1&code_prefix=SUM&expires_after=2025-01-01&expires_before=2025-02-01T00:00:00Z" +
+			"&sort=expiry_date&limit=20&cursor=abc")
+		require.NoError(t, err)
+
+		after := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+		before := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+		assert.Equal(t, repository.CouponQuery{
+			Filter: repository.CouponFilter{
+				Status:        "active",
+				UsageType:     domain.OneTime,
+				DiscountType:  domain.Fixed,
+				Category:      "vitamins",
+				MedicineID:    "med1",
+				CodePrefix:    "SUM",
+				ExpiresAfter:  &after,
+				ExpiresBefore: &before,
+			},
+			SortBy: "expiry_date",
+			Limit:  20,
+			Cursor: "abc",
+		}, query)
+	})
+
+	t.Run("a leading dash sorts descending", func(t *testing.T) {
+		query, err := parse("sort=-discount_value")
+		require.NoError(t, err)
+		assert.Equal(t, "discount_value", query.SortBy)
+		assert.True(t, query.Descending)
+	})
+
+	t.Run("rejects malformed values", func(t *testing.T) {
+		_, err := parse("limit=ten")
+		assert.Error(t, err)
+		_, err = parse("expires_after=soon")
+		assert.Error(t, err)
+	})
+}
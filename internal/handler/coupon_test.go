@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/farmako/coupon-system/internal/logging"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -29,10 +30,23 @@ func (m *MockCouponService) ValidateCoupon(ctx context.Context, req domain.Coupo
 	return args.Get(0).(*domain.CouponValidationResponse), args.Error(1)
 }
 
+func (m *MockCouponService) RedeemCoupon(ctx context.Context, req domain.CouponRedemptionRequest) (*domain.CouponRedemptionResponse, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).(*domain.CouponRedemptionResponse), args.Error(1)
+}
+
+func (m *MockCouponService) ReverseRedemption(ctx context.Context, orderID string, req domain.RedemptionReversalRequest) (*domain.Redemption, error) {
+	args := m.Called(ctx, orderID, req)
+	if redemption, ok := args.Get(0).(*domain.Redemption); ok {
+		return redemption, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
 func TestGetApplicableCoupons(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	mockService := new(MockCouponService)
-	handler := NewCouponHandler(mockService)
+	handler := NewCouponHandler(mockService, logging.Discard())
 	router := gin.New()
 	router.GET("/coupons/applicable", handler.GetApplicableCoupons)
 
@@ -40,7 +54,7 @@ func TestGetApplicableCoupons(t *testing.T) {
 		request := domain.CouponRequest{
 			MedicineIDs: []string{"med1", "med2"},
 			Categories:  []string{"cat1"},
-			OrderValue:  100.0,
+			OrderValue:  domain.MoneyFromInt(100),
 			UserID:      "user1",
 		}
 
@@ -50,8 +64,8 @@ func TestGetApplicableCoupons(t *testing.T) {
 				ExpiryDate:    time.Now().Add(24 * time.Hour),
 				UsageType:     "one_time",
 				DiscountType:  "percentage",
-				DiscountValue: 10.0,
-				MinOrderValue: 50.0,
+				DiscountValue: domain.MoneyFromInt(10),
+				MinOrderValue: domain.MoneyFromInt(50),
 			},
 		}
 
@@ -83,7 +97,7 @@ func TestGetApplicableCoupons(t *testing.T) {
 func TestValidateCoupon(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	mockService := new(MockCouponService)
-	handler := NewCouponHandler(mockService)
+	handler := NewCouponHandler(mockService, logging.Discard())
 	router := gin.New()
 	router.POST("/coupons/validate", handler.ValidateCoupon)
 
@@ -94,15 +108,15 @@ func TestValidateCoupon(t *testing.T) {
 			Code:        "TEST123",
 			MedicineIDs: []string{"med1", "med2"},
 			Categories:  []string{"cat1"},
-			OrderValue:  100.0,
+			OrderValue:  domain.MoneyFromInt(100),
 			UserID:      "user1",
 		}
 
 		expectedResponse := &domain.CouponValidationResponse{
 			IsValid:     true,
 			Message:     "Coupon is valid",
-			Discount:    10.0,
-			FinalAmount: 90.0,
+			Discount:    domain.MoneyFromInt(10),
+			FinalAmount: domain.MoneyFromInt(90),
 		}
 
 		mockService.On("ValidateCoupon", mock.Anything, request).Return(expectedResponse, nil)
@@ -124,7 +138,7 @@ func TestValidateCoupon(t *testing.T) {
 			Code:        "INVALID",
 			MedicineIDs: []string{"med1"},
 			Categories:  []string{"cat1"},
-			OrderValue:  100.0,
+			OrderValue:  domain.MoneyFromInt(100),
 			UserID:      "user1",
 		}
 
@@ -138,3 +152,92 @@ func TestValidateCoupon(t *testing.T) {
 		assert.Equal(t, http.StatusNotFound, w.Code)
 	})
 }
+
+func TestValidateCouponBindsTokenUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockService := new(MockCouponService)
+	handler := NewCouponHandler(mockService, logging.Discard())
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		principal := &domain.Principal{ID: "user1", Type: domain.PrincipalUser, UserID: "user1"}
+		c.Request = c.Request.WithContext(domain.ContextWithPrincipal(c.Request.Context(), principal))
+	})
+	router.POST("/coupons/validate", handler.ValidateCoupon)
+
+	t.Run("fills in the user from the token", func(t *testing.T) {
+		expected := domain.CouponValidationRequest{Code: "TEST123", OrderValue: domain.MoneyFromInt(100), UserID: "user1"}
+		mockService.On("ValidateCoupon", mock.Anything, expected).Return(&domain.CouponValidationResponse{IsValid: true}, nil)
+
+		body, _ := json.Marshal(domain.CouponValidationRequest{Code: "TEST123", OrderValue: domain.MoneyFromInt(100)})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/coupons/validate", bytes.NewBuffer(body))
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		mockService.AssertCalled(t, "ValidateCoupon", mock.Anything, expected)
+	})
+
+	t.Run("rejects a different user in the body", func(t *testing.T) {
+		body, _ := json.Marshal(domain.CouponValidationRequest{Code: "TEST123", OrderValue: domain.MoneyFromInt(100), UserID: "user2"})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/coupons/validate", bytes.NewBuffer(body))
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
+
+func TestReverseRedemption(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockService := new(MockCouponService)
+	handler := NewCouponHandler(mockService, logging.Discard())
+	router := gin.New()
+	router.POST("/coupons/redemptions/:order_id/reverse", handler.ReverseRedemption)
+
+	t.Run("reverses the whole order without a body", func(t *testing.T) {
+		mockService.On("ReverseRedemption", mock.Anything, "order-1", domain.RedemptionReversalRequest{}).
+			Return(&domain.Redemption{OrderID: "order-1", RefundedAmount: domain.MoneyFromInt(200), ReversedDiscount: domain.MoneyFromInt(20)}, nil)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/coupons/redemptions/order-1/reverse", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"reversed_discount":20`)
+	})
+
+	t.Run("passes on a partial refund", func(t *testing.T) {
+		refunded := domain.MoneyFromInt(50)
+		expected := domain.RedemptionReversalRequest{RefundedAmount: &refunded}
+		mockService.On("ReverseRedemption", mock.Anything, "order-2", expected).
+			Return(&domain.Redemption{OrderID: "order-2", RefundedAmount: domain.MoneyFromInt(50), ReversedDiscount: domain.MoneyFromInt(5)}, nil)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/coupons/redemptions/order-2/reverse", bytes.NewBufferString(`{"refunded_amount": 50}`))
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("unknown order", func(t *testing.T) {
+		mockService.On("ReverseRedemption", mock.Anything, "order-3", domain.RedemptionReversalRequest{}).
+			Return(nil, &domain.RedemptionNotFoundError{OrderID: "order-3"})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/coupons/redemptions/order-3/reverse", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("rejects end users", func(t *testing.T) {
+		principal := &domain.Principal{ID: "user1", Type: domain.PrincipalUser, UserID: "user1", Scopes: []string{domain.ScopeCouponsRedeem}}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/coupons/redemptions/order-1/reverse", nil)
+		req = req.WithContext(domain.ContextWithPrincipal(req.Context(), principal))
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		mockService.AssertNumberOfCalls(t, "ReverseRedemption", 3)
+	})
+}
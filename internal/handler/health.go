@@ -1,78 +1,147 @@
 package handler
 
 import (
-	"context"
 	"net/http"
+	"sync/atomic"
 	"time"
 
+	"github.com/farmako/coupon-system/internal/health"
 	"github.com/gin-gonic/gin"
-	"github.com/redis/go-redis/v9"
-	"gorm.io/gorm"
 )
 
+// HealthHandler serves health endpoints from the checker's cached statuses,
+// so probes never wait on a dependency.
 type HealthHandler struct {
-	db          *gorm.DB
-	redisClient *redis.Client
+	checker  *health.Checker
+	draining atomic.Bool
 }
 
-func NewHealthHandler(db *gorm.DB, redisClient *redis.Client) *HealthHandler {
-	return &HealthHandler{
-		db:          db,
-		redisClient: redisClient,
-	}
+func NewHealthHandler(checker *health.Checker) *HealthHandler {
+	return &HealthHandler{checker: checker}
 }
 
 type HealthResponse struct {
 	Status    string            `json:"status"`
 	Timestamp time.Time         `json:"timestamp"`
 	Services  map[string]string `json:"services"`
+	// Details holds extra information per service, such as database pool stats.
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// Health states reported by /health. A failed non-critical dependency only
+// degrades the service.
+const (
+	HealthHealthy   = "healthy"
+	HealthDegraded  = "degraded"
+	HealthUnhealthy = "unhealthy"
+)
+
+// Readiness states reported by /readyz.
+const (
+	ReadinessReady    = "ready"
+	ReadinessDegraded = "degraded"
+	ReadinessNotReady = "not_ready"
+	ReadinessDraining = "draining"
+)
+
+type ReadinessResponse struct {
+	Status    string                   `json:"status"`
+	Timestamp time.Time                `json:"timestamp"`
+	Checks    map[string]health.Status `json:"checks,omitempty"`
+}
+
+// StartDraining makes /readyz fail so load balancers stop routing new
+// requests while in-flight ones finish during shutdown.
+func (h *HealthHandler) StartDraining() {
+	h.draining.Store(true)
 }
 
 // @Summary Health check endpoint
-// @Description Check the health of the system and its dependencies
+// @Description Check the health of the system and its dependencies. Fails only when a critical dependency is down.
 // @Tags health
 // @Produce json
 // @Success 200 {object} HealthResponse
+// @Failure 503 {object} HealthResponse
 // @Router /health [get]
 func (h *HealthHandler) HealthCheck(c *gin.Context) {
-	ctx := c.Request.Context()
 	response := HealthResponse{
-		Status:    "healthy",
+		Status:    HealthHealthy,
 		Timestamp: time.Now(),
 		Services:  make(map[string]string),
 	}
 
-	// Check database
-	if err := h.checkDatabase(ctx); err != nil {
-		response.Status = "unhealthy"
-		response.Services["database"] = "unhealthy: " + err.Error()
-	} else {
-		response.Services["database"] = "healthy"
+	for name, status := range h.checker.Snapshot() {
+		if status.Details != nil {
+			if response.Details == nil {
+				response.Details = make(map[string]any)
+			}
+			response.Details[name] = status.Details
+		}
+		if status.Status == health.StatusUp {
+			response.Services[name] = "healthy"
+			continue
+		}
+		response.Services[name] = "unhealthy: " + status.Error
+		if status.Critical {
+			response.Status = HealthUnhealthy
+		} else if response.Status == HealthHealthy {
+			response.Status = HealthDegraded
+		}
+	}
+
+	if response.Status == HealthUnhealthy {
+		c.JSON(http.StatusServiceUnavailable, response)
+		return
 	}
+	c.JSON(http.StatusOK, response)
+}
+
+// Livez godoc
+// @Summary Liveness probe
+// @Description Report that the process is running. Dependencies are not checked.
+// @Tags health
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Router /livez [get]
+func (h *HealthHandler) Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "alive"})
+}
 
-	// Check Redis
-	if err := h.checkRedis(ctx); err != nil {
-		response.Status = "unhealthy"
-		response.Services["redis"] = "unhealthy: " + err.Error()
-	} else {
-		response.Services["redis"] = "healthy"
+// Readyz godoc
+// @Summary Readiness probe
+// @Description Report cached dependency status. Fails when a critical dependency is down or the service is draining.
+// @Tags health
+// @Produce json
+// @Success 200 {object} ReadinessResponse
+// @Failure 503 {object} ReadinessResponse
+// @Router /readyz [get]
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	response := ReadinessResponse{
+		Status:    ReadinessReady,
+		Timestamp: time.Now(),
 	}
 
-	if response.Status == "healthy" {
-		c.JSON(http.StatusOK, response)
-	} else {
+	if h.draining.Load() {
+		response.Status = ReadinessDraining
 		c.JSON(http.StatusServiceUnavailable, response)
+		return
 	}
-}
 
-func (h *HealthHandler) checkDatabase(ctx context.Context) error {
-	sqlDB, err := h.db.DB()
-	if err != nil {
-		return err
+	response.Checks = h.checker.Snapshot()
+	for _, status := range response.Checks {
+		if status.Status == health.StatusUp {
+			continue
+		}
+		if status.Critical {
+			response.Status = ReadinessNotReady
+		} else if response.Status == ReadinessReady {
+			response.Status = ReadinessDegraded
+		}
 	}
-	return sqlDB.PingContext(ctx)
-}
 
-func (h *HealthHandler) checkRedis(ctx context.Context) error {
-	return h.redisClient.Ping(ctx).Err()
+	if response.Status == ReadinessNotReady {
+		c.JSON(http.StatusServiceUnavailable, response)
+		return
+	}
+	c.JSON(http.StatusOK, response)
 }
@@ -1,12 +1,14 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/farmako/coupon-system/internal/health"
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
@@ -14,6 +16,15 @@ import (
 	"gorm.io/gorm"
 )
 
+// newCheckedHealthHandler returns a handler whose checker has probed once.
+func newCheckedHealthHandler(db *gorm.DB, redisClient *redis.Client) *HealthHandler {
+	checker := health.NewChecker(time.Minute)
+	checker.Register(health.DatabaseCheck(db, true, time.Second))
+	checker.Register(health.RedisCheck(redisClient, false, time.Second))
+	checker.CheckNow(context.Background())
+	return NewHealthHandler(checker)
+}
+
 func TestHealthHandler(t *testing.T) {
 	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	assert.NoError(t, err)
@@ -22,7 +33,7 @@ func TestHealthHandler(t *testing.T) {
 		Addr: "localhost:6379",
 	})
 
-	handler := NewHealthHandler(db, redisClient)
+	handler := newCheckedHealthHandler(db, redisClient)
 
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
@@ -50,7 +61,7 @@ func TestHealthHandler(t *testing.T) {
 		sqlDB, _ := closedDB.DB()
 		sqlDB.Close()
 
-		handler := NewHealthHandler(closedDB, redisClient)
+		handler := newCheckedHealthHandler(closedDB, redisClient)
 		router := gin.New()
 		router.GET("/health", handler.HealthCheck)
 
@@ -68,12 +79,12 @@ func TestHealthHandler(t *testing.T) {
 		assert.Contains(t, response.Services["database"], "unhealthy")
 	})
 
-	t.Run("should return unhealthy when redis is down", func(t *testing.T) {
+	t.Run("should return degraded when redis is down", func(t *testing.T) {
 		closedRedis := redis.NewClient(&redis.Options{
 			Addr: "localhost:9999", // Non-existent port
 		})
 
-		handler := NewHealthHandler(db, closedRedis)
+		handler := newCheckedHealthHandler(db, closedRedis)
 		router := gin.New()
 		router.GET("/health", handler.HealthCheck)
 
@@ -81,13 +92,109 @@ func TestHealthHandler(t *testing.T) {
 		req, _ := http.NewRequest("GET", "/health", nil)
 		router.ServeHTTP(w, req)
 
-		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, http.StatusOK, w.Code)
 
 		var response HealthResponse
 		err := json.Unmarshal(w.Body.Bytes(), &response)
 		assert.NoError(t, err)
 
-		assert.Equal(t, "unhealthy", response.Status)
+		assert.Equal(t, "degraded", response.Status)
+		assert.Equal(t, "healthy", response.Services["database"])
 		assert.Contains(t, response.Services["redis"], "unhealthy")
 	})
 }
+
+func TestReadinessProbes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	downRedis := redis.NewClient(&redis.Options{
+		Addr: "localhost:9999", // Non-existent port
+	})
+
+	serve := func(handler *HealthHandler, path string) (*httptest.ResponseRecorder, ReadinessResponse) {
+		router := gin.New()
+		router.GET("/livez", handler.Livez)
+		router.GET("/readyz", handler.Readyz)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+
+		var response ReadinessResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &response)
+		return w, response
+	}
+
+	t.Run("liveness does not depend on dependencies", func(t *testing.T) {
+		closedDB, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		sqlDB, _ := closedDB.DB()
+		sqlDB.Close()
+
+		w, _ := serve(newCheckedHealthHandler(closedDB, downRedis), "/livez")
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("should stay ready but degraded when redis is down", func(t *testing.T) {
+		w, response := serve(newCheckedHealthHandler(db, downRedis), "/readyz")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, ReadinessDegraded, response.Status)
+		assert.Equal(t, "up", response.Checks["database"].Status)
+		assert.True(t, response.Checks["database"].Critical)
+		assert.Equal(t, "down", response.Checks["redis"].Status)
+		assert.NotEmpty(t, response.Checks["redis"].Error)
+		assert.Contains(t, response.Checks["database"].Details, "open_connections")
+	})
+
+	t.Run("should not be ready when the database is down", func(t *testing.T) {
+		closedDB, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		sqlDB, _ := closedDB.DB()
+		sqlDB.Close()
+
+		w, response := serve(newCheckedHealthHandler(closedDB, downRedis), "/readyz")
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, ReadinessNotReady, response.Status)
+	})
+
+	t.Run("should not be ready while draining", func(t *testing.T) {
+		handler := newCheckedHealthHandler(db, downRedis)
+		handler.StartDraining()
+
+		w, response := serve(handler, "/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, ReadinessDraining, response.Status)
+
+		w, _ = serve(handler, "/livez")
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
+
+func TestHealthServedFromCache(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var probes int
+	checker := health.NewChecker(time.Minute)
+	checker.Register(health.Check{Name: "database", Critical: true, Probe: func(ctx context.Context) error {
+		probes++
+		return nil
+	}})
+	handler := NewHealthHandler(checker)
+	router := gin.New()
+	router.GET("/readyz", handler.Readyz)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/readyz", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code, "checks that never ran are not ready")
+
+	checker.CheckNow(context.Background())
+	for i := 0; i < 3; i++ {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	assert.Equal(t, 1, probes)
+}
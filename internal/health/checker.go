@@ -0,0 +1,165 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// Status is the cached outcome of a check's most recent probe.
+type Status struct {
+	Result
+	LastChecked         time.Time  `json:"last_checked"`
+	LastSuccess         *time.Time `json:"last_success,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	Details             any        `json:"details,omitempty"`
+}
+
+// PoolStats summarises a database/sql connection pool.
+type PoolStats struct {
+	MaxOpenConnections int     `json:"max_open_connections"`
+	OpenConnections    int     `json:"open_connections"`
+	InUse              int     `json:"in_use"`
+	Idle               int     `json:"idle"`
+	WaitCount          int64   `json:"wait_count"`
+	WaitDurationMs     float64 `json:"wait_duration_ms"`
+	MaxIdleClosed      int64   `json:"max_idle_closed"`
+	MaxLifetimeClosed  int64   `json:"max_lifetime_closed"`
+}
+
+// Checker probes registered checks in the background and caches their status,
+// so health endpoints answer instantly and never wait on a hung dependency.
+type Checker struct {
+	interval time.Duration
+
+	mu       sync.RWMutex
+	checks   []Check
+	statuses map[string]Status
+}
+
+func NewChecker(interval time.Duration) *Checker {
+	return &Checker{
+		interval: interval,
+		statuses: make(map[string]Status),
+	}
+}
+
+// Register adds a check. It is reported as down until its first probe.
+func (c *Checker) Register(check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, check)
+}
+
+// Run probes every check immediately and then once per interval until ctx is
+// cancelled.
+func (c *Checker) Run(ctx context.Context) {
+	c.CheckNow(ctx)
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.CheckNow(ctx)
+		}
+	}
+}
+
+// CheckNow probes every check once and updates the cache.
+func (c *Checker) CheckNow(ctx context.Context) {
+	c.mu.RLock()
+	checks := append([]Check(nil), c.checks...)
+	c.mu.RUnlock()
+
+	results := Run(ctx, checks)
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, result := range results {
+		status := c.statuses[name]
+		status.Result = result
+		status.LastChecked = now
+		if result.Status == StatusUp {
+			status.LastSuccess = &now
+			status.ConsecutiveFailures = 0
+		} else {
+			status.ConsecutiveFailures++
+		}
+		c.statuses[name] = status
+	}
+}
+
+// Snapshot returns the cached status of every registered check.
+func (c *Checker) Snapshot() map[string]Status {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	snapshot := make(map[string]Status, len(c.checks))
+	for _, check := range c.checks {
+		status, ok := c.statuses[check.Name]
+		if !ok {
+			status = Status{Result: Result{
+				Status:   StatusDown,
+				Critical: check.Critical,
+				Error:    "not checked yet",
+			}}
+		}
+		if check.Details != nil {
+			status.Details = check.Details()
+		}
+		snapshot[check.Name] = status
+	}
+	return snapshot
+}
+
+// DatabaseCheck pings the database behind db and reports its pool statistics.
+func DatabaseCheck(db *gorm.DB, critical bool, timeout time.Duration) Check {
+	return Check{
+		Details: func() any {
+			sqlDB, err := db.DB()
+			if err != nil {
+				return nil
+			}
+			stats := sqlDB.Stats()
+			return PoolStats{
+				MaxOpenConnections: stats.MaxOpenConnections,
+				OpenConnections:    stats.OpenConnections,
+				InUse:              stats.InUse,
+				Idle:               stats.Idle,
+				WaitCount:          stats.WaitCount,
+				WaitDurationMs:     float64(stats.WaitDuration.Microseconds()) / 1000,
+				MaxIdleClosed:      stats.MaxIdleClosed,
+				MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+			}
+		},
+		Name:     "database",
+		Critical: critical,
+		Timeout:  timeout,
+		Probe: func(ctx context.Context) error {
+			sqlDB, err := db.DB()
+			if err != nil {
+				return err
+			}
+			return sqlDB.PingContext(ctx)
+		},
+	}
+}
+
+// RedisCheck pings the Redis server behind client.
+func RedisCheck(client *redis.Client, critical bool, timeout time.Duration) Check {
+	return Check{
+		Name:     "redis",
+		Critical: critical,
+		Timeout:  timeout,
+		Probe: func(ctx context.Context) error {
+			return client.Ping(ctx).Err()
+		},
+	}
+}
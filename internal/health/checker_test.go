@@ -0,0 +1,68 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecker(t *testing.T) {
+	t.Run("should track consecutive failures and last success", func(t *testing.T) {
+		var failing atomic.Bool
+		checker := NewChecker(time.Minute)
+		checker.Register(Check{Name: "redis", Probe: func(ctx context.Context) error {
+			if failing.Load() {
+				return errors.New("connection refused")
+			}
+			return nil
+		}})
+
+		status := checker.Snapshot()["redis"]
+		assert.Equal(t, StatusDown, status.Status)
+		assert.Equal(t, "not checked yet", status.Error)
+
+		checker.CheckNow(context.Background())
+		status = checker.Snapshot()["redis"]
+		require.Equal(t, StatusUp, status.Status)
+		require.NotNil(t, status.LastSuccess)
+		lastSuccess := *status.LastSuccess
+
+		failing.Store(true)
+		checker.CheckNow(context.Background())
+		checker.CheckNow(context.Background())
+		status = checker.Snapshot()["redis"]
+		assert.Equal(t, StatusDown, status.Status)
+		assert.Equal(t, 2, status.ConsecutiveFailures)
+		assert.Equal(t, lastSuccess, *status.LastSuccess)
+		assert.True(t, status.LastChecked.After(lastSuccess))
+
+		failing.Store(false)
+		checker.CheckNow(context.Background())
+		assert.Equal(t, 0, checker.Snapshot()["redis"].ConsecutiveFailures)
+	})
+
+	t.Run("should probe periodically until cancelled", func(t *testing.T) {
+		var probes atomic.Int32
+		checker := NewChecker(10 * time.Millisecond)
+		checker.Register(Check{Name: "database", Probe: func(ctx context.Context) error {
+			probes.Add(1)
+			return nil
+		}})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			checker.Run(ctx)
+			close(done)
+		}()
+
+		assert.Eventually(t, func() bool { return probes.Load() >= 3 }, time.Second, 5*time.Millisecond)
+		cancel()
+		<-done
+	})
+}
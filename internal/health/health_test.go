@@ -0,0 +1,35 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	checks := []Check{
+		{Name: "ok", Critical: true, Probe: func(ctx context.Context) error { return nil }},
+		{Name: "failing", Probe: func(ctx context.Context) error { return errors.New("connection refused") }},
+		{Name: "hung", Timeout: 20 * time.Millisecond, Probe: func(ctx context.Context) error {
+			time.Sleep(time.Second)
+			return nil
+		}},
+	}
+
+	start := time.Now()
+	results := Run(context.Background(), checks)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+
+	assert.Equal(t, StatusUp, results["ok"].Status)
+	assert.True(t, results["ok"].Critical)
+
+	assert.Equal(t, StatusDown, results["failing"].Status)
+	assert.Equal(t, "connection refused", results["failing"].Error)
+
+	assert.Equal(t, StatusDown, results["hung"].Status)
+	assert.Equal(t, context.DeadlineExceeded.Error(), results["hung"].Error)
+	assert.GreaterOrEqual(t, results["hung"].LatencyMs, 20.0)
+}
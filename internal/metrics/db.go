@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const startTimeKey = "metrics:start_time"
+
+// InstrumentDB registers GORM callbacks that time every database call.
+func (m *Metrics) InstrumentDB(db *gorm.DB) error {
+	callbacks := db.Callback()
+	return errors.Join(
+		callbacks.Create().Before("gorm:create").Register("metrics:before_create", startDBTimer),
+		callbacks.Create().After("gorm:create").Register("metrics:after_create", m.stopDBTimer("create")),
+		callbacks.Query().Before("gorm:query").Register("metrics:before_query", startDBTimer),
+		callbacks.Query().After("gorm:query").Register("metrics:after_query", m.stopDBTimer("query")),
+		callbacks.Update().Before("gorm:update").Register("metrics:before_update", startDBTimer),
+		callbacks.Update().After("gorm:update").Register("metrics:after_update", m.stopDBTimer("update")),
+		callbacks.Delete().Before("gorm:delete").Register("metrics:before_delete", startDBTimer),
+		callbacks.Delete().After("gorm:delete").Register("metrics:after_delete", m.stopDBTimer("delete")),
+		callbacks.Row().Before("gorm:row").Register("metrics:before_row", startDBTimer),
+		callbacks.Row().After("gorm:row").Register("metrics:after_row", m.stopDBTimer("row")),
+		callbacks.Raw().Before("gorm:raw").Register("metrics:before_raw", startDBTimer),
+		callbacks.Raw().After("gorm:raw").Register("metrics:after_raw", m.stopDBTimer("raw")),
+	)
+}
+
+func startDBTimer(tx *gorm.DB) {
+	tx.InstanceSet(startTimeKey, time.Now())
+}
+
+func (m *Metrics) stopDBTimer(operation string) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		value, ok := tx.InstanceGet(startTimeKey)
+		if !ok {
+			return
+		}
+		err := tx.Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = nil
+		}
+		m.observeDB(operation, tx.Statement.Table, err, time.Since(value.(time.Time)))
+	}
+}
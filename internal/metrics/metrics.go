@@ -0,0 +1,189 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "coupon"
+
+// Metrics holds the service's Prometheus collectors. All recording methods are
+// safe to call on a nil *Metrics, so components can be built without metrics
+// in tests.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests        *prometheus.CounterVec
+	httpDuration        *prometheus.HistogramVec
+	validations         *prometheus.CounterVec
+	discountIssued      *prometheus.HistogramVec
+	rateLimitRejections *prometheus.CounterVec
+	rateLimitErrors     prometheus.Counter
+	dbDuration          *prometheus.HistogramVec
+	redisDuration       *prometheus.HistogramVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by route, method and status code.",
+		}, []string{"method", "route", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by route, method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		validations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "validations_total",
+			Help:      "Coupon validation outcomes by operation, result and rejection reason.",
+		}, []string{"operation", "result", "reason"}),
+		discountIssued: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "discount_issued_amount",
+			Help:      "Discount amounts granted by redeemed coupons.",
+			Buckets:   []float64{10, 25, 50, 100, 250, 500, 1000, 2500, 5000},
+		}, []string{"discount_type"}),
+		rateLimitRejections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rate_limit_rejections_total",
+			Help:      "Requests rejected by the rate limiter, by limiter.",
+		}, []string{"limiter"}),
+		rateLimitErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rate_limit_errors_total",
+			Help:      "Requests let through because the per-IP rate limiter could not reach Redis.",
+		}),
+		dbDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "db_query_duration_seconds",
+			Help:      "Database call latency by operation and table.",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		}, []string{"operation", "table", "status"}),
+		redisDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "redis_command_duration_seconds",
+			Help:      "Redis call latency by command.",
+			Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25},
+		}, []string{"command", "status"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpDuration,
+		m.validations,
+		m.discountIssued,
+		m.rateLimitRejections,
+		m.rateLimitErrors,
+		m.dbDuration,
+		m.redisDuration,
+	)
+
+	return m
+}
+
+// RegisterDBStats exports the connection pool statistics of db.
+func (m *Metrics) RegisterDBStats(db *sql.DB, name string) error {
+	return m.registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// Registry exposes the registry so other components can add collectors.
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Middleware records request counts and latency labelled by the matched route
+// template rather than the raw path, keeping label cardinality bounded.
+func (m *Metrics) Middleware() gin.HandlerFunc {
+	if m == nil {
+		return func(c *gin.Context) { c.Next() }
+	}
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+
+		m.httpRequests.WithLabelValues(c.Request.Method, route, status).Inc()
+		m.httpDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// ObserveValidation records a validation decision. reason is empty for
+// accepted coupons.
+func (m *Metrics) ObserveValidation(operation string, valid bool, reason string) {
+	if m == nil {
+		return
+	}
+	result := "rejected"
+	if valid {
+		result = "accepted"
+	}
+	m.validations.WithLabelValues(operation, result, reason).Inc()
+}
+
+func (m *Metrics) ObserveDiscountIssued(discountType string, amount float64) {
+	if m == nil {
+		return
+	}
+	m.discountIssued.WithLabelValues(discountType).Observe(amount)
+}
+
+// ObserveRateLimitRejection counts a request rejected by the named limiter,
+// "ip" or "tenant".
+func (m *Metrics) ObserveRateLimitRejection(limiter string) {
+	if m == nil {
+		return
+	}
+	m.rateLimitRejections.WithLabelValues(limiter).Inc()
+}
+
+func (m *Metrics) ObserveRateLimitError() {
+	if m == nil {
+		return
+	}
+	m.rateLimitErrors.Inc()
+}
+
+func (m *Metrics) observeDB(operation, table string, err error, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	m.dbDuration.WithLabelValues(operation, table, statusLabel(err)).Observe(elapsed.Seconds())
+}
+
+func (m *Metrics) observeRedis(command string, err error, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	m.redisDuration.WithLabelValues(command, statusLabel(err)).Observe(elapsed.Seconds())
+}
+
+func statusLabel(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("should label requests by route template", func(t *testing.T) {
+		m := New()
+		router := gin.New()
+		router.Use(m.Middleware())
+		router.GET("/coupons/:code", func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+
+		for _, path := range []string{"/coupons/A", "/coupons/B", "/missing"} {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", path, nil)
+			router.ServeHTTP(w, req)
+		}
+
+		assert.Equal(t, 2.0, testutil.ToFloat64(m.httpRequests.WithLabelValues("GET", "/coupons/:code", "200")))
+		assert.Equal(t, 1.0, testutil.ToFloat64(m.httpRequests.WithLabelValues("GET", "unmatched", "404")))
+	})
+
+	t.Run("should record validation outcomes and expose them", func(t *testing.T) {
+		m := New()
+		m.ObserveValidation("validate", false, "expired")
+		m.ObserveValidation("validate", true, "")
+		m.ObserveRateLimitRejection("tenant")
+
+		assert.Equal(t, 1.0, testutil.ToFloat64(m.validations.WithLabelValues("validate", "rejected", "expired")))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/metrics", nil)
+		m.Handler().ServeHTTP(w, req)
+		assert.Contains(t, w.Body.String(), `coupon_validations_total{operation="validate",reason="expired",result="rejected"} 1`)
+		assert.Contains(t, w.Body.String(), `coupon_rate_limit_rejections_total{limiter="tenant"} 1`)
+	})
+
+	t.Run("should time database calls", func(t *testing.T) {
+		m := New()
+		db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		require.NoError(t, err)
+		require.NoError(t, m.InstrumentDB(db))
+
+		type widget struct {
+			ID   uint
+			Name string
+		}
+		require.NoError(t, db.AutoMigrate(&widget{}))
+		require.NoError(t, db.Create(&widget{Name: "a"}).Error)
+		var found widget
+		require.NoError(t, db.First(&found).Error)
+
+		count := testutil.CollectAndCount(m.dbDuration)
+		assert.GreaterOrEqual(t, count, 2)
+		out, err := testutil.GatherAndCount(m.registry, "coupon_db_query_duration_seconds")
+		require.NoError(t, err)
+		assert.Equal(t, count, out)
+	})
+
+	t.Run("should export database pool statistics", func(t *testing.T) {
+		m := New()
+		db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		require.NoError(t, err)
+		sqlDB, err := db.DB()
+		require.NoError(t, err)
+		require.NoError(t, m.RegisterDBStats(sqlDB, "coupon_system"))
+
+		count, err := testutil.GatherAndCount(m.registry, "go_sql_open_connections", "go_sql_max_open_connections")
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+	})
+
+	t.Run("should be safe to use without metrics", func(t *testing.T) {
+		var m *Metrics
+		assert.NotPanics(t, func() {
+			m.ObserveValidation("validate", true, "")
+			m.ObserveDiscountIssued("fixed", 10)
+			m.ObserveRateLimitRejection("tenant")
+		})
+
+		router := gin.New()
+		router.Use(m.Middleware())
+		router.GET("/coupons", func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/coupons", nil)
+		assert.NotPanics(t, func() { router.ServeHTTP(w, req) })
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
+
+func TestMetricNamesAreNamespaced(t *testing.T) {
+	m := New()
+	m.ObserveDiscountIssued("percentage", 42)
+
+	families, err := m.registry.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		name := family.GetName()
+		if strings.HasPrefix(name, "go_") || strings.HasPrefix(name, "process_") {
+			continue
+		}
+		assert.True(t, strings.HasPrefix(name, namespace+"_"), name)
+	}
+}
@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/farmako/coupon-system/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// PrincipalKey is the gin context key holding the authenticated *domain.Principal.
+	PrincipalKey = "principal"
+
+	apiKeyScheme = "ApiKey"
+	bearerScheme = "Bearer"
+)
+
+// TokenVerifier verifies bearer tokens issued to end users.
+type TokenVerifier interface {
+	Verify(ctx context.Context, token string) (*domain.Principal, error)
+}
+
+type Authenticator struct {
+	apiKeys service.APIKeyService
+	tokens  TokenVerifier
+}
+
+// NewAuthenticator builds an authenticator for API keys and, when tokens is
+// non-nil, bearer tokens.
+func NewAuthenticator(apiKeys service.APIKeyService, tokens TokenVerifier) *Authenticator {
+	return &Authenticator{apiKeys: apiKeys, tokens: tokens}
+}
+
+// Authenticate rejects requests without a valid "Authorization: ApiKey <key>"
+// or "Authorization: Bearer <jwt>" header and attaches the resolved principal
+// to the request.
+func (a *Authenticator) Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scheme, credentials, ok := strings.Cut(c.GetHeader("Authorization"), " ")
+		credentials = strings.TrimSpace(credentials)
+		if !ok || credentials == "" {
+			a.abortUnauthorized(c, "missing or malformed Authorization header")
+			return
+		}
+
+		var principal *domain.Principal
+		var err error
+		switch {
+		case strings.EqualFold(scheme, apiKeyScheme):
+			principal, err = a.apiKeys.Authenticate(c.Request.Context(), credentials)
+		case strings.EqualFold(scheme, bearerScheme) && a.tokens != nil:
+			principal, err = a.tokens.Verify(c.Request.Context(), credentials)
+		default:
+			a.abortUnauthorized(c, "unsupported authorization scheme")
+			return
+		}
+		if err != nil {
+			switch err.(type) {
+			case *domain.InvalidCredentialsError:
+				a.abortUnauthorized(c, err.Error())
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "authentication failed"})
+				c.Abort()
+			}
+			return
+		}
+
+		c.Set(PrincipalKey, principal)
+		c.Request = c.Request.WithContext(domain.ContextWithPrincipal(c.Request.Context(), principal))
+
+		c.Next()
+	}
+}
+
+// RequireScope rejects authenticated requests whose principal lacks scope.
+// It must run after Authenticate.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := GetPrincipal(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+			c.Abort()
+			return
+		}
+
+		if !principal.HasScope(scope) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":          "insufficient scope",
+				"required_scope": scope,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// GetPrincipal returns the principal attached by Authenticate.
+func GetPrincipal(c *gin.Context) (*domain.Principal, bool) {
+	value, ok := c.Get(PrincipalKey)
+	if !ok {
+		return nil, false
+	}
+	principal, ok := value.(*domain.Principal)
+	return principal, ok
+}
+
+func (a *Authenticator) abortUnauthorized(c *gin.Context, message string) {
+	if a.tokens != nil {
+		c.Header("WWW-Authenticate", apiKeyScheme+", "+bearerScheme)
+	} else {
+		c.Header("WWW-Authenticate", apiKeyScheme)
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": message})
+	c.Abort()
+}
@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockAPIKeyService struct {
+	mock.Mock
+}
+
+func (m *MockAPIKeyService) IssueKey(ctx context.Context, req domain.APIKeyRequest) (*domain.IssuedAPIKey, error) {
+	args := m.Called(ctx, req)
+	key, _ := args.Get(0).(*domain.IssuedAPIKey)
+	return key, args.Error(1)
+}
+
+func (m *MockAPIKeyService) RegisterKey(ctx context.Context, name, rawKey string, scopes []string) error {
+	args := m.Called(ctx, name, rawKey, scopes)
+	return args.Error(0)
+}
+
+func (m *MockAPIKeyService) ListKeys(ctx context.Context) ([]domain.APIKey, error) {
+	args := m.Called(ctx)
+	keys, _ := args.Get(0).([]domain.APIKey)
+	return keys, args.Error(1)
+}
+
+func (m *MockAPIKeyService) RevokeKey(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockAPIKeyService) Authenticate(ctx context.Context, rawKey string) (*domain.Principal, error) {
+	args := m.Called(ctx, rawKey)
+	principal, _ := args.Get(0).(*domain.Principal)
+	return principal, args.Error(1)
+}
+
+func TestAuthenticator(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := new(MockAPIKeyService)
+	mockService.On("Authenticate", mock.Anything, "fk_partner").Return(&domain.Principal{
+		ID:     "partner",
+		Type:   domain.PrincipalAPIKey,
+		Scopes: []string{domain.ScopeCouponsValidate},
+	}, nil)
+	mockService.On("Authenticate", mock.Anything, "fk_admin").Return(&domain.Principal{
+		ID:     "admin",
+		Type:   domain.PrincipalAPIKey,
+		Scopes: []string{domain.ScopeAdmin},
+	}, nil)
+	mockService.On("Authenticate", mock.Anything, "fk_revoked").Return(nil, &domain.InvalidCredentialsError{Reason: "api key has been revoked"})
+
+	authenticator := NewAuthenticator(mockService, nil)
+
+	router := gin.New()
+	router.Use(authenticator.Authenticate())
+	router.GET("/validate", RequireScope(domain.ScopeCouponsValidate), func(c *gin.Context) {
+		principal := domain.PrincipalFromContext(c.Request.Context())
+		c.String(http.StatusOK, principal.ID)
+	})
+	router.GET("/admin", RequireScope(domain.ScopeAdmin), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	serve := func(path, authorization string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("should reject requests without credentials", func(t *testing.T) {
+		w := serve("/validate", "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, "ApiKey", w.Header().Get("WWW-Authenticate"))
+	})
+
+	t.Run("should reject unsupported schemes", func(t *testing.T) {
+		w := serve("/validate", "Basic dXNlcjpwYXNz")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("should reject revoked keys", func(t *testing.T) {
+		w := serve("/validate", "ApiKey fk_revoked")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "revoked")
+	})
+
+	t.Run("should attach principal for valid keys", func(t *testing.T) {
+		w := serve("/validate", "ApiKey fk_partner")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "partner", w.Body.String())
+	})
+
+	t.Run("should forbid keys without the required scope", func(t *testing.T) {
+		w := serve("/admin", "ApiKey fk_partner")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), domain.ScopeAdmin)
+	})
+
+	t.Run("should treat admin scope as granting every scope", func(t *testing.T) {
+		w := serve("/validate", "ApiKey fk_admin")
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
+
+func TestRequireScopeWithRoles(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	serve := func(role domain.Role, scope string) int {
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			c.Set(PrincipalKey, &domain.Principal{ID: "someone", Role: role})
+		})
+		router.GET("/", RequireScope(scope), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/", nil)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve(domain.RoleViewer, domain.ScopeCouponsList))
+	assert.Equal(t, http.StatusForbidden, serve(domain.RoleViewer, domain.ScopeCouponsWrite))
+	assert.Equal(t, http.StatusOK, serve(domain.RoleMarketer, domain.ScopeCouponsWrite))
+	assert.Equal(t, http.StatusForbidden, serve(domain.RoleMarketer, domain.ScopeCouponsApprove))
+	assert.Equal(t, http.StatusOK, serve(domain.RoleAdmin, domain.ScopeCouponsApprove))
+	assert.Equal(t, http.StatusForbidden, serve("", domain.ScopeCouponsList))
+}
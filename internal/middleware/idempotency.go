@@ -0,0 +1,239 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	maxIdempotentBodyBytes    = 1 << 20
+	idempotencyKeyPrefix      = "idempotency:"
+	idempotencyFailureMessage = "idempotency check failed"
+)
+
+// IdempotentResponse is the stored outcome of the first request made with an
+// idempotency key. Status is 0 while that request is still being handled.
+type IdempotentResponse struct {
+	Fingerprint string `json:"fingerprint"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// IdempotencyStore keeps idempotent responses for a retention window.
+type IdempotencyStore interface {
+	// Claim records that a request with the given fingerprint has started
+	// under key, holding the claim for ttl. If the key is already taken it
+	// returns the stored response instead, and false.
+	Claim(ctx context.Context, key, fingerprint string, ttl time.Duration) (*IdempotentResponse, bool, error)
+	// Save stores the finished response for key.
+	Save(ctx context.Context, key string, response *IdempotentResponse, ttl time.Duration) error
+	// Release frees key so that the request can be retried.
+	Release(ctx context.Context, key string) error
+}
+
+// Idempotency replays the stored response when a request repeats the
+// Idempotency-Key of an earlier one from the same principal and tenant.
+// Reusing a key for a different request is rejected with 422, and a retry
+// that arrives while the first request is still running with 409. Server
+// errors are not stored, so such requests can be retried. Requests without
+// the header pass straight through. It must run after ResolveTenant.
+//
+// A request holds its key for lockTTL while it runs, so a key whose request
+// never finished, e.g. because the server crashed, frees up once that passes.
+// Finished responses are kept for ttl.
+func Idempotency(store IdempotencyStore, lockTTL, ttl time.Duration, logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idempotencyKey := c.GetHeader(IdempotencyKeyHeader)
+		if idempotencyKey == "" {
+			c.Next()
+			return
+		}
+		if len(idempotencyKey) > maxIdempotencyKeyLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key must be at most 255 characters"})
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxIdempotentBodyBytes))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body is too large"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		ctx := c.Request.Context()
+		key := idempotencyStoreKey(c, idempotencyKey)
+		fingerprint := requestFingerprint(c.Request, body)
+
+		stored, claimed, err := store.Claim(ctx, key, fingerprint, lockTTL)
+		if err != nil {
+			logger.ErrorContext(ctx, idempotencyFailureMessage, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": idempotencyFailureMessage})
+			c.Abort()
+			return
+		}
+		if !claimed {
+			switch {
+			case stored.Fingerprint != fingerprint:
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key has already been used for a different request"})
+			case stored.Status == 0:
+				c.JSON(http.StatusConflict, gin.H{"error": "a request with this Idempotency-Key is still being processed"})
+			default:
+				c.Header(IdempotentReplayedHeader, "true")
+				c.Data(stored.Status, stored.ContentType, stored.Body)
+			}
+			c.Abort()
+			return
+		}
+
+		// The request's own context may already be cancelled by the time the
+		// outcome is stored.
+		ctx = context.WithoutCancel(ctx)
+		release := func() {
+			if err := store.Release(ctx, key); err != nil {
+				logger.ErrorContext(ctx, "failed to release idempotency key", "error", err)
+			}
+		}
+		defer func() {
+			if r := recover(); r != nil {
+				release()
+				panic(r)
+			}
+		}()
+
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+
+		status := writer.Status()
+		if status >= http.StatusInternalServerError {
+			release()
+			return
+		}
+		response := &IdempotentResponse{
+			Fingerprint: fingerprint,
+			Status:      status,
+			ContentType: writer.Header().Get("Content-Type"),
+			Body:        writer.body.Bytes(),
+		}
+		if err := store.Save(ctx, key, response, ttl); err != nil {
+			logger.ErrorContext(ctx, "failed to save idempotent response", "error", err)
+		}
+	}
+}
+
+// idempotencyStoreKey scopes keys to the tenant and principal, so that callers
+// cannot replay each other's responses.
+func idempotencyStoreKey(c *gin.Context, idempotencyKey string) string {
+	principalID := ""
+	if principal, ok := GetPrincipal(c); ok {
+		principalID = principal.ID
+	}
+	return idempotencyKeyPrefix + domain.TenantFromContext(c.Request.Context()) + ":" + principalID + ":" + idempotencyKey
+}
+
+// requestFingerprint identifies a request by its method, path and body. JSON
+// bodies are compacted first, so that formatting differences do not count.
+func requestFingerprint(r *http.Request, body []byte) string {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, body); err == nil {
+		body = compact.Bytes()
+	}
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// recordingWriter keeps a copy of the response body.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// claimIdempotencyKey stores ARGV[1] under the key unless it is already set,
+// in which case it returns the stored value.
+var claimIdempotencyKey = redis.NewScript(`
+local existing = redis.call('GET', KEYS[1])
+if existing then
+	return existing
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return false
+`)
+
+type redisIdempotencyStore struct {
+	client *redis.Client
+}
+
+// NewRedisIdempotencyStore returns an IdempotencyStore that keeps responses in
+// Redis, which expires them after the retention window.
+func NewRedisIdempotencyStore(client *redis.Client) IdempotencyStore {
+	return &redisIdempotencyStore{client: client}
+}
+
+func (s *redisIdempotencyStore) Claim(ctx context.Context, key, fingerprint string, ttl time.Duration) (*IdempotentResponse, bool, error) {
+	pending, err := json.Marshal(IdempotentResponse{Fingerprint: fingerprint})
+	if err != nil {
+		return nil, false, err
+	}
+
+	existing, err := claimIdempotencyKey.Run(ctx, s.client, []string{key}, pending, ttl.Milliseconds()).Text()
+	if errors.Is(err, redis.Nil) {
+		return nil, true, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	var stored IdempotentResponse
+	if err := json.Unmarshal([]byte(existing), &stored); err != nil {
+		return nil, false, err
+	}
+	return &stored, false, nil
+}
+
+func (s *redisIdempotencyStore) Save(ctx context.Context, key string, response *IdempotentResponse, ttl time.Duration) error {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, key, data, ttl).Err()
+}
+
+func (s *redisIdempotencyStore) Release(ctx context.Context, key string) error {
+	return s.client.Del(ctx, key).Err()
+}
@@ -0,0 +1,158 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/farmako/coupon-system/internal/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeIdempotencyStore struct {
+	responses map[string]IdempotentResponse
+	expiries  map[string]time.Time
+	now       time.Time
+	// dropSaves simulates a server that dies before storing the response.
+	dropSaves bool
+}
+
+func newFakeIdempotencyStore() *fakeIdempotencyStore {
+	return &fakeIdempotencyStore{
+		responses: make(map[string]IdempotentResponse),
+		expiries:  make(map[string]time.Time),
+		now:       time.Now(),
+	}
+}
+
+func (s *fakeIdempotencyStore) Claim(ctx context.Context, key, fingerprint string, ttl time.Duration) (*IdempotentResponse, bool, error) {
+	if expiry, ok := s.expiries[key]; ok && !s.now.Before(expiry) {
+		s.Release(ctx, key)
+	}
+	if stored, ok := s.responses[key]; ok {
+		return &stored, false, nil
+	}
+	s.responses[key] = IdempotentResponse{Fingerprint: fingerprint}
+	s.expiries[key] = s.now.Add(ttl)
+	return nil, true, nil
+}
+
+func (s *fakeIdempotencyStore) Save(ctx context.Context, key string, response *IdempotentResponse, ttl time.Duration) error {
+	if s.dropSaves {
+		return nil
+	}
+	s.responses[key] = *response
+	s.expiries[key] = s.now.Add(ttl)
+	return nil
+}
+
+func (s *fakeIdempotencyStore) Release(ctx context.Context, key string) error {
+	delete(s.responses, key)
+	delete(s.expiries, key)
+	return nil
+}
+
+func TestIdempotency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := newFakeIdempotencyStore()
+	calls := 0
+	status := http.StatusOK
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set(PrincipalKey, &domain.Principal{ID: c.GetHeader("X-Principal")})
+	}, ResolveTenant(), Idempotency(store, time.Minute, time.Hour, logging.Discard()))
+	router.POST("/coupons/redeem", func(c *gin.Context) {
+		calls++
+		c.JSON(status, gin.H{"call": calls})
+	})
+
+	serve := func(key, principal, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/coupons/redeem", bytes.NewBufferString(body))
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		req.Header.Set("X-Principal", principal)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("replays the first response for a repeated key", func(t *testing.T) {
+		first := serve("key-1", "partner", `{"code": "SAVE10", "order_id": "order-1"}`)
+		assert.Equal(t, http.StatusOK, first.Code)
+		assert.Equal(t, `{"call":1}`, first.Body.String())
+
+		replay := serve("key-1", "partner", `{"code":"SAVE10","order_id":"order-1"}`)
+		assert.Equal(t, http.StatusOK, replay.Code)
+		assert.Equal(t, `{"call":1}`, replay.Body.String())
+		assert.Equal(t, "true", replay.Header().Get(IdempotentReplayedHeader))
+		assert.Equal(t, "application/json; charset=utf-8", replay.Header().Get("Content-Type"))
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("finished responses are kept for the retention window", func(t *testing.T) {
+		store.now = store.now.Add(30 * time.Minute)
+		w := serve("key-1", "partner", `{"code": "SAVE10", "order_id": "order-1"}`)
+		assert.Equal(t, "true", w.Header().Get(IdempotentReplayedHeader))
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("rejects a key reused for a different request", func(t *testing.T) {
+		w := serve("key-1", "partner", `{"code": "SAVE10", "order_id": "order-2"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("keys are scoped to the principal", func(t *testing.T) {
+		w := serve("key-1", "other-partner", `{"code": "SAVE10", "order_id": "order-1"}`)
+		assert.Equal(t, `{"call":2}`, w.Body.String())
+	})
+
+	t.Run("a request still in progress conflicts", func(t *testing.T) {
+		fingerprint := requestFingerprint(httptest.NewRequest("POST", "/coupons/redeem", nil), []byte(`{}`))
+		store.responses["idempotency:default:partner:key-2"] = IdempotentResponse{Fingerprint: fingerprint}
+		w := serve("key-2", "partner", `{}`)
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("a claim that is never saved expires after the lock TTL", func(t *testing.T) {
+		store.dropSaves = true
+		assert.Equal(t, http.StatusOK, serve("key-4", "partner", `{}`).Code)
+		store.dropSaves = false
+		assert.Equal(t, http.StatusConflict, serve("key-4", "partner", `{}`).Code)
+
+		store.now = store.now.Add(time.Minute)
+		w := serve("key-4", "partner", `{}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get(IdempotentReplayedHeader))
+	})
+
+	t.Run("server errors are not stored", func(t *testing.T) {
+		status = http.StatusInternalServerError
+		assert.Equal(t, http.StatusInternalServerError, serve("key-3", "partner", `{}`).Code)
+		status = http.StatusOK
+		w := serve("key-3", "partner", `{}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get(IdempotentReplayedHeader))
+	})
+
+	t.Run("rejects oversized bodies", func(t *testing.T) {
+		before := calls
+		w := serve("key-5", "partner", string(bytes.Repeat([]byte("x"), maxIdempotentBodyBytes+1)))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		assert.Equal(t, before, calls)
+	})
+
+	t.Run("requests without a key always run", func(t *testing.T) {
+		before := calls
+		serve("", "partner", `{}`)
+		serve("", "partner", `{}`)
+		assert.Equal(t, before+2, calls)
+	})
+}
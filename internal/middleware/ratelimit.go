@@ -1,10 +1,13 @@
 package middleware
 
 import (
+	"log/slog"
 	"net/http"
 	"strconv"
 	"time"
 
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/farmako/coupon-system/internal/metrics"
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
 )
@@ -13,51 +16,83 @@ type RateLimiter struct {
 	redisClient *redis.Client
 	limit       int
 	window      time.Duration
+	metrics     *metrics.Metrics
+	logger      *slog.Logger
 }
 
-func NewRateLimiter(redisClient *redis.Client, limit int, window time.Duration) *RateLimiter {
+func NewRateLimiter(redisClient *redis.Client, limit int, window time.Duration, metrics *metrics.Metrics, logger *slog.Logger) *RateLimiter {
 	return &RateLimiter{
 		redisClient: redisClient,
 		limit:       limit,
 		window:      window,
+		metrics:     metrics,
+		logger:      logger,
 	}
 }
 
+// RateLimit limits requests per tenant and client IP. It must run after
+// ResolveTenant.
 func (rl *RateLimiter) RateLimit() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		key := "rate_limit:" + c.ClientIP()
-		ctx := c.Request.Context()
+		tenant := domain.TenantFromContext(c.Request.Context())
+		rl.limitRequest(c, "rate_limit:tenant:"+tenant+":"+c.ClientIP(), "tenant", false)
+	}
+}
 
-		count, err := rl.redisClient.Get(ctx, key).Int()
-		if err != nil && err != redis.Nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "rate limit check failed"})
-			c.Abort()
-			return
-		}
+// RateLimitByIP limits requests per client IP alone. It runs before
+// authentication, so it also covers unauthenticated requests. It fails open:
+// while Redis is unavailable requests are let through.
+func (rl *RateLimiter) RateLimitByIP() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rl.limitRequest(c, "rate_limit:ip:"+c.ClientIP(), "ip", true)
+	}
+}
 
-		if count >= rl.limit {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error":       "rate limit exceeded",
-				"retry_after": rl.window.Seconds(),
-			})
-			c.Abort()
+// limitRequest counts the request under key and rejects it once the limit for
+// the window is reached. Rejections are counted against limiter. If Redis
+// fails, the request is let through when failOpen is set and rejected with
+// 500 otherwise.
+func (rl *RateLimiter) limitRequest(c *gin.Context, key, limiter string, failOpen bool) {
+	ctx := c.Request.Context()
+	failed := func(message string, err error) {
+		if failOpen {
+			rl.logger.WarnContext(ctx, message+"; allowing request", "error", err)
+			rl.metrics.ObserveRateLimitError()
+			c.Next()
 			return
 		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+		c.Abort()
+	}
 
-		pipe := rl.redisClient.Pipeline()
-		pipe.Incr(ctx, key)
-		pipe.Expire(ctx, key, rl.window)
-		_, err = pipe.Exec(ctx)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "rate limit update failed"})
-			c.Abort()
-			return
-		}
+	count, err := rl.redisClient.Get(ctx, key).Int()
+	if err != nil && err != redis.Nil {
+		failed("rate limit check failed", err)
+		return
+	}
 
-		c.Header("X-RateLimit-Limit", strconv.Itoa(rl.limit))
-		c.Header("X-RateLimit-Remaining", strconv.Itoa(rl.limit-count-1))
-		c.Header("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(rl.window).Unix(), 10))
+	if count >= rl.limit {
+		rl.metrics.ObserveRateLimitRejection(limiter)
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       "rate limit exceeded",
+			"retry_after": rl.window.Seconds(),
+		})
+		c.Abort()
+		return
+	}
 
-		c.Next()
+	pipe := rl.redisClient.Pipeline()
+	pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, rl.window)
+	_, err = pipe.Exec(ctx)
+	if err != nil {
+		failed("rate limit update failed", err)
+		return
 	}
+
+	c.Header("X-RateLimit-Limit", strconv.Itoa(rl.limit))
+	c.Header("X-RateLimit-Remaining", strconv.Itoa(rl.limit-count-1))
+	c.Header("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(rl.window).Unix(), 10))
+
+	c.Next()
 }
@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/farmako/coupon-system/internal/logging"
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
@@ -21,7 +22,7 @@ func TestRateLimiter(t *testing.T) {
 	redisClient.FlushAll(ctx)
 	defer redisClient.FlushAll(ctx)
 
-	limiter := NewRateLimiter(redisClient, 2, time.Second)
+	limiter := NewRateLimiter(redisClient, 2, time.Second, nil, logging.Discard())
 
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
@@ -65,3 +66,25 @@ func TestRateLimiter(t *testing.T) {
 		assert.Equal(t, "1", w.Header().Get("X-RateLimit-Remaining"))
 	})
 }
+
+func TestRateLimiterWithoutRedis(t *testing.T) {
+	redisClient := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer redisClient.Close()
+	limiter := NewRateLimiter(redisClient, 2, time.Second, nil, logging.Discard())
+
+	gin.SetMode(gin.TestMode)
+	serve := func(handler gin.HandlerFunc) int {
+		router := gin.New()
+		router.Use(handler)
+		router.GET("/test", func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/test", nil)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve(limiter.RateLimitByIP()), "the per-IP limit fails open")
+	assert.Equal(t, http.StatusInternalServerError, serve(limiter.RateLimit()))
+}
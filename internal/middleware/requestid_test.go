@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/farmako/coupon-system/internal/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newRouter := func(buf *bytes.Buffer) *gin.Engine {
+		logger, err := logging.New(buf, "json", "info")
+		require.NoError(t, err)
+
+		router := gin.New()
+		router.Use(RequestID(), AccessLog(logger))
+		router.GET("/test", func(c *gin.Context) {
+			logger.InfoContext(c.Request.Context(), "handled")
+			c.Status(http.StatusOK)
+		})
+		return router
+	}
+
+	tests := []struct {
+		name     string
+		incoming string
+		reused   bool
+	}{
+		{name: "should reuse a well-formed request ID", incoming: "req-123", reused: true},
+		{name: "should generate a request ID when missing", incoming: ""},
+		{name: "should replace a malformed request ID", incoming: "bad id\nwith newline"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			router := newRouter(&buf)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/test", nil)
+			if tt.incoming != "" {
+				req.Header.Set(RequestIDHeader, tt.incoming)
+			}
+			router.ServeHTTP(w, req)
+
+			requestID := w.Header().Get(RequestIDHeader)
+			require.NotEmpty(t, requestID)
+			if tt.reused {
+				assert.Equal(t, tt.incoming, requestID)
+			} else {
+				assert.NotEqual(t, tt.incoming, requestID)
+			}
+
+			decoder := json.NewDecoder(&buf)
+			var lines []map[string]any
+			for decoder.More() {
+				var line map[string]any
+				require.NoError(t, decoder.Decode(&line))
+				lines = append(lines, line)
+			}
+			require.Len(t, lines, 2)
+			assert.Equal(t, "handled", lines[0]["msg"])
+			assert.Equal(t, "request", lines[1]["msg"])
+			assert.Equal(t, float64(http.StatusOK), lines[1]["status"])
+			for _, line := range lines {
+				assert.Equal(t, requestID, line["request_id"])
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+const TenantHeader = "X-Tenant-ID"
+
+// ResolveTenant attaches the request's tenant to its context. Principals bound
+// to a tenant always act for that tenant and may only repeat it in the
+// X-Tenant-ID header; other callers select a tenant with the header and fall
+// back to domain.DefaultTenant. It must run after Authenticate.
+func ResolveTenant() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requested := c.GetHeader(TenantHeader)
+		if requested != "" && !domain.IsValidTenantID(requested) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + TenantHeader + " header"})
+			c.Abort()
+			return
+		}
+
+		tenantID := requested
+		if principal, ok := GetPrincipal(c); ok && principal.TenantID != "" {
+			if requested != "" && requested != principal.TenantID {
+				c.JSON(http.StatusForbidden, gin.H{"error": "principal is not allowed to act for tenant " + requested})
+				c.Abort()
+				return
+			}
+			tenantID = principal.TenantID
+		}
+		if tenantID == "" {
+			tenantID = domain.DefaultTenant
+		}
+
+		c.Header(TenantHeader, tenantID)
+		c.Request = c.Request.WithContext(domain.ContextWithTenant(c.Request.Context(), tenantID))
+
+		c.Next()
+	}
+}
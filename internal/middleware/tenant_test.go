@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveTenant(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	serve := func(principal *domain.Principal, header string) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			if principal != nil {
+				c.Set(PrincipalKey, principal)
+			}
+		}, ResolveTenant())
+		router.GET("/", func(c *gin.Context) {
+			c.String(http.StatusOK, domain.TenantFromContext(c.Request.Context()))
+		})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/", nil)
+		if header != "" {
+			req.Header.Set(TenantHeader, header)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("should fall back to the default tenant", func(t *testing.T) {
+		w := serve(&domain.Principal{ID: "platform"}, "")
+		assert.Equal(t, domain.DefaultTenant, w.Body.String())
+	})
+
+	t.Run("should let unbound principals pick a tenant", func(t *testing.T) {
+		w := serve(&domain.Principal{ID: "platform"}, "brand-a")
+		assert.Equal(t, "brand-a", w.Body.String())
+		assert.Equal(t, "brand-a", w.Header().Get(TenantHeader))
+	})
+
+	t.Run("should use the principal's tenant", func(t *testing.T) {
+		w := serve(&domain.Principal{ID: "partner", TenantID: "brand-b"}, "")
+		assert.Equal(t, "brand-b", w.Body.String())
+	})
+
+	t.Run("should forbid acting for another tenant", func(t *testing.T) {
+		w := serve(&domain.Principal{ID: "partner", TenantID: "brand-b"}, "brand-a")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("should reject malformed tenant ids", func(t *testing.T) {
+		w := serve(nil, "Brand A!")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// BlackoutRepository stores tenant-wide blackout periods, scoped to the tenant
+// carried by ctx.
+type BlackoutRepository interface {
+	FindAll(ctx context.Context) ([]domain.Blackout, error)
+	// FindActive returns the blackouts covering at.
+	FindActive(ctx context.Context, at time.Time) ([]domain.Blackout, error)
+	// FindEndingAfter returns the blackouts covering at or starting after it.
+	FindEndingAfter(ctx context.Context, at time.Time) ([]domain.Blackout, error)
+	Create(ctx context.Context, blackout *domain.Blackout) error
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+type blackoutRepository struct {
+	db *gorm.DB
+}
+
+func NewBlackoutRepository(db *gorm.DB) BlackoutRepository {
+	return &blackoutRepository{db: db}
+}
+
+func (r *blackoutRepository) FindAll(ctx context.Context) ([]domain.Blackout, error) {
+	var blackouts []domain.Blackout
+	if err := r.scoped(ctx).Order("starts_at").Find(&blackouts).Error; err != nil {
+		return nil, err
+	}
+	return blackouts, nil
+}
+
+func (r *blackoutRepository) FindActive(ctx context.Context, at time.Time) ([]domain.Blackout, error) {
+	ctx, span := tracer.Start(ctx, "blackoutRepository.FindActive")
+	defer span.End()
+
+	var blackouts []domain.Blackout
+	err := r.scoped(ctx).
+		Where("starts_at <= ? AND ends_at > ?", at, at).
+		Order("ends_at DESC").
+		Find(&blackouts).Error
+	if err != nil {
+		return nil, err
+	}
+	return blackouts, nil
+}
+
+func (r *blackoutRepository) FindEndingAfter(ctx context.Context, at time.Time) ([]domain.Blackout, error) {
+	ctx, span := tracer.Start(ctx, "blackoutRepository.FindEndingAfter")
+	defer span.End()
+
+	var blackouts []domain.Blackout
+	err := r.scoped(ctx).
+		Where("ends_at > ?", at).
+		Order("starts_at").
+		Find(&blackouts).Error
+	if err != nil {
+		return nil, err
+	}
+	return blackouts, nil
+}
+
+func (r *blackoutRepository) Create(ctx context.Context, blackout *domain.Blackout) error {
+	blackout.TenantID = domain.TenantFromContext(ctx)
+	return r.db.WithContext(ctx).Create(blackout).Error
+}
+
+func (r *blackoutRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	result := r.scoped(ctx).Where("id = ?", id).Delete(&domain.Blackout{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &domain.BlackoutNotFoundError{ID: id}
+	}
+	return nil
+}
+
+func (r *blackoutRepository) scoped(ctx context.Context) *gorm.DB {
+	return r.db.WithContext(ctx).Where("tenant_id = ?", domain.TenantFromContext(ctx))
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestBlackoutRepository(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&domain.Blackout{}))
+	repo := NewBlackoutRepository(db)
+
+	ctx := context.Background()
+	now := time.Now()
+	for _, period := range []domain.BlackoutPeriod{
+		{Name: "past", StartsAt: now.Add(-48 * time.Hour), EndsAt: now.Add(-24 * time.Hour)},
+		{Name: "current", StartsAt: now.Add(-time.Hour), EndsAt: now.Add(time.Hour)},
+		{Name: "future", StartsAt: now.Add(24 * time.Hour), EndsAt: now.Add(48 * time.Hour)},
+	} {
+		require.NoError(t, repo.Create(ctx, &domain.Blackout{ID: uuid.New(), BlackoutPeriod: period}))
+	}
+
+	active, err := repo.FindActive(ctx, now)
+	require.NoError(t, err)
+	require.Len(t, active, 1)
+	assert.Equal(t, "current", active[0].Name)
+
+	current, err := repo.FindEndingAfter(ctx, now)
+	require.NoError(t, err)
+	require.Len(t, current, 2)
+	assert.Equal(t, "current", current[0].Name)
+	assert.Equal(t, "future", current[1].Name)
+
+	other, err := repo.FindActive(domain.ContextWithTenant(ctx, "other"), now)
+	require.NoError(t, err)
+	assert.Empty(t, other)
+
+	require.NoError(t, repo.Delete(ctx, active[0].ID))
+	assert.IsType(t, &domain.BlackoutNotFoundError{}, repo.Delete(ctx, active[0].ID))
+
+	all, err := repo.FindAll(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assert.Equal(t, "past", all[0].Name)
+}
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// CampaignRepository stores campaigns, scoped to the tenant carried by ctx.
+type CampaignRepository interface {
+	FindByID(ctx context.Context, id uuid.UUID) (*domain.Campaign, error)
+	FindByName(ctx context.Context, name string) (*domain.Campaign, error)
+	FindAll(ctx context.Context) ([]domain.Campaign, error)
+	Create(ctx context.Context, campaign *domain.Campaign) error
+	// Update saves an existing campaign, except for its generated code count.
+	// It returns CampaignNotFoundError if the campaign is not in the tenant.
+	Update(ctx context.Context, campaign *domain.Campaign) error
+	// AddCodes inserts coupons generated for the campaign and adds them to its
+	// code count within one transaction, then refreshes campaign.CodesGenerated.
+	AddCodes(ctx context.Context, campaign *domain.Campaign, coupons []domain.Coupon) error
+}
+
+type campaignRepository struct {
+	db *gorm.DB
+}
+
+func NewCampaignRepository(db *gorm.DB) CampaignRepository {
+	return &campaignRepository{db: db}
+}
+
+func (r *campaignRepository) FindByID(ctx context.Context, id uuid.UUID) (*domain.Campaign, error) {
+	ctx, span := tracer.Start(ctx, "campaignRepository.FindByID")
+	defer span.End()
+
+	var campaign domain.Campaign
+	if err := r.scoped(ctx).Where("id = ?", id).First(&campaign).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &domain.CampaignNotFoundError{ID: id}
+		}
+		return nil, err
+	}
+	return &campaign, nil
+}
+
+// FindByName returns nil without an error when no campaign has the name.
+func (r *campaignRepository) FindByName(ctx context.Context, name string) (*domain.Campaign, error) {
+	ctx, span := tracer.Start(ctx, "campaignRepository.FindByName")
+	defer span.End()
+
+	var campaign domain.Campaign
+	if err := r.scoped(ctx).Where("name = ?", name).First(&campaign).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &campaign, nil
+}
+
+func (r *campaignRepository) FindAll(ctx context.Context) ([]domain.Campaign, error) {
+	ctx, span := tracer.Start(ctx, "campaignRepository.FindAll")
+	defer span.End()
+
+	var campaigns []domain.Campaign
+	if err := r.scoped(ctx).Order("created_at DESC").Find(&campaigns).Error; err != nil {
+		return nil, err
+	}
+	return campaigns, nil
+}
+
+func (r *campaignRepository) Create(ctx context.Context, campaign *domain.Campaign) error {
+	ctx, span := tracer.Start(ctx, "campaignRepository.Create")
+	defer span.End()
+
+	campaign.TenantID = domain.TenantFromContext(ctx)
+	return r.db.WithContext(ctx).Create(campaign).Error
+}
+
+func (r *campaignRepository) Update(ctx context.Context, campaign *domain.Campaign) error {
+	ctx, span := tracer.Start(ctx, "campaignRepository.Update")
+	defer span.End()
+
+	campaign.TenantID = domain.TenantFromContext(ctx)
+	// The code count only changes through AddCodes, so a stale copy of the
+	// campaign cannot undo codes generated since it was read.
+	result := r.scoped(ctx).
+		Model(campaign).
+		Select("*").
+		Omit("id", "tenant_id", "created_at", "codes_generated").
+		Updates(campaign)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &domain.CampaignNotFoundError{ID: campaign.ID}
+	}
+	return nil
+}
+
+func (r *campaignRepository) AddCodes(ctx context.Context, campaign *domain.Campaign, coupons []domain.Coupon) error {
+	ctx, span := tracer.Start(ctx, "campaignRepository.AddCodes", trace.WithAttributes(attribute.Int("coupon.count", len(coupons))))
+	defer span.End()
+
+	tenantID := domain.TenantFromContext(ctx)
+	for i := range coupons {
+		coupons[i].TenantID = tenantID
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&domain.Campaign{}).
+			Where("tenant_id = ? AND id = ?", tenantID, campaign.ID).
+			UpdateColumn("codes_generated", gorm.Expr("codes_generated + ?", len(coupons)))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return &domain.CampaignNotFoundError{ID: campaign.ID}
+		}
+		if err := tx.CreateInBatches(coupons, len(coupons)).Error; err != nil {
+			return err
+		}
+		return tx.Model(&domain.Campaign{}).
+			Select("codes_generated").
+			Where("id = ?", campaign.ID).
+			Scan(&campaign.CodesGenerated).Error
+	})
+}
+
+func (r *campaignRepository) scoped(ctx context.Context) *gorm.DB {
+	return r.db.WithContext(ctx).Where("tenant_id = ?", domain.TenantFromContext(ctx))
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestCampaignRepository(t *testing.T) (CampaignRepository, CouponRepository) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&domain.Campaign{}, &domain.Coupon{}))
+	return NewCampaignRepository(db), NewCouponRepository(db)
+}
+
+func TestCampaignCodes(t *testing.T) {
+	ctx := context.Background()
+	campaigns, coupons := newTestCampaignRepository(t)
+
+	campaign := &domain.Campaign{
+		ID:            uuid.New(),
+		Name:          "summer",
+		DiscountType:  domain.Percentage,
+		DiscountValue: domain.MoneyFromInt(10),
+		ExpiryDate:    time.Now().Add(24 * time.Hour),
+	}
+	require.NoError(t, campaigns.Create(ctx, campaign))
+
+	stale, err := campaigns.FindByID(ctx, campaign.ID)
+	require.NoError(t, err)
+
+	batch := []domain.Coupon{campaign.NewCoupon("SUM-1"), campaign.NewCoupon("SUM-2")}
+	for i := range batch {
+		batch[i].ID = uuid.New()
+	}
+	require.NoError(t, campaigns.AddCodes(ctx, campaign, batch))
+	assert.Equal(t, 2, campaign.CodesGenerated)
+
+	codes, err := coupons.CodesByCampaign(ctx, campaign.ID)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"SUM-1", "SUM-2"}, codes)
+
+	// Saving a copy read before the codes were generated keeps the count.
+	stale.TermsAndConditions = "One per customer"
+	require.NoError(t, campaigns.Update(ctx, stale))
+
+	stored, err := campaigns.FindByID(ctx, campaign.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "One per customer", stored.TermsAndConditions)
+	assert.Equal(t, 2, stored.CodesGenerated)
+}
+
+func TestCampaignUpdateNotFound(t *testing.T) {
+	ctx := context.Background()
+	campaigns, coupons := newTestCampaignRepository(t)
+
+	campaign := &domain.Campaign{
+		ID:         uuid.New(),
+		Name:       "summer",
+		ExpiryDate: time.Now().Add(24 * time.Hour),
+	}
+	require.NoError(t, campaigns.Create(ctx, campaign))
+	otherTenant := domain.ContextWithTenant(ctx, "other")
+
+	t.Run("a missing campaign is not created", func(t *testing.T) {
+		missing := *campaign
+		missing.ID = uuid.New()
+		missing.Name = "missing"
+
+		var notFound *domain.CampaignNotFoundError
+		assert.ErrorAs(t, campaigns.Update(ctx, &missing), &notFound)
+		_, err := campaigns.FindByID(ctx, missing.ID)
+		assert.ErrorAs(t, err, &notFound)
+	})
+
+	t.Run("another tenant's campaign is not overwritten", func(t *testing.T) {
+		hijack := *campaign
+		hijack.Name = "hijacked"
+
+		var notFound *domain.CampaignNotFoundError
+		assert.ErrorAs(t, campaigns.Update(otherTenant, &hijack), &notFound)
+
+		stored, err := campaigns.FindByID(ctx, campaign.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "summer", stored.Name)
+	})
+
+	t.Run("codes are not added to another tenant's campaign", func(t *testing.T) {
+		batch := []domain.Coupon{campaign.NewCoupon("HIJACK")}
+		batch[0].ID = uuid.New()
+
+		var notFound *domain.CampaignNotFoundError
+		assert.ErrorAs(t, campaigns.AddCodes(otherTenant, campaign, batch), &notFound)
+
+		codes, err := coupons.CodesByCampaign(otherTenant, campaign.ID)
+		require.NoError(t, err)
+		assert.Empty(t, codes)
+	})
+}
@@ -2,16 +2,38 @@ package repository
 
 import (
 	"context"
+	"errors"
 
 	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/farmako/coupon-system/internal/tracing"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
 )
 
+var tracer = otel.Tracer("github.com/farmako/coupon-system/internal/repository")
+
+// CouponRepository stores coupons. Every method is scoped to the tenant carried
+// by ctx, so codes only need to be unique within a tenant.
 type CouponRepository interface {
 	FindByCode(ctx context.Context, code string) (*domain.Coupon, error)
 	FindAll(ctx context.Context) ([]domain.Coupon, error)
+	// List returns one page of coupons matching the query.
+	List(ctx context.Context, query CouponQuery) (*CouponPage, error)
 	Create(ctx context.Context, coupon *domain.Coupon) error
+	// CreateBatch inserts coupons in batches of batchSize within one transaction.
+	CreateBatch(ctx context.Context, coupons []domain.Coupon, batchSize int) error
+	// ExistingCodes returns the subset of codes that are already taken.
+	ExistingCodes(ctx context.Context, codes []string) ([]string, error)
+	// CodesByCampaign returns the codes generated for a campaign, oldest first.
+	CodesByCampaign(ctx context.Context, campaignID uuid.UUID) ([]string, error)
+	// Update saves an existing coupon, except for its usage counters. It
+	// returns CouponNotFoundError if the coupon is not in the tenant.
 	Update(ctx context.Context, coupon *domain.Coupon) error
+	// AddUsage adds to the coupon's redemption count and discount spent.
+	AddUsage(ctx context.Context, id uuid.UUID, redemptions int, discount domain.Money) error
 	Delete(ctx context.Context, code string) error
 }
 
@@ -24,29 +46,116 @@ func NewCouponRepository(db *gorm.DB) CouponRepository {
 }
 
 func (r *couponRepository) FindByCode(ctx context.Context, code string) (*domain.Coupon, error) {
+	ctx, span := tracer.Start(ctx, "couponRepository.FindByCode", trace.WithAttributes(tracing.CouponCode(code)))
+	defer span.End()
+
 	var coupon domain.Coupon
-	if err := r.db.Where("code = ?", code).First(&coupon).Error; err != nil {
+	if err := r.scoped(ctx).Where("code = ?", code).First(&coupon).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &domain.CouponNotFoundError{Code: code}
+		}
 		return nil, err
 	}
 	return &coupon, nil
 }
 
 func (r *couponRepository) FindAll(ctx context.Context) ([]domain.Coupon, error) {
+	ctx, span := tracer.Start(ctx, "couponRepository.FindAll")
+	defer span.End()
+
 	var coupons []domain.Coupon
-	if err := r.db.Find(&coupons).Error; err != nil {
+	if err := r.scoped(ctx).Find(&coupons).Error; err != nil {
 		return nil, err
 	}
 	return coupons, nil
 }
 
 func (r *couponRepository) Create(ctx context.Context, coupon *domain.Coupon) error {
-	return r.db.Create(coupon).Error
+	ctx, span := tracer.Start(ctx, "couponRepository.Create", trace.WithAttributes(tracing.CouponCode(coupon.Code)))
+	defer span.End()
+
+	coupon.TenantID = domain.TenantFromContext(ctx)
+	return r.db.WithContext(ctx).Create(coupon).Error
+}
+
+func (r *couponRepository) CreateBatch(ctx context.Context, coupons []domain.Coupon, batchSize int) error {
+	ctx, span := tracer.Start(ctx, "couponRepository.CreateBatch", trace.WithAttributes(attribute.Int("coupon.count", len(coupons))))
+	defer span.End()
+
+	tenantID := domain.TenantFromContext(ctx)
+	for i := range coupons {
+		coupons[i].TenantID = tenantID
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return tx.CreateInBatches(coupons, batchSize).Error
+	})
+}
+
+func (r *couponRepository) ExistingCodes(ctx context.Context, codes []string) ([]string, error) {
+	ctx, span := tracer.Start(ctx, "couponRepository.ExistingCodes")
+	defer span.End()
+
+	var existing []string
+	err := r.scoped(ctx).Model(&domain.Coupon{}).Where("code IN ?", codes).Pluck("code", &existing).Error
+	return existing, err
+}
+
+func (r *couponRepository) CodesByCampaign(ctx context.Context, campaignID uuid.UUID) ([]string, error) {
+	ctx, span := tracer.Start(ctx, "couponRepository.CodesByCampaign")
+	defer span.End()
+
+	var codes []string
+	err := r.scoped(ctx).
+		Model(&domain.Coupon{}).
+		Where("campaign_id = ?", campaignID).
+		Order("created_at, code").
+		Pluck("code", &codes).Error
+	return codes, err
 }
 
 func (r *couponRepository) Update(ctx context.Context, coupon *domain.Coupon) error {
-	return r.db.Save(coupon).Error
+	ctx, span := tracer.Start(ctx, "couponRepository.Update", trace.WithAttributes(tracing.CouponCode(coupon.Code)))
+	defer span.End()
+
+	coupon.TenantID = domain.TenantFromContext(ctx)
+	// The usage counters only change through AddUsage, so a stale copy of
+	// the coupon cannot overwrite redemptions made since it was read. Unlike
+	// Save, Updates never inserts, so a coupon that was deleted or belongs to
+	// another tenant is not written.
+	result := r.scoped(ctx).
+		Model(coupon).
+		Select("*").
+		Omit("id", "tenant_id", "created_at", "redemption_count", "discount_spent").
+		Updates(coupon)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &domain.CouponNotFoundError{Code: coupon.Code}
+	}
+	return nil
+}
+
+func (r *couponRepository) AddUsage(ctx context.Context, id uuid.UUID, redemptions int, discount domain.Money) error {
+	ctx, span := tracer.Start(ctx, "couponRepository.AddUsage")
+	defer span.End()
+
+	return r.scoped(ctx).
+		Model(&domain.Coupon{}).
+		Where("id = ?", id).
+		UpdateColumns(map[string]any{
+			"redemption_count": gorm.Expr("redemption_count + ?", redemptions),
+			"discount_spent":   gorm.Expr("discount_spent + ?", discount),
+		}).Error
 }
 
 func (r *couponRepository) Delete(ctx context.Context, code string) error {
-	return r.db.Where("code = ?", code).Delete(&domain.Coupon{}).Error
+	ctx, span := tracer.Start(ctx, "couponRepository.Delete", trace.WithAttributes(tracing.CouponCode(code)))
+	defer span.End()
+
+	return r.scoped(ctx).Where("code = ?", code).Delete(&domain.Coupon{}).Error
+}
+
+func (r *couponRepository) scoped(ctx context.Context) *gorm.DB {
+	return r.db.WithContext(ctx).Where("tenant_id = ?", domain.TenantFromContext(ctx))
 }
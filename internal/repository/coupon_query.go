@@ -0,0 +1,278 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Fields List can sort on.
+const (
+	SortByCreatedAt     = "created_at"
+	SortByCode          = "code"
+	SortByExpiryDate    = "expiry_date"
+	SortByDiscountValue = "discount_value"
+)
+
+const (
+	DefaultCouponPageSize = 50
+	MaxCouponPageSize     = 200
+)
+
+// CouponFilter narrows List. Empty fields match everything.
+type CouponFilter struct {
+	Status       domain.CouponStatus
+	UsageType    domain.UsageType
+	DiscountType domain.DiscountType
+	// Category and MedicineID match coupons that apply to them, including
+	// coupons that are not restricted to any category or medicine.
+	Category      string
+	MedicineID    string
+	ExpiresAfter  *time.Time
+	ExpiresBefore *time.Time
+	// CodePrefix matches the start of the code, ignoring case.
+	CodePrefix string
+}
+
+// CouponQuery selects one page of coupons. Cursor is the NextCursor of the
+// previous page, and must be used with the same sort.
+type CouponQuery struct {
+	Filter     CouponFilter
+	SortBy     string
+	Descending bool
+	Limit      int
+	Cursor     string
+}
+
+// CouponPage is one page of List results. NextCursor is empty on the last page.
+type CouponPage struct {
+	Coupons    []domain.Coupon `json:"coupons"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// couponCursor records where a page ended: the sort value and ID of its last
+// coupon, plus the sort it was produced with.
+type couponCursor struct {
+	SortBy     string          `json:"s"`
+	Descending bool            `json:"d"`
+	Value      json.RawMessage `json:"v"`
+	ID         uuid.UUID       `json:"id"`
+}
+
+func (r *couponRepository) List(ctx context.Context, query CouponQuery) (*CouponPage, error) {
+	ctx, span := tracer.Start(ctx, "couponRepository.List")
+	defer span.End()
+
+	if err := normalizeCouponQuery(&query); err != nil {
+		return nil, err
+	}
+
+	db := applyCouponFilter(r.scoped(ctx), query.Filter, time.Now())
+
+	direction := "ASC"
+	if query.Descending {
+		direction = "DESC"
+	}
+	if query.Cursor != "" {
+		cursor, value, err := decodeCouponCursor(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.SortBy != query.SortBy || cursor.Descending != query.Descending {
+			return nil, &domain.InvalidRequestError{Reason: "cursor was issued for a different sort"}
+		}
+		op := ">"
+		if query.Descending {
+			op = "<"
+		}
+		db = db.Where(
+			fmt.Sprintf("(%[1]s %[2]s ?) OR (%[1]s = ? AND id %[2]s ?)", query.SortBy, op),
+			value, value, cursor.ID,
+		)
+	}
+
+	var coupons []domain.Coupon
+	err := db.
+		Order(query.SortBy + " " + direction).
+		Order("id " + direction).
+		Limit(query.Limit + 1).
+		Find(&coupons).Error
+	if err != nil {
+		return nil, err
+	}
+
+	page := &CouponPage{Coupons: coupons}
+	if len(coupons) > query.Limit {
+		page.Coupons = coupons[:query.Limit]
+		page.NextCursor, err = encodeCouponCursor(query, &page.Coupons[query.Limit-1])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
+
+func normalizeCouponQuery(query *CouponQuery) error {
+	switch query.SortBy {
+	case "":
+		query.SortBy = SortByCreatedAt
+	case SortByCreatedAt, SortByCode, SortByExpiryDate, SortByDiscountValue:
+	default:
+		return &domain.InvalidRequestError{Reason: fmt.Sprintf("cannot sort by %q", query.SortBy)}
+	}
+
+	switch {
+	case query.Limit == 0:
+		query.Limit = DefaultCouponPageSize
+	case query.Limit < 0 || query.Limit > MaxCouponPageSize:
+		return &domain.InvalidRequestError{Reason: fmt.Sprintf("limit must be between 1 and %d", MaxCouponPageSize)}
+	}
+
+	if query.Filter.Status != "" && !slices.Contains(domain.CouponStatuses, query.Filter.Status) {
+		return &domain.InvalidRequestError{Reason: fmt.Sprintf("invalid status %q", query.Filter.Status)}
+	}
+	return nil
+}
+
+func applyCouponFilter(db *gorm.DB, filter CouponFilter, now time.Time) *gorm.DB {
+	if filter.Status != "" {
+		db = whereStatus(db, filter.Status, now)
+	}
+
+	if filter.UsageType != "" {
+		db = db.Where("usage_type = ?", filter.UsageType)
+	}
+	if filter.DiscountType != "" {
+		db = db.Where("discount_type = ?", filter.DiscountType)
+	}
+	if filter.Category != "" {
+		db = db.Where("(? = ANY(applicable_categories) OR COALESCE(cardinality(applicable_categories), 0) = 0)", filter.Category)
+	}
+	if filter.MedicineID != "" {
+		db = db.Where("(? = ANY(applicable_medicine_ids) OR COALESCE(cardinality(applicable_medicine_ids), 0) = 0)", filter.MedicineID)
+	}
+	if filter.ExpiresAfter != nil {
+		db = db.Where("expiry_date >= ?", *filter.ExpiresAfter)
+	}
+	if filter.ExpiresBefore != nil {
+		db = db.Where("expiry_date < ?", *filter.ExpiresBefore)
+	}
+	if filter.CodePrefix != "" {
+		db = db.Where(`LOWER(code) LIKE ? ESCAPE '\'`, escapeLike(strings.ToLower(filter.CodePrefix))+"%")
+	}
+	return db
+}
+
+// whereStatus matches coupons whose Status at now is status, checking the
+// conditions in the same order as domain.Coupon.Status.
+func whereStatus(db *gorm.DB, status domain.CouponStatus, now time.Time) *gorm.DB {
+	if status == domain.StatusDraft {
+		return db.Where("draft = ?", true)
+	}
+	db = db.Where("draft = ?", false)
+
+	pending := "COALESCE(approval_status, '') = ?"
+	if status == domain.StatusPendingApproval {
+		return db.Where(pending, domain.PendingApproval)
+	}
+	db = db.Not(pending, domain.PendingApproval)
+
+	if status == domain.StatusPaused {
+		return db.Where("paused = ?", true)
+	}
+	db = db.Where("paused = ?", false)
+
+	exhausted := "((max_total_usage > 0 AND redemption_count >= max_total_usage) OR (budget > 0 AND discount_spent >= budget))"
+	if status == domain.StatusExhausted {
+		return db.Where(exhausted)
+	}
+	db = db.Not(exhausted)
+
+	if status == domain.StatusExpired {
+		return db.Where("expiry_date < ?", now)
+	}
+	db = db.Where("expiry_date >= ?", now)
+
+	if status == domain.StatusScheduled {
+		return db.Where("start_date > ?", now)
+	}
+	return db.Where("(start_date IS NULL OR start_date <= ?)", now)
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func encodeCouponCursor(query CouponQuery, last *domain.Coupon) (string, error) {
+	var value any
+	switch query.SortBy {
+	case SortByCode:
+		value = last.Code
+	case SortByExpiryDate:
+		value = last.ExpiryDate
+	case SortByDiscountValue:
+		value = last.DiscountValue
+	default:
+		value = last.CreatedAt
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(couponCursor{
+		SortBy:     query.SortBy,
+		Descending: query.Descending,
+		Value:      raw,
+		ID:         last.ID,
+	})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCouponCursor returns the cursor and its sort value as the Go type of
+// the sorted column.
+func decodeCouponCursor(encoded string) (*couponCursor, any, error) {
+	invalid := &domain.InvalidRequestError{Reason: "invalid cursor"}
+
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, nil, invalid
+	}
+	var cursor couponCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, nil, invalid
+	}
+
+	var value any
+	switch cursor.SortBy {
+	case SortByCode:
+		var code string
+		err = json.Unmarshal(cursor.Value, &code)
+		value = code
+	case SortByDiscountValue:
+		var discount domain.Money
+		err = json.Unmarshal(cursor.Value, &discount)
+		value = discount
+	case SortByCreatedAt, SortByExpiryDate:
+		var t time.Time
+		err = json.Unmarshal(cursor.Value, &t)
+		value = t
+	default:
+		return nil, nil, invalid
+	}
+	if err != nil {
+		return nil, nil, invalid
+	}
+	return &cursor, value, nil
+}
@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestCouponRepository(t *testing.T) CouponRepository {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&domain.Coupon{}))
+	return NewCouponRepository(db)
+}
+
+func codes(coupons []domain.Coupon) []string {
+	result := make([]string, len(coupons))
+	for i, coupon := range coupons {
+		result[i] = coupon.Code
+	}
+	return result
+}
+
+// The category and medicine filters rely on Postgres arrays and are not
+// covered here.
+func TestCouponList(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestCouponRepository(t)
+	now := time.Now()
+	nextWeek := now.Add(7 * 24 * time.Hour)
+
+	for _, coupon := range []domain.Coupon{
+		{Code: "SUMMER10", DiscountType: domain.Percentage, DiscountValue: domain.MoneyFromInt(10), UsageType: domain.MultiUse, ExpiryDate: now.Add(48 * time.Hour)},
+		{Code: "SUMMER20", DiscountType: domain.Percentage, DiscountValue: domain.MoneyFromInt(20), UsageType: domain.OneTime, ExpiryDate: now.Add(24 * time.Hour)},
+		{Code: "summer_50", DiscountType: domain.Fixed, DiscountValue: domain.MoneyFromInt(50), UsageType: domain.MultiUse, ExpiryDate: now.Add(72 * time.Hour), Paused: true},
+		{Code: "WINTER15", DiscountType: domain.Percentage, DiscountValue: domain.MoneyFromInt(15), UsageType: domain.MultiUse, ExpiryDate: now.Add(-time.Hour)},
+		{Code: "BIG80", DiscountType: domain.Percentage, DiscountValue: domain.MoneyFromInt(80), UsageType: domain.MultiUse, ExpiryDate: now.Add(96 * time.Hour), ApprovalStatus: domain.PendingApproval},
+		{Code: "SPRING25", DiscountType: domain.Percentage, DiscountValue: domain.MoneyFromInt(25), UsageType: domain.MultiUse, StartDate: &nextWeek, ExpiryDate: now.Add(30 * 24 * time.Hour)},
+		{Code: "AUTUMN5", DiscountType: domain.Fixed, DiscountValue: domain.MoneyFromInt(5), UsageType: domain.MultiUse, ExpiryDate: now.Add(-time.Hour), Draft: true},
+	} {
+		coupon.ID = uuid.New()
+		require.NoError(t, repo.Create(ctx, &coupon))
+	}
+
+	t.Run("should page through every coupon with a cursor", func(t *testing.T) {
+		var seen []string
+		query := CouponQuery{SortBy: SortByCode, Limit: 2}
+		for pages := 0; ; pages++ {
+			require.Less(t, pages, 5)
+			page, err := repo.List(ctx, query)
+			require.NoError(t, err)
+			seen = append(seen, codes(page.Coupons)...)
+			if page.NextCursor == "" {
+				break
+			}
+			query.Cursor = page.NextCursor
+		}
+		assert.Equal(t, []string{"AUTUMN5", "BIG80", "SPRING25", "SUMMER10", "SUMMER20", "WINTER15", "summer_50"}, seen)
+	})
+
+	t.Run("should page newest first by default", func(t *testing.T) {
+		query := CouponQuery{Descending: true, Limit: 4}
+		page, err := repo.List(ctx, query)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"AUTUMN5", "SPRING25", "BIG80", "WINTER15"}, codes(page.Coupons))
+
+		query.Cursor = page.NextCursor
+		page, err = repo.List(ctx, query)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"summer_50", "SUMMER20", "SUMMER10"}, codes(page.Coupons))
+		assert.Empty(t, page.NextCursor)
+	})
+
+	t.Run("should sort descending", func(t *testing.T) {
+		page, err := repo.List(ctx, CouponQuery{SortBy: SortByDiscountValue, Descending: true, Limit: 2})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"BIG80", "summer_50"}, codes(page.Coupons))
+
+		page, err = repo.List(ctx, CouponQuery{SortBy: SortByDiscountValue, Descending: true, Limit: 2, Cursor: page.NextCursor})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"SPRING25", "SUMMER20"}, codes(page.Coupons))
+	})
+
+	t.Run("should filter", func(t *testing.T) {
+		tomorrow := now.Add(30 * time.Hour)
+		tests := []struct {
+			name   string
+			filter CouponFilter
+			want   []string
+		}{
+			{name: "active", filter: CouponFilter{Status: domain.StatusActive}, want: []string{"SUMMER10", "SUMMER20"}},
+			{name: "expired", filter: CouponFilter{Status: domain.StatusExpired}, want: []string{"WINTER15"}},
+			{name: "paused", filter: CouponFilter{Status: domain.StatusPaused}, want: []string{"summer_50"}},
+			{name: "pending approval", filter: CouponFilter{Status: domain.StatusPendingApproval}, want: []string{"BIG80"}},
+			{name: "draft", filter: CouponFilter{Status: domain.StatusDraft}, want: []string{"AUTUMN5"}},
+			{name: "scheduled", filter: CouponFilter{Status: domain.StatusScheduled}, want: []string{"SPRING25"}},
+			{name: "usage type", filter: CouponFilter{UsageType: domain.OneTime}, want: []string{"SUMMER20"}},
+			{name: "discount type", filter: CouponFilter{DiscountType: domain.Fixed}, want: []string{"AUTUMN5", "summer_50"}},
+			{name: "code prefix ignores case", filter: CouponFilter{CodePrefix: "Summer"}, want: []string{"SUMMER10", "SUMMER20", "summer_50"}},
+			{name: "code prefix escapes wildcards", filter: CouponFilter{CodePrefix: "summer_"}, want: []string{"summer_50"}},
+			{name: "expiry range", filter: CouponFilter{ExpiresAfter: &now, ExpiresBefore: &tomorrow}, want: []string{"SUMMER20"}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				page, err := repo.List(ctx, CouponQuery{Filter: tt.filter, SortBy: SortByCode})
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, codes(page.Coupons))
+				assert.Empty(t, page.NextCursor)
+			})
+		}
+	})
+
+	t.Run("should reject invalid queries", func(t *testing.T) {
+		page, err := repo.List(ctx, CouponQuery{SortBy: SortByCode, Limit: 1})
+		require.NoError(t, err)
+
+		for name, query := range map[string]CouponQuery{
+			"unknown sort":     {SortBy: "terms_and_conditions"},
+			"unknown status":   {Filter: CouponFilter{Status: "archived"}},
+			"limit too large":  {Limit: MaxCouponPageSize + 1},
+			"garbage cursor":   {Cursor: "not-a-cursor"},
+			"cursor mismatch":  {SortBy: SortByExpiryDate, Cursor: page.NextCursor},
+			"direction change": {SortBy: SortByCode, Descending: true, Cursor: page.NextCursor},
+		} {
+			_, err := repo.List(ctx, query)
+			assert.IsType(t, &domain.InvalidRequestError{}, err, name)
+		}
+	})
+}
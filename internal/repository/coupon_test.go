@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCouponUsage(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestCouponRepository(t)
+
+	coupon := &domain.Coupon{
+		ID:            uuid.New(),
+		Code:          "FLAT100",
+		DiscountType:  domain.Fixed,
+		DiscountValue: domain.MoneyFromInt(100),
+		ExpiryDate:    time.Now().Add(24 * time.Hour),
+		MaxTotalUsage: 2,
+	}
+	require.NoError(t, repo.Create(ctx, coupon))
+
+	stale, err := repo.FindByCode(ctx, "FLAT100")
+	require.NoError(t, err)
+
+	require.NoError(t, repo.AddUsage(ctx, coupon.ID, 1, domain.MoneyFromInt(100)))
+	require.NoError(t, repo.AddUsage(ctx, coupon.ID, 1, domain.MoneyFromInt(100)))
+
+	// Saving a copy read before the redemptions keeps the counters.
+	stale.TermsAndConditions = "One per order"
+	require.NoError(t, repo.Update(ctx, stale))
+
+	stored, err := repo.FindByCode(ctx, "FLAT100")
+	require.NoError(t, err)
+	assert.Equal(t, "One per order", stored.TermsAndConditions)
+	assert.Equal(t, 2, stored.RedemptionCount)
+	assert.Equal(t, domain.MoneyFromInt(200), stored.DiscountSpent)
+
+	for status, want := range map[domain.CouponStatus][]string{
+		domain.StatusExhausted: {"FLAT100"},
+		domain.StatusActive:    {},
+	} {
+		page, err := repo.List(ctx, CouponQuery{Filter: CouponFilter{Status: status}})
+		require.NoError(t, err)
+		assert.Equal(t, want, codes(page.Coupons), status)
+	}
+}
+
+func TestCouponUpdateDoesNotInsert(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestCouponRepository(t)
+
+	coupon := &domain.Coupon{
+		ID:            uuid.New(),
+		Code:          "FLAT100",
+		DiscountType:  domain.Fixed,
+		DiscountValue: domain.MoneyFromInt(100),
+		ExpiryDate:    time.Now().Add(24 * time.Hour),
+	}
+	require.NoError(t, repo.Create(ctx, coupon))
+
+	t.Run("a deleted coupon is not recreated", func(t *testing.T) {
+		deleted := *coupon
+		deleted.ID = uuid.New()
+		deleted.Code = "GONE"
+		require.NoError(t, repo.Create(ctx, &deleted))
+		require.NoError(t, repo.Delete(ctx, "GONE"))
+
+		var notFound *domain.CouponNotFoundError
+		assert.ErrorAs(t, repo.Update(ctx, &deleted), &notFound)
+		_, err := repo.FindByCode(ctx, "GONE")
+		assert.ErrorAs(t, err, &notFound)
+	})
+
+	t.Run("another tenant's coupon is not overwritten", func(t *testing.T) {
+		hijack := *coupon
+		hijack.DiscountValue = domain.MoneyFromInt(1000)
+		otherTenant := domain.ContextWithTenant(ctx, "other")
+
+		var notFound *domain.CouponNotFoundError
+		assert.ErrorAs(t, repo.Update(otherTenant, &hijack), &notFound)
+
+		stored, err := repo.FindByCode(ctx, "FLAT100")
+		require.NoError(t, err)
+		assert.Equal(t, domain.DefaultTenant, stored.TenantID)
+		assert.Equal(t, domain.MoneyFromInt(100), stored.DiscountValue)
+	})
+}
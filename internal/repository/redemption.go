@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/farmako/coupon-system/internal/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RedemptionRepository stores coupon redemptions, scoped to the tenant carried
+// by ctx.
+type RedemptionRepository interface {
+	FindByOrderID(ctx context.Context, orderID string) (*domain.Redemption, error)
+	CountByUser(ctx context.Context, code, userID string) (int64, error)
+	List(ctx context.Context, filter RedemptionFilter) ([]domain.Redemption, error)
+	Create(ctx context.Context, redemption *domain.Redemption) error
+	// CreateWithinLimit creates the redemption unless its user already has
+	// limit unreversed redemptions of the coupon, in which case it returns
+	// false. The check and the insert are atomic across instances.
+	CreateWithinLimit(ctx context.Context, redemption *domain.Redemption, limit int) (bool, error)
+	// UpdateReversal saves the redemption's refund and reversal, provided its
+	// refunded amount is still refundedBefore. It returns a ConflictError if
+	// another reversal got there first.
+	UpdateReversal(ctx context.Context, redemption *domain.Redemption, refundedBefore domain.Money) error
+}
+
+// RedemptionFilter narrows List. Empty fields match everything and a zero
+// Limit returns every match.
+type RedemptionFilter struct {
+	CouponCode string
+	UserID     string
+	Limit      int
+}
+
+type redemptionRepository struct {
+	db *gorm.DB
+}
+
+func NewRedemptionRepository(db *gorm.DB) RedemptionRepository {
+	return &redemptionRepository{db: db}
+}
+
+// FindByOrderID returns nil without an error when the order has no redemption.
+func (r *redemptionRepository) FindByOrderID(ctx context.Context, orderID string) (*domain.Redemption, error) {
+	var redemption domain.Redemption
+	if err := r.scoped(ctx).Where("order_id = ?", orderID).First(&redemption).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &redemption, nil
+}
+
+// CountByUser leaves out reversed redemptions, which no longer count towards
+// the user's limit.
+func (r *redemptionRepository) CountByUser(ctx context.Context, code, userID string) (int64, error) {
+	var count int64
+	err := r.scoped(ctx).
+		Model(&domain.Redemption{}).
+		Where("coupon_code = ? AND user_id = ? AND reversed_at IS NULL", code, userID).
+		Count(&count).Error
+	return count, err
+}
+
+// List returns matching redemptions, newest first.
+func (r *redemptionRepository) List(ctx context.Context, filter RedemptionFilter) ([]domain.Redemption, error) {
+	query := r.scoped(ctx).Order("created_at DESC")
+	if filter.CouponCode != "" {
+		query = query.Where("coupon_code = ?", filter.CouponCode)
+	}
+	if filter.UserID != "" {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+
+	var redemptions []domain.Redemption
+	if err := query.Find(&redemptions).Error; err != nil {
+		return nil, err
+	}
+	return redemptions, nil
+}
+
+func (r *redemptionRepository) Create(ctx context.Context, redemption *domain.Redemption) error {
+	redemption.TenantID = domain.TenantFromContext(ctx)
+	return r.db.WithContext(ctx).Create(redemption).Error
+}
+
+func (r *redemptionRepository) CreateWithinLimit(ctx context.Context, redemption *domain.Redemption, limit int) (bool, error) {
+	redemption.TenantID = domain.TenantFromContext(ctx)
+	created := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Locking the coupon's row makes concurrent redemptions of the coupon
+		// wait for this one to commit before they count.
+		var ids []string
+		err := tx.Model(&domain.Coupon{}).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("tenant_id = ? AND code = ?", redemption.TenantID, redemption.CouponCode).
+			Pluck("id", &ids).Error
+		if err != nil {
+			return err
+		}
+
+		var count int64
+		err = tx.Model(&domain.Redemption{}).
+			Where("tenant_id = ? AND coupon_code = ? AND user_id = ? AND reversed_at IS NULL", redemption.TenantID, redemption.CouponCode, redemption.UserID).
+			Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count >= int64(limit) {
+			return nil
+		}
+
+		if err := tx.Create(redemption).Error; err != nil {
+			return err
+		}
+		created = true
+		return nil
+	})
+	return created, err
+}
+
+func (r *redemptionRepository) UpdateReversal(ctx context.Context, redemption *domain.Redemption, refundedBefore domain.Money) error {
+	result := r.scoped(ctx).
+		Model(&domain.Redemption{}).
+		Where("id = ? AND refunded_amount = ?", redemption.ID, refundedBefore).
+		Updates(map[string]any{
+			"refunded_amount":   redemption.RefundedAmount,
+			"reversed_discount": redemption.ReversedDiscount,
+			"reversed_at":       redemption.ReversedAt,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &domain.ConflictError{Reason: fmt.Sprintf("redemption for order %s was refunded concurrently", redemption.OrderID)}
+	}
+	return nil
+}
+
+func (r *redemptionRepository) scoped(ctx context.Context) *gorm.DB {
+	return r.db.WithContext(ctx).Where("tenant_id = ?", domain.TenantFromContext(ctx))
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestRedemptionReversal(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&domain.Redemption{}))
+	repo := NewRedemptionRepository(db)
+
+	ctx := context.Background()
+	for _, orderID := range []string{"order-1", "order-2"} {
+		require.NoError(t, repo.Create(ctx, &domain.Redemption{
+			ID: uuid.New(), CouponCode: "SAVE10", UserID: "user-1", OrderID: orderID, OrderValue: domain.MoneyFromInt(200), Discount: domain.MoneyFromInt(20),
+		}))
+	}
+
+	redemption, err := repo.FindByOrderID(ctx, "order-1")
+	require.NoError(t, err)
+	now := time.Now()
+	redemption.RefundedAmount, redemption.ReversedDiscount, redemption.ReversedAt = domain.MoneyFromInt(200), domain.MoneyFromInt(20), &now
+	require.NoError(t, repo.UpdateReversal(ctx, redemption, 0))
+
+	// A second reversal working from the same starting point loses.
+	err = repo.UpdateReversal(ctx, redemption, 0)
+	assert.IsType(t, &domain.ConflictError{}, err)
+
+	stored, err := repo.FindByOrderID(ctx, "order-1")
+	require.NoError(t, err)
+	assert.True(t, stored.Reversed())
+	assert.Equal(t, domain.MoneyFromInt(20), stored.ReversedDiscount)
+
+	count, err := repo.CountByUser(ctx, "SAVE10", "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestRedemptionCreateWithinLimit(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&domain.Coupon{}, &domain.Redemption{}))
+	repo := NewRedemptionRepository(db)
+
+	ctx := context.Background()
+	redeem := func(ctx context.Context, orderID, userID string) bool {
+		created, err := repo.CreateWithinLimit(ctx, &domain.Redemption{
+			ID: uuid.New(), CouponCode: "SAVE10", UserID: userID, OrderID: orderID, OrderValue: domain.MoneyFromInt(200), Discount: domain.MoneyFromInt(20),
+		}, 2)
+		require.NoError(t, err)
+		return created
+	}
+
+	assert.True(t, redeem(ctx, "order-1", "user-1"))
+	assert.True(t, redeem(ctx, "order-2", "user-1"))
+	assert.False(t, redeem(ctx, "order-3", "user-1"))
+	assert.True(t, redeem(ctx, "order-3", "user-2"))
+	assert.True(t, redeem(domain.ContextWithTenant(ctx, "other"), "order-1", "user-1"))
+
+	stored, err := repo.FindByOrderID(ctx, "order-3")
+	require.NoError(t, err)
+	assert.Equal(t, "user-2", stored.UserID)
+
+	// A reversed redemption gives the use back.
+	redemption, err := repo.FindByOrderID(ctx, "order-1")
+	require.NoError(t, err)
+	now := time.Now()
+	redemption.RefundedAmount, redemption.ReversedDiscount, redemption.ReversedAt = domain.MoneyFromInt(200), domain.MoneyFromInt(20), &now
+	require.NoError(t, repo.UpdateReversal(ctx, redemption, 0))
+	assert.True(t, redeem(ctx, "order-4", "user-1"))
+}
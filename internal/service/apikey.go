@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/farmako/coupon-system/internal/repository"
+	"github.com/google/uuid"
+)
+
+const apiKeyPrefix = "fk_"
+
+type APIKeyService interface {
+	IssueKey(ctx context.Context, req domain.APIKeyRequest) (*domain.IssuedAPIKey, error)
+	RegisterKey(ctx context.Context, name, rawKey string, scopes []string) error
+	ListKeys(ctx context.Context) ([]domain.APIKey, error)
+	RevokeKey(ctx context.Context, id uuid.UUID) error
+	Authenticate(ctx context.Context, rawKey string) (*domain.Principal, error)
+}
+
+type apiKeyService struct {
+	repo repository.APIKeyRepository
+}
+
+func NewAPIKeyService(repo repository.APIKeyRepository) APIKeyService {
+	return &apiKeyService{repo: repo}
+}
+
+func (s *apiKeyService) IssueKey(ctx context.Context, req domain.APIKeyRequest) (*domain.IssuedAPIKey, error) {
+	if err := validateGrants(req.Scopes, req.Role); err != nil {
+		return nil, err
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, &domain.InvalidRequestError{Reason: "expires_at must be in the future"}
+	}
+	if callerTenant := callerTenantID(ctx); callerTenant != "" {
+		if req.TenantID != "" && req.TenantID != callerTenant {
+			return nil, &domain.ForbiddenError{Reason: "cannot issue keys for another tenant"}
+		}
+		req.TenantID = callerTenant
+	}
+	if req.TenantID != "" && !domain.IsValidTenantID(req.TenantID) {
+		return nil, &domain.InvalidRequestError{Reason: fmt.Sprintf("invalid tenant_id: %q", req.TenantID)}
+	}
+
+	rawKey, err := generateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+
+	key := newAPIKey(req.Name, rawKey, req.Scopes)
+	key.Role = req.Role
+	key.TenantID = req.TenantID
+	key.ExpiresAt = req.ExpiresAt
+	if err := s.repo.Create(ctx, key); err != nil {
+		return nil, err
+	}
+
+	return &domain.IssuedAPIKey{APIKey: *key, Key: rawKey}, nil
+}
+
+// RegisterKey stores a key whose plaintext was supplied by the operator, such
+// as the bootstrap admin key. Registering an existing key is a no-op.
+func (s *apiKeyService) RegisterKey(ctx context.Context, name, rawKey string, scopes []string) error {
+	if !strings.HasPrefix(rawKey, apiKeyPrefix) {
+		return &domain.InvalidRequestError{Reason: "api key must start with " + apiKeyPrefix}
+	}
+	if err := validateGrants(scopes, ""); err != nil {
+		return err
+	}
+
+	_, err := s.repo.FindByHash(ctx, hashAPIKey(rawKey))
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*domain.APIKeyNotFoundError); !ok {
+		return err
+	}
+
+	return s.repo.Create(ctx, newAPIKey(name, rawKey, scopes))
+}
+
+// ListKeys returns every key visible to the caller. Callers bound to a tenant
+// only see that tenant's keys.
+func (s *apiKeyService) ListKeys(ctx context.Context) ([]domain.APIKey, error) {
+	keys, err := s.repo.FindAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	callerTenant := callerTenantID(ctx)
+	if callerTenant == "" {
+		return keys, nil
+	}
+
+	visible := keys[:0]
+	for _, key := range keys {
+		if key.TenantID == callerTenant {
+			visible = append(visible, key)
+		}
+	}
+	return visible, nil
+}
+
+func (s *apiKeyService) RevokeKey(ctx context.Context, id uuid.UUID) error {
+	key, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if callerTenant := callerTenantID(ctx); callerTenant != "" && key.TenantID != callerTenant {
+		return &domain.APIKeyNotFoundError{ID: id.String()}
+	}
+	if key.RevokedAt != nil {
+		return nil
+	}
+
+	now := time.Now()
+	key.RevokedAt = &now
+	return s.repo.Update(ctx, key)
+}
+
+func (s *apiKeyService) Authenticate(ctx context.Context, rawKey string) (*domain.Principal, error) {
+	if !strings.HasPrefix(rawKey, apiKeyPrefix) {
+		return nil, &domain.InvalidCredentialsError{Reason: "malformed api key"}
+	}
+
+	key, err := s.repo.FindByHash(ctx, hashAPIKey(rawKey))
+	if err != nil {
+		if _, ok := err.(*domain.APIKeyNotFoundError); ok {
+			return nil, &domain.InvalidCredentialsError{Reason: "unknown api key"}
+		}
+		return nil, err
+	}
+
+	if key.RevokedAt != nil {
+		return nil, &domain.InvalidCredentialsError{Reason: "api key has been revoked"}
+	}
+	if !key.IsActive(time.Now()) {
+		return nil, &domain.InvalidCredentialsError{Reason: "api key has expired"}
+	}
+
+	return &domain.Principal{
+		ID:       key.ID.String(),
+		Name:     key.Name,
+		Type:     domain.PrincipalAPIKey,
+		Scopes:   key.Scopes,
+		Role:     key.Role,
+		TenantID: key.TenantID,
+	}, nil
+}
+
+func newAPIKey(name, rawKey string, scopes []string) *domain.APIKey {
+	prefix := rawKey
+	if len(prefix) > 11 {
+		prefix = prefix[:11]
+	}
+	return &domain.APIKey{
+		ID:      uuid.New(),
+		Name:    name,
+		Prefix:  prefix,
+		KeyHash: hashAPIKey(rawKey),
+		Scopes:  scopes,
+	}
+}
+
+func callerTenantID(ctx context.Context) string {
+	if principal := domain.PrincipalFromContext(ctx); principal != nil {
+		return principal.TenantID
+	}
+	return ""
+}
+
+func validateGrants(scopes []string, role domain.Role) error {
+	if role != "" && !role.IsValid() {
+		return &domain.InvalidRequestError{Reason: fmt.Sprintf("unknown role: %s", role)}
+	}
+	if len(scopes) == 0 && role == "" {
+		return &domain.InvalidRequestError{Reason: "at least one scope or a role is required"}
+	}
+	for _, scope := range scopes {
+		if !domain.StringList(domain.KnownScopes).Contains(scope) {
+			return &domain.InvalidRequestError{Reason: fmt.Sprintf("unknown scope: %s", scope)}
+		}
+	}
+	return nil
+}
+
+// generateAPIKey returns a random key of the form fk_<64 hex chars>. Keys carry
+// 256 bits of entropy, so a plain SHA-256 digest is sufficient for storage.
+func generateAPIKey() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + hex.EncodeToString(buf), nil
+}
+
+func hashAPIKey(rawKey string) string {
+	sum := sha256.Sum256([]byte(rawKey))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/farmako/coupon-system/internal/repository"
+	"github.com/google/uuid"
+)
+
+// BlackoutService manages blackout periods that apply to every coupon of a
+// tenant, such as sale days and holidays.
+type BlackoutService interface {
+	ListBlackouts(ctx context.Context) ([]domain.Blackout, error)
+	CreateBlackout(ctx context.Context, period domain.BlackoutPeriod) (*domain.Blackout, error)
+	DeleteBlackout(ctx context.Context, id uuid.UUID) error
+}
+
+type blackoutService struct {
+	repo   repository.BlackoutRepository
+	logger *slog.Logger
+}
+
+func NewBlackoutService(repo repository.BlackoutRepository, logger *slog.Logger) BlackoutService {
+	return &blackoutService{repo: repo, logger: logger}
+}
+
+func (s *blackoutService) ListBlackouts(ctx context.Context) ([]domain.Blackout, error) {
+	return s.repo.FindAll(ctx)
+}
+
+func (s *blackoutService) CreateBlackout(ctx context.Context, period domain.BlackoutPeriod) (*domain.Blackout, error) {
+	if period.Name == "" {
+		return nil, &domain.InvalidRequestError{Reason: "name is required"}
+	}
+	if err := period.Validate(); err != nil {
+		return nil, &domain.InvalidRequestError{Reason: err.Error()}
+	}
+
+	blackout := &domain.Blackout{
+		ID:             uuid.New(),
+		BlackoutPeriod: period,
+		CreatedBy:      actorID(ctx),
+	}
+	if err := s.repo.Create(ctx, blackout); err != nil {
+		return nil, err
+	}
+	s.logChange(ctx, "blackout created", blackout)
+	return blackout, nil
+}
+
+func (s *blackoutService) DeleteBlackout(ctx context.Context, id uuid.UUID) error {
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+	s.logger.InfoContext(ctx, "blackout deleted", "blackout_id", id, "actor", actorID(ctx))
+	return nil
+}
+
+func (s *blackoutService) logChange(ctx context.Context, msg string, blackout *domain.Blackout) {
+	s.logger.InfoContext(ctx, msg,
+		"blackout", blackout.Name,
+		"blackout_id", blackout.ID,
+		"starts_at", blackout.StartsAt,
+		"ends_at", blackout.EndsAt,
+		"actor", actorID(ctx),
+	)
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/farmako/coupon-system/internal/logging"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeBlackoutRepository struct {
+	blackouts []domain.Blackout
+}
+
+func newFakeBlackoutRepository() *fakeBlackoutRepository {
+	return &fakeBlackoutRepository{}
+}
+
+func (r *fakeBlackoutRepository) FindAll(ctx context.Context) ([]domain.Blackout, error) {
+	var blackouts []domain.Blackout
+	for _, blackout := range r.blackouts {
+		if blackout.TenantID == domain.TenantFromContext(ctx) {
+			blackouts = append(blackouts, blackout)
+		}
+	}
+	return blackouts, nil
+}
+
+func (r *fakeBlackoutRepository) FindActive(ctx context.Context, at time.Time) ([]domain.Blackout, error) {
+	var blackouts []domain.Blackout
+	for _, blackout := range r.blackouts {
+		if blackout.TenantID == domain.TenantFromContext(ctx) && blackout.Covers(at) {
+			blackouts = append(blackouts, blackout)
+		}
+	}
+	return blackouts, nil
+}
+
+func (r *fakeBlackoutRepository) FindEndingAfter(ctx context.Context, at time.Time) ([]domain.Blackout, error) {
+	var blackouts []domain.Blackout
+	for _, blackout := range r.blackouts {
+		if blackout.TenantID == domain.TenantFromContext(ctx) && blackout.EndsAt.After(at) {
+			blackouts = append(blackouts, blackout)
+		}
+	}
+	return blackouts, nil
+}
+
+func (r *fakeBlackoutRepository) Create(ctx context.Context, blackout *domain.Blackout) error {
+	blackout.TenantID = domain.TenantFromContext(ctx)
+	r.blackouts = append(r.blackouts, *blackout)
+	return nil
+}
+
+func (r *fakeBlackoutRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	for i, blackout := range r.blackouts {
+		if blackout.TenantID == domain.TenantFromContext(ctx) && blackout.ID == id {
+			r.blackouts = append(r.blackouts[:i], r.blackouts[i+1:]...)
+			return nil
+		}
+	}
+	return &domain.BlackoutNotFoundError{ID: id}
+}
+
+func TestBlackouts(t *testing.T) {
+	policy := ApprovalPolicy{PercentageThreshold: domain.MoneyFromInt(50)}
+	now := time.Now()
+	sale := domain.BlackoutPeriod{Name: "Diwali sale", StartsAt: now.Add(-time.Hour), EndsAt: now.Add(2 * time.Hour)}
+
+	t.Run("coupon blackouts block validation until they end", func(t *testing.T) {
+		repo := newFakeCouponRepository()
+		admin := NewCouponAdminService(repo, newFakeRedemptionRepository(), newFakeUsageCounter(), policy, logging.Discard())
+		svc := NewCouponService(repo, newFakeRedemptionRepository(), newFakeBlackoutRepository(), newFakeUsageCounter(), nil, logging.Discard())
+
+		_, err := admin.CreateCoupon(asPrincipal("marketer"), newTestCoupon("SAVE10", domain.Percentage, 10))
+		require.NoError(t, err)
+		coupon, err := admin.SetCouponBlackouts(asPrincipal("marketer"), "SAVE10", domain.BlackoutPeriods{sale})
+		require.NoError(t, err)
+		assert.Len(t, coupon.Blackouts, 1)
+
+		response, err := svc.ValidateCoupon(context.Background(), domain.CouponValidationRequest{Code: "SAVE10", OrderValue: domain.MoneyFromInt(100)})
+		require.NoError(t, err)
+		assert.False(t, response.IsValid)
+		assert.Equal(t, domain.ReasonBlackout, response.Reason)
+		assert.Contains(t, response.Message, "Diwali sale")
+		require.NotNil(t, response.NextValidAt)
+		assert.True(t, sale.EndsAt.Equal(*response.NextValidAt))
+
+		coupons, err := svc.GetApplicableCoupons(context.Background(), domain.CouponRequest{OrderValue: domain.MoneyFromInt(100)})
+		require.NoError(t, err)
+		assert.Empty(t, coupons)
+
+		_, err = admin.SetCouponBlackouts(asPrincipal("marketer"), "SAVE10", nil)
+		require.NoError(t, err)
+		response, err = svc.ValidateCoupon(context.Background(), domain.CouponValidationRequest{Code: "SAVE10", OrderValue: domain.MoneyFromInt(100)})
+		require.NoError(t, err)
+		assert.True(t, response.IsValid)
+
+		backwards := domain.BlackoutPeriod{Name: "Backwards", StartsAt: sale.EndsAt, EndsAt: sale.StartsAt}
+		_, err = admin.SetCouponBlackouts(asPrincipal("marketer"), "SAVE10", domain.BlackoutPeriods{backwards})
+		assert.IsType(t, &domain.InvalidRequestError{}, err)
+	})
+
+	t.Run("global blackouts apply to every coupon of the tenant", func(t *testing.T) {
+		repo := newFakeCouponRepository()
+		blackoutRepo := newFakeBlackoutRepository()
+		admin := NewCouponAdminService(repo, newFakeRedemptionRepository(), newFakeUsageCounter(), policy, logging.Discard())
+		blackouts := NewBlackoutService(blackoutRepo, logging.Discard())
+		svc := NewCouponService(repo, newFakeRedemptionRepository(), blackoutRepo, newFakeUsageCounter(), nil, logging.Discard())
+
+		_, err := admin.CreateCoupon(asPrincipal("marketer"), newTestCoupon("SAVE10", domain.Percentage, 10))
+		require.NoError(t, err)
+		blackout, err := blackouts.CreateBlackout(asPrincipal("marketer"), sale)
+		require.NoError(t, err)
+		assert.Equal(t, "marketer", blackout.CreatedBy)
+
+		response, err := svc.RedeemCoupon(context.Background(), domain.CouponRedemptionRequest{
+			CouponValidationRequest: domain.CouponValidationRequest{Code: "SAVE10", OrderValue: domain.MoneyFromInt(100), UserID: "user-1"},
+			OrderID:                 "order-1",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, domain.ReasonBlackout, response.Reason)
+		assert.Nil(t, response.Redemption)
+
+		other := domain.ContextWithTenant(context.Background(), "other")
+		_, err = admin.CreateCoupon(domain.ContextWithTenant(asPrincipal("marketer"), "other"), newTestCoupon("SAVE10", domain.Percentage, 10))
+		require.NoError(t, err)
+		coupons, err := svc.GetApplicableCoupons(other, domain.CouponRequest{OrderValue: domain.MoneyFromInt(100)})
+		require.NoError(t, err)
+		assert.Len(t, coupons, 1)
+
+		require.NoError(t, blackouts.DeleteBlackout(context.Background(), blackout.ID))
+		assert.IsType(t, &domain.BlackoutNotFoundError{}, blackouts.DeleteBlackout(context.Background(), blackout.ID))
+
+		_, err = blackouts.CreateBlackout(context.Background(), domain.BlackoutPeriod{StartsAt: sale.StartsAt, EndsAt: sale.EndsAt})
+		assert.IsType(t, &domain.InvalidRequestError{}, err)
+	})
+
+	t.Run("next valid time skips back-to-back blackouts", func(t *testing.T) {
+		repo := newFakeCouponRepository()
+		blackoutRepo := newFakeBlackoutRepository()
+		admin := NewCouponAdminService(repo, newFakeRedemptionRepository(), newFakeUsageCounter(), policy, logging.Discard())
+		blackouts := NewBlackoutService(blackoutRepo, logging.Discard())
+		svc := NewCouponService(repo, newFakeRedemptionRepository(), blackoutRepo, newFakeUsageCounter(), nil, logging.Discard())
+
+		_, err := admin.CreateCoupon(asPrincipal("marketer"), newTestCoupon("SAVE10", domain.Percentage, 10))
+		require.NoError(t, err)
+		afterSale := domain.BlackoutPeriod{Name: "Stock take", StartsAt: sale.EndsAt, EndsAt: sale.EndsAt.Add(time.Hour)}
+		_, err = admin.SetCouponBlackouts(asPrincipal("marketer"), "SAVE10", domain.BlackoutPeriods{sale, afterSale})
+		require.NoError(t, err)
+		closing := domain.BlackoutPeriod{Name: "Year end", StartsAt: afterSale.EndsAt.Add(-time.Minute), EndsAt: afterSale.EndsAt.Add(time.Hour)}
+		_, err = blackouts.CreateBlackout(asPrincipal("marketer"), closing)
+		require.NoError(t, err)
+
+		response, err := svc.ValidateCoupon(context.Background(), domain.CouponValidationRequest{Code: "SAVE10", OrderValue: domain.MoneyFromInt(100)})
+		require.NoError(t, err)
+		assert.Equal(t, domain.ReasonBlackout, response.Reason)
+		require.NotNil(t, response.NextValidAt)
+		assert.True(t, closing.EndsAt.Equal(*response.NextValidAt))
+	})
+}
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/farmako/coupon-system/internal/repository"
+	"github.com/google/uuid"
+)
+
+const (
+	// MaxCodesPerRequest bounds a single GenerateCodes call.
+	MaxCodesPerRequest = 100000
+	codeBatchSize      = 1000
+	// maxCodeCollisionRounds bounds how often a batch is regenerated when its
+	// codes collide with existing ones, which only happens with a tiny keyspace.
+	maxCodeCollisionRounds = 10
+)
+
+type CampaignService interface {
+	ListCampaigns(ctx context.Context) ([]domain.Campaign, error)
+	GetCampaign(ctx context.Context, id uuid.UUID) (*domain.Campaign, error)
+	CreateCampaign(ctx context.Context, campaign *domain.Campaign) (*domain.Campaign, error)
+	ApproveCampaign(ctx context.Context, id uuid.UUID) (*domain.Campaign, error)
+	GenerateCodes(ctx context.Context, id uuid.UUID, req domain.CodeGenerationRequest) (*domain.CodeGenerationResponse, error)
+	ExportCodes(ctx context.Context, id uuid.UUID) ([]string, error)
+}
+
+type campaignService struct {
+	campaigns repository.CampaignRepository
+	coupons   repository.CouponRepository
+	policy    ApprovalPolicy
+	logger    *slog.Logger
+}
+
+func NewCampaignService(campaigns repository.CampaignRepository, coupons repository.CouponRepository, policy ApprovalPolicy, logger *slog.Logger) CampaignService {
+	return &campaignService{
+		campaigns: campaigns,
+		coupons:   coupons,
+		policy:    policy,
+		logger:    logger,
+	}
+}
+
+func (s *campaignService) ListCampaigns(ctx context.Context) ([]domain.Campaign, error) {
+	return s.campaigns.FindAll(ctx)
+}
+
+func (s *campaignService) GetCampaign(ctx context.Context, id uuid.UUID) (*domain.Campaign, error) {
+	return s.campaigns.FindByID(ctx, id)
+}
+
+// CreateCampaign stores the rules for a campaign. Campaigns go through the
+// same approval policy as single coupons, once for all of their codes.
+func (s *campaignService) CreateCampaign(ctx context.Context, campaign *domain.Campaign) (*domain.Campaign, error) {
+	if campaign.Name == "" {
+		return nil, &domain.InvalidRequestError{Reason: "name is required"}
+	}
+	// Validate the rules as they will appear on the generated coupons.
+	sample := campaign.NewCoupon(campaign.Name)
+	if err := validateCoupon(&sample); err != nil {
+		return nil, err
+	}
+	campaign.Currency = sample.Currency
+
+	existing, err := s.campaigns.FindByName(ctx, campaign.Name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, &domain.ConflictError{Reason: fmt.Sprintf("campaign %s already exists", campaign.Name)}
+	}
+
+	campaign.ID = uuid.New()
+	campaign.CreatedBy = actorID(ctx)
+	campaign.CodesGenerated = 0
+	campaign.ApprovedBy = ""
+	campaign.ApprovedAt = nil
+	if s.policy.RequiresApproval(&sample) {
+		campaign.ApprovalStatus = domain.PendingApproval
+		campaign.ApprovalRequestedBy = campaign.CreatedBy
+	} else {
+		campaign.ApprovalStatus = domain.Approved
+		campaign.ApprovalRequestedBy = ""
+	}
+
+	if err := s.campaigns.Create(ctx, campaign); err != nil {
+		return nil, err
+	}
+	s.logChange(ctx, "campaign created", campaign)
+	return campaign, nil
+}
+
+// ApproveCampaign approves a campaign pending approval so codes can be
+// generated. The approver must differ from the campaign's author.
+func (s *campaignService) ApproveCampaign(ctx context.Context, id uuid.UUID) (*domain.Campaign, error) {
+	campaign, err := s.campaigns.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if campaign.IsApproved() {
+		return nil, &domain.ConflictError{Reason: fmt.Sprintf("campaign %s is not pending approval", campaign.Name)}
+	}
+
+	approver := actorID(ctx)
+	if approver == "" || approver == campaign.ApprovalRequestedBy {
+		return nil, &domain.ForbiddenError{Reason: "campaign must be approved by someone other than its author"}
+	}
+
+	now := time.Now()
+	campaign.ApprovalStatus = domain.Approved
+	campaign.ApprovedBy = approver
+	campaign.ApprovedAt = &now
+
+	if err := s.campaigns.Update(ctx, campaign); err != nil {
+		return nil, err
+	}
+	s.logChange(ctx, "campaign approved", campaign)
+	return campaign, nil
+}
+
+// GenerateCodes creates req.Count coupons with random, unique codes and the
+// campaign's rules. Codes are inserted in batches; if a batch fails, the
+// batches before it are kept and counted on the campaign.
+func (s *campaignService) GenerateCodes(ctx context.Context, id uuid.UUID, req domain.CodeGenerationRequest) (*domain.CodeGenerationResponse, error) {
+	if req.Count <= 0 || req.Count > MaxCodesPerRequest {
+		return nil, &domain.InvalidRequestError{Reason: fmt.Sprintf("count must be between 1 and %d", MaxCodesPerRequest)}
+	}
+	generator, err := newCodeGenerator(req.Prefix, req.Length, req.Alphabet, req.Count)
+	if err != nil {
+		return nil, &domain.InvalidRequestError{Reason: err.Error()}
+	}
+
+	campaign, err := s.campaigns.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !campaign.IsApproved() {
+		return nil, &domain.ConflictError{Reason: fmt.Sprintf("campaign %s is pending approval", campaign.Name)}
+	}
+
+	seen := make(map[string]bool, req.Count)
+	generated := 0
+	for generated < req.Count {
+		codes, err := s.uniqueCodes(ctx, generator, min(codeBatchSize, req.Count-generated), seen)
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now()
+		coupons := make([]domain.Coupon, len(codes))
+		for i, code := range codes {
+			coupons[i] = campaign.NewCoupon(code)
+			coupons[i].ID = uuid.New()
+			coupons[i].CreatedAt = now
+			coupons[i].UpdatedAt = now
+		}
+		if err := s.campaigns.AddCodes(ctx, campaign, coupons); err != nil {
+			return nil, err
+		}
+		generated += len(coupons)
+	}
+
+	s.logger.InfoContext(ctx, "campaign codes generated",
+		"campaign", campaign.Name,
+		"campaign_id", campaign.ID,
+		"actor", actorID(ctx),
+		"count", generated,
+	)
+	return &domain.CodeGenerationResponse{Campaign: campaign, Generated: generated}, nil
+}
+
+// uniqueCodes returns n new codes that are neither in seen nor already stored,
+// and adds them to seen.
+func (s *campaignService) uniqueCodes(ctx context.Context, generator *codeGenerator, n int, seen map[string]bool) ([]string, error) {
+	codes := make([]string, 0, n)
+	for round := 0; len(codes) < n; round++ {
+		if round == maxCodeCollisionRounds {
+			return nil, &domain.ConflictError{Reason: "could not generate enough unique codes; use a longer length or larger alphabet"}
+		}
+
+		fresh := make([]string, 0, n-len(codes))
+		for len(fresh) < n-len(codes) {
+			code, err := generator.next()
+			if err != nil {
+				return nil, err
+			}
+			if !seen[code] {
+				seen[code] = true
+				fresh = append(fresh, code)
+			}
+		}
+
+		taken, err := s.coupons.ExistingCodes(ctx, fresh)
+		if err != nil {
+			return nil, err
+		}
+		takenSet := make(map[string]bool, len(taken))
+		for _, code := range taken {
+			takenSet[code] = true
+		}
+		for _, code := range fresh {
+			if !takenSet[code] {
+				codes = append(codes, code)
+			}
+		}
+	}
+	return codes, nil
+}
+
+func (s *campaignService) ExportCodes(ctx context.Context, id uuid.UUID) ([]string, error) {
+	if _, err := s.campaigns.FindByID(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.coupons.CodesByCampaign(ctx, id)
+}
+
+func (s *campaignService) logChange(ctx context.Context, msg string, campaign *domain.Campaign) {
+	s.logger.InfoContext(ctx, msg,
+		"campaign", campaign.Name,
+		"campaign_id", campaign.ID,
+		"actor", actorID(ctx),
+		"approval_status", campaign.ApprovalStatus,
+	)
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/farmako/coupon-system/internal/logging"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCampaignRepository struct {
+	campaigns map[uuid.UUID]domain.Campaign
+	coupons   *fakeCouponRepository
+}
+
+func newFakeCampaignRepository(coupons *fakeCouponRepository) *fakeCampaignRepository {
+	return &fakeCampaignRepository{campaigns: make(map[uuid.UUID]domain.Campaign), coupons: coupons}
+}
+
+func (r *fakeCampaignRepository) FindByID(ctx context.Context, id uuid.UUID) (*domain.Campaign, error) {
+	campaign, ok := r.campaigns[id]
+	if !ok || campaign.TenantID != domain.TenantFromContext(ctx) {
+		return nil, &domain.CampaignNotFoundError{ID: id}
+	}
+	return &campaign, nil
+}
+
+func (r *fakeCampaignRepository) FindByName(ctx context.Context, name string) (*domain.Campaign, error) {
+	for _, campaign := range r.campaigns {
+		if campaign.TenantID == domain.TenantFromContext(ctx) && campaign.Name == name {
+			return &campaign, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeCampaignRepository) FindAll(ctx context.Context) ([]domain.Campaign, error) {
+	var campaigns []domain.Campaign
+	for _, campaign := range r.campaigns {
+		if campaign.TenantID == domain.TenantFromContext(ctx) {
+			campaigns = append(campaigns, campaign)
+		}
+	}
+	return campaigns, nil
+}
+
+func (r *fakeCampaignRepository) Create(ctx context.Context, campaign *domain.Campaign) error {
+	campaign.TenantID = domain.TenantFromContext(ctx)
+	r.campaigns[campaign.ID] = *campaign
+	return nil
+}
+
+func (r *fakeCampaignRepository) Update(ctx context.Context, campaign *domain.Campaign) error {
+	stored, err := r.FindByID(ctx, campaign.ID)
+	if err != nil {
+		return err
+	}
+	campaign.CodesGenerated = stored.CodesGenerated
+	return r.Create(ctx, campaign)
+}
+
+func (r *fakeCampaignRepository) AddCodes(ctx context.Context, campaign *domain.Campaign, coupons []domain.Coupon) error {
+	stored, err := r.FindByID(ctx, campaign.ID)
+	if err != nil {
+		return err
+	}
+	if err := r.coupons.CreateBatch(ctx, coupons, len(coupons)); err != nil {
+		return err
+	}
+	stored.CodesGenerated += len(coupons)
+	r.campaigns[stored.ID] = *stored
+	campaign.CodesGenerated = stored.CodesGenerated
+	return nil
+}
+
+func newTestCampaign(name string, value int64) *domain.Campaign {
+	return &domain.Campaign{
+		Name:          name,
+		ExpiryDate:    time.Now().Add(24 * time.Hour),
+		UsageType:     domain.OneTime,
+		DiscountType:  domain.Percentage,
+		DiscountValue: domain.MoneyFromInt(value),
+	}
+}
+
+func TestCampaignCodeGeneration(t *testing.T) {
+	policy := ApprovalPolicy{PercentageThreshold: domain.MoneyFromInt(50)}
+
+	t.Run("generated coupons are unique and carry the campaign's rules", func(t *testing.T) {
+		coupons := newFakeCouponRepository()
+		svc := NewCampaignService(newFakeCampaignRepository(coupons), coupons, policy, logging.Discard())
+		ctx := asPrincipal("marketer")
+
+		campaign, err := svc.CreateCampaign(ctx, newTestCampaign("summer", 10))
+		require.NoError(t, err)
+		assert.Equal(t, domain.Approved, campaign.ApprovalStatus)
+
+		response, err := svc.GenerateCodes(ctx, campaign.ID, domain.CodeGenerationRequest{Count: 2500, Prefix: "SUM-", Length: 8})
+		require.NoError(t, err)
+		assert.Equal(t, 2500, response.Generated)
+		assert.Equal(t, 2500, response.Campaign.CodesGenerated)
+
+		codes, err := svc.ExportCodes(ctx, campaign.ID)
+		require.NoError(t, err)
+		require.Len(t, codes, 2500)
+		for _, code := range codes {
+			assert.True(t, strings.HasPrefix(code, "SUM-"), code)
+			assert.Len(t, code, len("SUM-")+8)
+			assert.False(t, strings.ContainsAny(code[len("SUM-"):], confusableCodeCharacters), code)
+		}
+
+		coupon, err := coupons.FindByCode(ctx, codes[0])
+		require.NoError(t, err)
+		assert.Equal(t, domain.OneTime, coupon.UsageType)
+		assert.Equal(t, domain.MoneyFromInt(10), coupon.DiscountValue)
+		assert.Equal(t, campaign.ID, *coupon.CampaignID)
+	})
+
+	t.Run("codes are not generated until the campaign is approved", func(t *testing.T) {
+		coupons := newFakeCouponRepository()
+		svc := NewCampaignService(newFakeCampaignRepository(coupons), coupons, policy, logging.Discard())
+
+		campaign, err := svc.CreateCampaign(asPrincipal("marketer"), newTestCampaign("big", 80))
+		require.NoError(t, err)
+		assert.Equal(t, domain.PendingApproval, campaign.ApprovalStatus)
+
+		_, err = svc.GenerateCodes(asPrincipal("marketer"), campaign.ID, domain.CodeGenerationRequest{Count: 10})
+		assert.IsType(t, &domain.ConflictError{}, err)
+
+		_, err = svc.ApproveCampaign(asPrincipal("marketer"), campaign.ID)
+		assert.IsType(t, &domain.ForbiddenError{}, err)
+
+		_, err = svc.ApproveCampaign(asPrincipal("approver"), campaign.ID)
+		require.NoError(t, err)
+
+		response, err := svc.GenerateCodes(asPrincipal("marketer"), campaign.ID, domain.CodeGenerationRequest{Count: 10})
+		require.NoError(t, err)
+		assert.Equal(t, 10, response.Generated)
+	})
+
+	t.Run("invalid generation options are rejected", func(t *testing.T) {
+		coupons := newFakeCouponRepository()
+		svc := NewCampaignService(newFakeCampaignRepository(coupons), coupons, policy, logging.Discard())
+		ctx := asPrincipal("marketer")
+		campaign, err := svc.CreateCampaign(ctx, newTestCampaign("options", 10))
+		require.NoError(t, err)
+
+		for name, req := range map[string]domain.CodeGenerationRequest{
+			"zero count":          {Count: 0},
+			"too many codes":      {Count: MaxCodesPerRequest + 1},
+			"too short":           {Count: 1, Length: 4},
+			"confusable alphabet": {Count: 1, Alphabet: "ABC0"},
+			"guessable keyspace":  {Count: 1000, Length: 6, Alphabet: "AB"},
+			"single letter":       {Count: 1, Alphabet: "AAAA"},
+		} {
+			_, err := svc.GenerateCodes(ctx, campaign.ID, req)
+			assert.IsType(t, &domain.InvalidRequestError{}, err, name)
+		}
+	})
+
+	t.Run("campaign names are unique per tenant", func(t *testing.T) {
+		coupons := newFakeCouponRepository()
+		svc := NewCampaignService(newFakeCampaignRepository(coupons), coupons, policy, logging.Discard())
+		ctx := asPrincipal("marketer")
+
+		_, err := svc.CreateCampaign(ctx, newTestCampaign("dup", 10))
+		require.NoError(t, err)
+		_, err = svc.CreateCampaign(ctx, newTestCampaign("dup", 10))
+		assert.IsType(t, &domain.ConflictError{}, err)
+	})
+}
+
+func TestCodeGeneratorAvoidsExistingCodes(t *testing.T) {
+	coupons := newFakeCouponRepository()
+	ctx := context.Background()
+	svc := &campaignService{coupons: coupons, logger: logging.Discard()}
+
+	// With a two-letter alphabet and no room for chance, every collision must
+	// be regenerated.
+	generator := &codeGenerator{length: 2, alphabet: []rune("AB")}
+	require.NoError(t, coupons.Create(ctx, &domain.Coupon{Code: "AA"}))
+	require.NoError(t, coupons.Create(ctx, &domain.Coupon{Code: "AB"}))
+
+	codes, err := svc.uniqueCodes(ctx, generator, 2, make(map[string]bool))
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"BA", "BB"}, codes)
+}
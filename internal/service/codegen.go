@@ -0,0 +1,85 @@
+package service
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// DefaultCodeAlphabet leaves out characters that are easily confused when
+// codes are read aloud or typed from print: 0/O, 1/I/L.
+const DefaultCodeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+const confusableCodeCharacters = "0O1IL"
+
+const (
+	DefaultCodeLength = 10
+	minCodeLength     = 6
+	maxCodeLength     = 32
+	maxCodePrefix     = 32
+	// minGuessesPerCode keeps codes non-guessable: a random guess must hit a
+	// generated code with probability below 1 in a million.
+	minGuessesPerCode = 1e6
+)
+
+// codeGenerator draws random codes from a cryptographically secure source.
+type codeGenerator struct {
+	prefix   string
+	length   int
+	alphabet []rune
+}
+
+// newCodeGenerator validates the options for generating count codes and
+// applies the defaults for the zero values.
+func newCodeGenerator(prefix string, length int, alphabet string, count int) (*codeGenerator, error) {
+	if length == 0 {
+		length = DefaultCodeLength
+	}
+	if alphabet == "" {
+		alphabet = DefaultCodeAlphabet
+	}
+
+	if len(prefix) > maxCodePrefix {
+		return nil, fmt.Errorf("prefix must be at most %d characters", maxCodePrefix)
+	}
+	if length < minCodeLength || length > maxCodeLength {
+		return nil, fmt.Errorf("length must be between %d and %d", minCodeLength, maxCodeLength)
+	}
+
+	seen := make(map[rune]bool)
+	var runes []rune
+	for _, r := range alphabet {
+		if strings.ContainsRune(confusableCodeCharacters, r) {
+			return nil, fmt.Errorf("alphabet must not contain the confusable characters %s", confusableCodeCharacters)
+		}
+		if !seen[r] {
+			seen[r] = true
+			runes = append(runes, r)
+		}
+	}
+	if len(runes) < 2 {
+		return nil, fmt.Errorf("alphabet must have at least two distinct characters")
+	}
+
+	if math.Pow(float64(len(runes)), float64(length)) < float64(count)*minGuessesPerCode {
+		return nil, fmt.Errorf("length %d over a %d-character alphabet is too guessable for %d codes", length, len(runes), count)
+	}
+
+	return &codeGenerator{prefix: prefix, length: length, alphabet: runes}, nil
+}
+
+func (g *codeGenerator) next() (string, error) {
+	var b strings.Builder
+	b.WriteString(g.prefix)
+	max := big.NewInt(int64(len(g.alphabet)))
+	for i := 0; i < g.length; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b.WriteRune(g.alphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
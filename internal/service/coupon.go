@@ -2,48 +2,91 @@ package service
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
 	"sync"
 	"time"
 
 	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/farmako/coupon-system/internal/metrics"
 	"github.com/farmako/coupon-system/internal/repository"
-	"github.com/redis/go-redis/v9"
+	"github.com/farmako/coupon-system/internal/tracing"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/farmako/coupon-system/internal/service")
+
 type CouponService interface {
 	GetApplicableCoupons(ctx context.Context, req domain.CouponRequest) ([]domain.Coupon, error)
 	ValidateCoupon(ctx context.Context, req domain.CouponValidationRequest) (*domain.CouponValidationResponse, error)
+	RedeemCoupon(ctx context.Context, req domain.CouponRedemptionRequest) (*domain.CouponRedemptionResponse, error)
+	ReverseRedemption(ctx context.Context, orderID string, req domain.RedemptionReversalRequest) (*domain.Redemption, error)
 }
 
 type couponService struct {
-	repo  repository.CouponRepository
-	redis *redis.Client
-	mu    sync.Mutex
+	repo        repository.CouponRepository
+	redemptions repository.RedemptionRepository
+	blackouts   repository.BlackoutRepository
+	usage       UsageCounter
+	metrics     *metrics.Metrics
+	logger      *slog.Logger
+	mu          sync.Mutex
 }
 
-func NewCouponService(repo repository.CouponRepository, redis *redis.Client) CouponService {
+func NewCouponService(repo repository.CouponRepository, redemptions repository.RedemptionRepository, blackouts repository.BlackoutRepository, usage UsageCounter, metrics *metrics.Metrics, logger *slog.Logger) CouponService {
 	return &couponService{
-		repo:  repo,
-		redis: redis,
+		repo:        repo,
+		redemptions: redemptions,
+		blackouts:   blackouts,
+		usage:       usage,
+		metrics:     metrics,
+		logger:      logger,
 	}
 }
 
 func (s *couponService) GetApplicableCoupons(ctx context.Context, req domain.CouponRequest) ([]domain.Coupon, error) {
+	ctx, span := tracer.Start(ctx, "couponService.GetApplicableCoupons")
+	defer span.End()
+
+	applyCartItems(req.Items, &req.OrderValue, &req.MedicineIDs, &req.Categories)
+
 	// Get all active coupons
 	coupons, err := s.repo.FindAll(ctx)
 	if err != nil {
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+
+	now := time.Now()
+	blackouts, err := s.blackouts.FindActive(ctx, now)
+	if err != nil {
+		tracing.RecordError(span, err)
 		return nil, err
 	}
 
 	var applicableCoupons []domain.Coupon
 	for _, coupon := range coupons {
-		if time.Now().After(coupon.ExpiryDate) {
+		if !coupon.IsActive(now) || blackoutAt(&coupon, blackouts, now) != nil {
 			continue
 		}
 
+		if req.Currency != "" && req.Currency != coupon.Currency {
+			continue
+		}
 		if req.OrderValue < coupon.MinOrderValue {
 			continue
 		}
+		if applied, _ := coupon.Tiers.At(req.OrderValue); len(coupon.Tiers) > 0 && applied == nil {
+			continue
+		}
+		if coupon.DiscountType == domain.PerUnit || coupon.DiscountType == domain.BuyXGetY {
+			if eligibleUnits(&coupon, req.Items) < minimumUnits(&coupon) {
+				continue
+			}
+		}
 
 		if len(coupon.ApplicableMedicineIDs) > 0 {
 			valid := false
@@ -84,30 +127,339 @@ func (s *couponService) GetApplicableCoupons(ctx context.Context, req domain.Cou
 		applicableCoupons = append(applicableCoupons, coupon)
 	}
 
+	span.SetAttributes(
+		attribute.Int("coupons.evaluated", len(coupons)),
+		attribute.Int("coupons.applicable", len(applicableCoupons)),
+	)
 	return applicableCoupons, nil
 }
 
 func (s *couponService) ValidateCoupon(ctx context.Context, req domain.CouponValidationRequest) (*domain.CouponValidationResponse, error) {
+	ctx, span := tracer.Start(ctx, "couponService.ValidateCoupon", trace.WithAttributes(tracing.CouponCode(req.Code)))
+	defer span.End()
+
+	applyCartItems(req.Items, &req.OrderValue, &req.MedicineIDs, &req.Categories)
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	coupon, err := s.repo.FindByCode(ctx, req.Code)
 	if err != nil {
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+
+	blackouts, err := s.blackouts.FindEndingAfter(ctx, time.Now())
+	if err != nil {
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+
+	response := s.evaluateCoupon(coupon, req, blackouts)
+	s.recordDecision(ctx, span, "validate", req, response)
+	return response, nil
+}
+
+// RedeemCoupon validates the coupon against the order, enforces the per-user
+// usage limit and the coupon's total caps, and records the redemption. Each
+// order can redeem one coupon.
+func (s *couponService) RedeemCoupon(ctx context.Context, req domain.CouponRedemptionRequest) (*domain.CouponRedemptionResponse, error) {
+	ctx, span := tracer.Start(ctx, "couponService.RedeemCoupon", trace.WithAttributes(tracing.CouponCode(req.Code)))
+	defer span.End()
+
+	applyCartItems(req.Items, &req.OrderValue, &req.MedicineIDs, &req.Categories)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	coupon, err := s.repo.FindByCode(ctx, req.Code)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+
+	existing, err := s.redemptions.FindByOrderID(ctx, req.OrderID)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+	if existing != nil {
+		return nil, &domain.ConflictError{Reason: fmt.Sprintf("order %s has already redeemed coupon %s", req.OrderID, existing.CouponCode)}
+	}
+
+	blackouts, err := s.blackouts.FindEndingAfter(ctx, time.Now())
+	if err != nil {
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+
+	validation := s.evaluateCoupon(coupon, req.CouponValidationRequest, blackouts)
+	if !validation.IsValid {
+		s.recordDecision(ctx, span, "redeem", req.CouponValidationRequest, validation)
+		return &domain.CouponRedemptionResponse{CouponValidationResponse: *validation}, nil
+	}
+
+	capped := coupon.MaxTotalUsage > 0 || coupon.Budget > 0
+	if capped {
+		granted, ok, err := s.usage.Reserve(ctx, coupon, validation.Discount)
+		if err != nil {
+			tracing.RecordError(span, err)
+			return nil, err
+		}
+		if !ok {
+			response := &domain.CouponRedemptionResponse{
+				CouponValidationResponse: domain.CouponValidationResponse{
+					IsValid: false,
+					Message: "Coupon has reached its redemption limit",
+					Reason:  domain.ReasonExhausted,
+				},
+			}
+			s.recordDecision(ctx, span, "redeem", req.CouponValidationRequest, &response.CouponValidationResponse)
+			return response, nil
+		}
+		if granted < validation.Discount {
+			capItemDiscounts(validation.ItemDiscounts, granted)
+		}
+		validation.Discount = granted
+		validation.FinalAmount = req.OrderValue - granted
+	}
+
+	redemption := &domain.Redemption{
+		ID:         uuid.New(),
+		CouponCode: coupon.Code,
+		UserID:     req.UserID,
+		OrderID:    req.OrderID,
+		Currency:   coupon.Currency,
+		OrderValue: req.OrderValue,
+		Discount:   validation.Discount,
+	}
+	created, err := s.createRedemption(ctx, coupon, redemption)
+	if capped && (err != nil || !created) {
+		if releaseErr := s.usage.Release(ctx, coupon, 1, validation.Discount); releaseErr != nil {
+			s.logger.ErrorContext(ctx, "failed to release coupon usage", "code", coupon.Code, "error", releaseErr)
+		}
+	}
+	if err != nil {
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+	if !created {
+		response := &domain.CouponRedemptionResponse{
+			CouponValidationResponse: domain.CouponValidationResponse{
+				IsValid: false,
+				Message: "Coupon usage limit reached",
+				Reason:  domain.ReasonUsageLimitReached,
+			},
+		}
+		s.recordDecision(ctx, span, "redeem", req.CouponValidationRequest, &response.CouponValidationResponse)
+		return response, nil
+	}
+	// The redemption stands even if the counters cannot be updated, as the
+	// usage counter has already accepted it.
+	if err := s.repo.AddUsage(ctx, coupon.ID, 1, redemption.Discount); err != nil {
+		tracing.RecordError(span, err)
+		s.logger.ErrorContext(ctx, "failed to update coupon usage", "code", coupon.Code, "error", err)
+	}
+	coupon.RedemptionCount++
+	coupon.DiscountSpent += redemption.Discount
+	if capped && coupon.Exhausted() {
+		s.logger.InfoContext(ctx, "coupon exhausted",
+			"code", coupon.Code,
+			"redemption_count", coupon.RedemptionCount,
+			"discount_spent", coupon.DiscountSpent,
+		)
+	}
+	s.recordDecision(ctx, span, "redeem", req.CouponValidationRequest, validation)
+	s.metrics.ObserveDiscountIssued(string(coupon.DiscountType), redemption.Discount.Float64())
+
+	validation.Message = "Coupon redeemed"
+	return &domain.CouponRedemptionResponse{
+		CouponValidationResponse: *validation,
+		Redemption:               redemption,
+	}, nil
+}
+
+// ReverseRedemption records a refund against the order's redemption and gives
+// back the matching share of the discount to the coupon's budget. Refunding
+// the whole order reverses the redemption, which also gives the use back to
+// the user and to the coupon's total cap. Repeating a refund already recorded
+// changes nothing.
+func (s *couponService) ReverseRedemption(ctx context.Context, orderID string, req domain.RedemptionReversalRequest) (*domain.Redemption, error) {
+	ctx, span := tracer.Start(ctx, "couponService.ReverseRedemption", trace.WithAttributes(attribute.String("order.id", orderID)))
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	redemption, err := s.redemptions.FindByOrderID(ctx, orderID)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+	if redemption == nil {
+		return nil, &domain.RedemptionNotFoundError{OrderID: orderID}
+	}
+
+	refunded := redemption.OrderValue
+	if req.RefundedAmount != nil {
+		refunded = *req.RefundedAmount
+	}
+	switch {
+	case refunded <= 0 || refunded > redemption.OrderValue:
+		return nil, &domain.InvalidRequestError{Reason: fmt.Sprintf("refunded_amount must be greater than 0 and at most the order value %s", redemption.OrderValue.StringFixed())}
+	case refunded < redemption.RefundedAmount:
+		return nil, &domain.ConflictError{Reason: fmt.Sprintf("order %s has already been refunded %s", orderID, redemption.RefundedAmount.StringFixed())}
+	case refunded == redemption.RefundedAmount:
+		return redemption, nil
+	}
+
+	refundedBefore, reversedBefore := redemption.RefundedAmount, redemption.ReversedDiscount
+	redemption.RefundedAmount = refunded
+	if refunded == redemption.OrderValue {
+		now := time.Now()
+		redemption.ReversedAt = &now
+		redemption.ReversedDiscount = redemption.Discount
+	} else {
+		redemption.ReversedDiscount = redemption.Discount.MulRatio(int64(refunded), int64(redemption.OrderValue), domain.RoundHalfUp)
+	}
+	if err := s.redemptions.UpdateReversal(ctx, redemption, refundedBefore); err != nil {
+		tracing.RecordError(span, err)
 		return nil, err
 	}
 
-	if time.Now().After(coupon.ExpiryDate) {
+	redemptions := 0
+	if redemption.Reversed() {
+		redemptions = 1
+	}
+	s.releaseUsage(ctx, redemption, redemptions, redemption.ReversedDiscount-reversedBefore)
+	s.logger.InfoContext(ctx, "redemption reversed",
+		"code", redemption.CouponCode,
+		"order_id", orderID,
+		"refunded_amount", redemption.RefundedAmount,
+		"reversed_discount", redemption.ReversedDiscount,
+		"fully_reversed", redemption.Reversed(),
+	)
+	return redemption, nil
+}
+
+// releaseUsage gives redemptions and discount back to the redeemed coupon's
+// counters. The reversal stands if they cannot be updated, as it is already
+// recorded.
+func (s *couponService) releaseUsage(ctx context.Context, redemption *domain.Redemption, redemptions int, discount domain.Money) {
+	coupon, err := s.repo.FindByCode(ctx, redemption.CouponCode)
+	if err != nil {
+		s.logger.WarnContext(ctx, "coupon usage not released", "code", redemption.CouponCode, "error", err)
+		return
+	}
+	// A coupon created after the redemption is a new one reusing the code.
+	if coupon.CreatedAt.After(redemption.CreatedAt) {
+		return
+	}
+
+	if err := s.repo.AddUsage(ctx, coupon.ID, -redemptions, -discount); err != nil {
+		s.logger.ErrorContext(ctx, "failed to update coupon usage", "code", coupon.Code, "error", err)
+	}
+	if coupon.MaxTotalUsage > 0 || coupon.Budget > 0 {
+		if err := s.usage.Release(ctx, coupon, redemptions, discount); err != nil {
+			s.logger.ErrorContext(ctx, "failed to release coupon usage", "code", coupon.Code, "error", err)
+		}
+	}
+}
+
+// evaluateCoupon checks the coupon against the request. blackouts are the
+// tenant-wide blackouts in effect now or later.
+func (s *couponService) evaluateCoupon(coupon *domain.Coupon, req domain.CouponValidationRequest, blackouts []domain.Blackout) *domain.CouponValidationResponse {
+	now := time.Now()
+	switch coupon.Status(now) {
+	case domain.StatusActive:
+	case domain.StatusExpired:
 		return &domain.CouponValidationResponse{
 			IsValid: false,
 			Message: "Coupon has expired",
-		}, nil
+			Reason:  domain.ReasonExpired,
+		}
+	case domain.StatusScheduled:
+		response := &domain.CouponValidationResponse{
+			IsValid: false,
+			Message: "Coupon will not become valid before it expires",
+			Reason:  domain.ReasonNotStarted,
+		}
+		if next, ok := coupon.NextValidAt(now); ok {
+			response.Message = fmt.Sprintf("Coupon is not valid until %s", next.UTC().Format(time.RFC3339))
+			response.NextValidAt = &next
+		}
+		return response
+	case domain.StatusPaused:
+		return &domain.CouponValidationResponse{
+			IsValid: false,
+			Message: "Coupon is paused",
+			Reason:  domain.ReasonPaused,
+		}
+	case domain.StatusExhausted:
+		return &domain.CouponValidationResponse{
+			IsValid: false,
+			Message: "Coupon has reached its redemption limit",
+			Reason:  domain.ReasonExhausted,
+		}
+	default:
+		return &domain.CouponValidationResponse{
+			IsValid: false,
+			Message: "Coupon is not active",
+			Reason:  domain.ReasonNotActive,
+		}
+	}
+
+	if blackout := blackoutAt(coupon, blackouts, now); blackout != nil {
+		response := &domain.CouponValidationResponse{
+			IsValid: false,
+			Message: fmt.Sprintf("Coupon cannot be used during %s", blackout.Name),
+			Reason:  domain.ReasonBlackout,
+		}
+		// Back-to-back blackouts are skipped, so the coupon really is valid
+		// at next.
+		next, ok := coupon.NextValidAt(blackout.EndsAt)
+		for ok {
+			covering := blackoutAt(coupon, blackouts, next)
+			if covering == nil {
+				break
+			}
+			next, ok = coupon.NextValidAt(covering.EndsAt)
+		}
+		if ok {
+			response.Message = fmt.Sprintf("Coupon cannot be used during %s, until %s", blackout.Name, next.UTC().Format(time.RFC3339))
+			response.NextValidAt = &next
+		}
+		return response
+	}
+
+	if !coupon.InSchedule(now) {
+		response := &domain.CouponValidationResponse{
+			IsValid: false,
+			Message: fmt.Sprintf("Coupon is only valid %s and will not be valid again before it expires", coupon.Schedule),
+			Reason:  domain.ReasonOutsideSchedule,
+		}
+		if next, ok := coupon.NextValidAt(now); ok {
+			response.Message = fmt.Sprintf("Coupon is only valid %s; it is next valid from %s",
+				coupon.Schedule, next.In(coupon.Schedule.Location()).Format("Mon 2 Jan 2006 15:04 MST"))
+			response.NextValidAt = &next
+		}
+		return response
+	}
+
+	if req.Currency != "" && req.Currency != coupon.Currency {
+		return &domain.CouponValidationResponse{
+			IsValid: false,
+			Message: fmt.Sprintf("Coupon is only valid for orders in %s", coupon.Currency),
+			Reason:  domain.ReasonCurrencyMismatch,
+		}
 	}
 
 	if req.OrderValue < coupon.MinOrderValue {
 		return &domain.CouponValidationResponse{
 			IsValid: false,
 			Message: "Order value is below minimum required",
-		}, nil
+			Reason:  domain.ReasonBelowMinimum,
+		}
 	}
 
 	if len(coupon.ApplicableMedicineIDs) > 0 {
@@ -127,7 +479,8 @@ func (s *couponService) ValidateCoupon(ctx context.Context, req domain.CouponVal
 			return &domain.CouponValidationResponse{
 				IsValid: false,
 				Message: "No applicable medicines in cart",
-			}, nil
+				Reason:  domain.ReasonNoApplicableMedicine,
+			}
 		}
 	}
 
@@ -148,21 +501,128 @@ func (s *couponService) ValidateCoupon(ctx context.Context, req domain.CouponVal
 			return &domain.CouponValidationResponse{
 				IsValid: false,
 				Message: "No applicable categories in cart",
-			}, nil
+				Reason:  domain.ReasonNoApplicableCategory,
+			}
 		}
 	}
 
-	var discount float64
-	if coupon.DiscountType == "percentage" {
-		discount = req.OrderValue * (coupon.DiscountValue / 100)
-	} else {
-		discount = coupon.DiscountValue
+	response := &domain.CouponValidationResponse{
+		IsValid:  true,
+		Message:  "Coupon is valid",
+		Currency: coupon.Currency,
+	}
+	discountValue := coupon.DiscountValue
+	if len(coupon.Tiers) > 0 {
+		applied, next := coupon.Tiers.At(req.OrderValue)
+		if next != nil {
+			response.NextTier = next
+			response.AmountToNextTier = next.MinOrderValue - req.OrderValue
+		}
+		if applied == nil {
+			response.IsValid = false
+			response.Message = fmt.Sprintf("Spend %s more to unlock this coupon", response.AmountToNextTier.StringFixed())
+			response.Reason = domain.ReasonBelowMinimum
+			return response
+		}
+		response.AppliedTier = applied
+		discountValue = applied.DiscountValue
 	}
 
-	return &domain.CouponValidationResponse{
-		IsValid:     true,
-		Message:     "Coupon is valid",
-		Discount:    discount,
-		FinalAmount: req.OrderValue - discount,
-	}, nil
+	var discount domain.Money
+	switch coupon.DiscountType {
+	case domain.Percentage:
+		discount = req.OrderValue.Percent(discountValue, domain.RoundHalfUp)
+	case domain.Fixed:
+		discount = discountValue
+	case domain.PerUnit, domain.BuyXGetY:
+		units := eligibleUnits(coupon, req.Items)
+		if units == 0 {
+			return &domain.CouponValidationResponse{
+				IsValid: false,
+				Message: "No items in the cart are eligible for this coupon",
+				Reason:  domain.ReasonNoEligibleItems,
+			}
+		}
+		if needed := minimumUnits(coupon); units < needed {
+			return &domain.CouponValidationResponse{
+				IsValid: false,
+				Message: fmt.Sprintf("Add %d more eligible items to get %d free", needed-units, coupon.GetQuantity),
+				Reason:  domain.ReasonNotEnoughItems,
+			}
+		}
+		response.ItemDiscounts = itemDiscounts(coupon, req.Items)
+		for _, item := range response.ItemDiscounts {
+			discount += item.Discount
+		}
+	}
+	if remaining := coupon.RemainingBudget(); remaining != nil && *remaining < discount {
+		discount = *remaining
+	}
+	if response.ItemDiscounts != nil {
+		capItemDiscounts(response.ItemDiscounts, discount)
+	} else if len(req.Items) > 0 {
+		response.ItemDiscounts = splitDiscount(coupon, req.Items, discount)
+	}
+
+	response.Discount = discount
+	response.FinalAmount = req.OrderValue - discount
+	if response.NextTier != nil {
+		response.Message = fmt.Sprintf("Coupon is valid; spend %s more for a bigger discount", response.AmountToNextTier.StringFixed())
+	}
+	return response
+}
+
+// recordDecision reports a validation or redemption outcome to the span,
+// metrics and log.
+func (s *couponService) recordDecision(ctx context.Context, span trace.Span, operation string, req domain.CouponValidationRequest, response *domain.CouponValidationResponse) {
+	span.SetAttributes(attribute.Bool("coupon.valid", response.IsValid))
+	if response.Reason != "" {
+		span.SetAttributes(attribute.String("coupon.reason", response.Reason))
+	}
+	s.metrics.ObserveValidation(operation, response.IsValid, response.Reason)
+	s.logger.InfoContext(ctx, "coupon "+operation+" decision",
+		"operation", operation,
+		"code", req.Code,
+		"user_id", req.UserID,
+		"order_value", req.OrderValue,
+		"valid", response.IsValid,
+		"reason", response.Reason,
+		"discount", response.Discount,
+	)
+}
+
+// blackoutAt returns the coupon's own or tenant-wide blackout covering now.
+// When several do, it returns the one that ends last.
+func blackoutAt(coupon *domain.Coupon, blackouts []domain.Blackout, now time.Time) *domain.BlackoutPeriod {
+	var latest *domain.BlackoutPeriod
+	check := func(period *domain.BlackoutPeriod) {
+		if period.Covers(now) && (latest == nil || period.EndsAt.After(latest.EndsAt)) {
+			latest = period
+		}
+	}
+	for i := range coupon.Blackouts {
+		check(&coupon.Blackouts[i])
+	}
+	for i := range blackouts {
+		check(&blackouts[i].BlackoutPeriod)
+	}
+	return latest
+}
+
+// createRedemption records the redemption, or returns false if the user has
+// already redeemed the coupon as many times as it allows.
+func (s *couponService) createRedemption(ctx context.Context, coupon *domain.Coupon, redemption *domain.Redemption) (bool, error) {
+	if limit := usageLimit(coupon); limit > 0 {
+		return s.redemptions.CreateWithinLimit(ctx, redemption, limit)
+	}
+	return true, s.redemptions.Create(ctx, redemption)
+}
+
+// usageLimit returns how many times a single user may redeem the coupon, or 0
+// when there is no limit.
+func usageLimit(coupon *domain.Coupon) int {
+	if coupon.UsageType == domain.OneTime {
+		return 1
+	}
+	return coupon.MaxUsagePerUser
 }
@@ -0,0 +1,496 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/farmako/coupon-system/internal/repository"
+	"github.com/google/uuid"
+)
+
+// ApprovalPolicy decides which coupons need a second person to approve them
+// before they go live. A zero threshold disables the check for that discount type.
+type ApprovalPolicy struct {
+	PercentageThreshold domain.Money `yaml:"percentage_threshold"`
+	FixedThreshold      domain.Money `yaml:"fixed_threshold"`
+}
+
+// RequiresApproval reports whether the coupon's largest discount exceeds the
+// threshold for its discount type. A buy_x_get_y coupon is held to the
+// percentage threshold by the share of each group that is free, e.g. 50% for
+// buy one get one.
+func (p ApprovalPolicy) RequiresApproval(coupon *domain.Coupon) bool {
+	switch coupon.DiscountType {
+	case domain.Percentage:
+		return p.PercentageThreshold > 0 && coupon.MaxDiscountValue() > p.PercentageThreshold
+	case domain.Fixed, domain.PerUnit:
+		return p.FixedThreshold > 0 && coupon.MaxDiscountValue() > p.FixedThreshold
+	case domain.BuyXGetY:
+		group := coupon.BuyQuantity + coupon.GetQuantity
+		if p.PercentageThreshold == 0 || group <= 0 {
+			return false
+		}
+		freeShare := domain.MoneyFromInt(100).MulRatio(int64(coupon.GetQuantity), int64(group), domain.RoundUp)
+		return freeShare > p.PercentageThreshold
+	default:
+		return false
+	}
+}
+
+type CouponAdminService interface {
+	ListCoupons(ctx context.Context) ([]domain.Coupon, error)
+	SearchCoupons(ctx context.Context, query repository.CouponQuery) (*repository.CouponPage, error)
+	GetCoupon(ctx context.Context, code string) (*domain.Coupon, error)
+	CreateCoupon(ctx context.Context, coupon *domain.Coupon) (*domain.Coupon, error)
+	UpdateCoupon(ctx context.Context, code string, coupon *domain.Coupon) (*domain.Coupon, error)
+	DeleteCoupon(ctx context.Context, code string) error
+	ApproveCoupon(ctx context.Context, code string) (*domain.Coupon, error)
+	PublishCoupon(ctx context.Context, code string) (*domain.Coupon, error)
+	PauseCoupon(ctx context.Context, code string) (*domain.Coupon, error)
+	ResumeCoupon(ctx context.Context, code string) (*domain.Coupon, error)
+	SetCouponBlackouts(ctx context.Context, code string, blackouts domain.BlackoutPeriods) (*domain.Coupon, error)
+	ListRedemptions(ctx context.Context, filter repository.RedemptionFilter) ([]domain.Redemption, error)
+	ImportCoupons(ctx context.Context, rows []domain.CouponImportRow, dryRun bool) (*domain.CouponImportResult, error)
+}
+
+const (
+	// MaxImportRows bounds a single ImportCoupons call.
+	MaxImportRows   = 50000
+	importBatchSize = 1000
+)
+
+type couponAdminService struct {
+	repo        repository.CouponRepository
+	redemptions repository.RedemptionRepository
+	usage       UsageCounter
+	policy      ApprovalPolicy
+	logger      *slog.Logger
+}
+
+func NewCouponAdminService(repo repository.CouponRepository, redemptions repository.RedemptionRepository, usage UsageCounter, policy ApprovalPolicy, logger *slog.Logger) CouponAdminService {
+	return &couponAdminService{
+		repo:        repo,
+		redemptions: redemptions,
+		usage:       usage,
+		policy:      policy,
+		logger:      logger,
+	}
+}
+
+func (s *couponAdminService) ListCoupons(ctx context.Context) ([]domain.Coupon, error) {
+	return s.repo.FindAll(ctx)
+}
+
+// SearchCoupons returns one page of the coupons matching query.
+func (s *couponAdminService) SearchCoupons(ctx context.Context, query repository.CouponQuery) (*repository.CouponPage, error) {
+	return s.repo.List(ctx, query)
+}
+
+func (s *couponAdminService) GetCoupon(ctx context.Context, code string) (*domain.Coupon, error) {
+	return s.repo.FindByCode(ctx, code)
+}
+
+func (s *couponAdminService) CreateCoupon(ctx context.Context, coupon *domain.Coupon) (*domain.Coupon, error) {
+	if err := validateCoupon(coupon); err != nil {
+		return nil, err
+	}
+
+	_, err := s.repo.FindByCode(ctx, coupon.Code)
+	if err == nil {
+		return nil, &domain.ConflictError{Reason: fmt.Sprintf("coupon %s already exists", coupon.Code)}
+	}
+	if _, ok := err.(*domain.CouponNotFoundError); !ok {
+		return nil, err
+	}
+
+	coupon.ID = uuid.New()
+	coupon.CreatedBy = actorID(ctx)
+	coupon.Paused = false
+	coupon.RedemptionCount = 0
+	coupon.DiscountSpent = 0
+	s.applyApprovalPolicy(ctx, coupon)
+
+	if err := s.repo.Create(ctx, coupon); err != nil {
+		return nil, err
+	}
+	s.logChange(ctx, "coupon created", coupon)
+	return coupon, nil
+}
+
+// UpdateCoupon replaces the editable fields of an existing coupon. Raising the
+// discount above the approval threshold sends the coupon back for approval.
+// Changing the usage caps or expiry resets the shared usage counters, which
+// are seeded again from the database on the next redemption.
+func (s *couponAdminService) UpdateCoupon(ctx context.Context, code string, coupon *domain.Coupon) (*domain.Coupon, error) {
+	existing, err := s.repo.FindByCode(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	coupon.Code = existing.Code
+	if err := validateCoupon(coupon); err != nil {
+		return nil, err
+	}
+
+	coupon.ID = existing.ID
+	coupon.CreatedAt = existing.CreatedAt
+	coupon.CreatedBy = existing.CreatedBy
+	coupon.ApprovalStatus = existing.ApprovalStatus
+	coupon.ApprovalRequestedBy = existing.ApprovalRequestedBy
+	coupon.ApprovedBy = existing.ApprovedBy
+	coupon.ApprovedAt = existing.ApprovedAt
+	coupon.Draft = existing.Draft
+	coupon.Paused = existing.Paused
+	coupon.RedemptionCount = existing.RedemptionCount
+	coupon.DiscountSpent = existing.DiscountSpent
+	if coupon.DiscountType != existing.DiscountType || coupon.MaxDiscountValue() != existing.MaxDiscountValue() ||
+		coupon.BuyQuantity != existing.BuyQuantity || coupon.GetQuantity != existing.GetQuantity {
+		s.applyApprovalPolicy(ctx, coupon)
+	}
+
+	if err := s.repo.Update(ctx, coupon); err != nil {
+		return nil, err
+	}
+	// Redemptions made while a cap was removed were not counted, and the
+	// counters expire relative to the expiry they were seeded with.
+	if coupon.MaxTotalUsage != existing.MaxTotalUsage || coupon.Budget != existing.Budget || !coupon.ExpiryDate.Equal(existing.ExpiryDate) {
+		if err := s.usage.Reset(ctx, coupon); err != nil {
+			s.logger.ErrorContext(ctx, "failed to reset coupon usage", "code", coupon.Code, "error", err)
+		}
+	}
+	s.logChange(ctx, "coupon updated", coupon)
+	return coupon, nil
+}
+
+func (s *couponAdminService) DeleteCoupon(ctx context.Context, code string) error {
+	coupon, err := s.repo.FindByCode(ctx, code)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Delete(ctx, code); err != nil {
+		return err
+	}
+	s.logChange(ctx, "coupon deleted", coupon)
+	return nil
+}
+
+// ApproveCoupon activates a coupon that is pending approval. The approver must
+// be a different principal from the one whose change required the approval.
+func (s *couponAdminService) ApproveCoupon(ctx context.Context, code string) (*domain.Coupon, error) {
+	coupon, err := s.repo.FindByCode(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	if coupon.IsApproved() {
+		return nil, &domain.ConflictError{Reason: fmt.Sprintf("coupon %s is not pending approval", code)}
+	}
+
+	approver := actorID(ctx)
+	if approver == "" || approver == coupon.ApprovalRequestedBy {
+		return nil, &domain.ForbiddenError{Reason: "coupon must be approved by someone other than its author"}
+	}
+
+	now := time.Now()
+	coupon.ApprovalStatus = domain.Approved
+	coupon.ApprovedBy = approver
+	coupon.ApprovedAt = &now
+
+	if err := s.repo.Update(ctx, coupon); err != nil {
+		return nil, err
+	}
+	s.logChange(ctx, "coupon approved", coupon)
+	return coupon, nil
+}
+
+// PublishCoupon takes a coupon out of draft. It goes live at its start date,
+// once approved if it needs approval.
+func (s *couponAdminService) PublishCoupon(ctx context.Context, code string) (*domain.Coupon, error) {
+	coupon, err := s.repo.FindByCode(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if !coupon.Draft {
+		return nil, &domain.ConflictError{Reason: fmt.Sprintf("coupon %s is not a draft", code)}
+	}
+
+	coupon.Draft = false
+	if err := s.repo.Update(ctx, coupon); err != nil {
+		return nil, err
+	}
+	s.logChange(ctx, "coupon published", coupon)
+	return coupon, nil
+}
+
+// PauseCoupon stops a coupon from being offered or redeemed until it is
+// resumed. Its redemption history is kept.
+func (s *couponAdminService) PauseCoupon(ctx context.Context, code string) (*domain.Coupon, error) {
+	coupon, err := s.repo.FindByCode(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case coupon.Paused:
+		return nil, &domain.ConflictError{Reason: fmt.Sprintf("coupon %s is already paused", code)}
+	case coupon.Draft:
+		return nil, &domain.ConflictError{Reason: fmt.Sprintf("coupon %s is a draft and has not been published", code)}
+	}
+
+	coupon.Paused = true
+	if err := s.repo.Update(ctx, coupon); err != nil {
+		return nil, err
+	}
+	s.logChange(ctx, "coupon paused", coupon)
+	return coupon, nil
+}
+
+// ResumeCoupon lets a paused coupon be offered and redeemed again. It must
+// still be approved and within its dates to be live.
+func (s *couponAdminService) ResumeCoupon(ctx context.Context, code string) (*domain.Coupon, error) {
+	coupon, err := s.repo.FindByCode(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if !coupon.Paused {
+		return nil, &domain.ConflictError{Reason: fmt.Sprintf("coupon %s is not paused", code)}
+	}
+
+	coupon.Paused = false
+	if err := s.repo.Update(ctx, coupon); err != nil {
+		return nil, err
+	}
+	s.logChange(ctx, "coupon resumed", coupon)
+	return coupon, nil
+}
+
+// SetCouponBlackouts replaces the coupon's own blackout periods. Blackouts
+// only restrict a coupon, so changing them does not need approval.
+func (s *couponAdminService) SetCouponBlackouts(ctx context.Context, code string, blackouts domain.BlackoutPeriods) (*domain.Coupon, error) {
+	coupon, err := s.repo.FindByCode(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	coupon.Blackouts = blackouts
+	if err := validateCoupon(coupon); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Update(ctx, coupon); err != nil {
+		return nil, err
+	}
+	s.logChange(ctx, "coupon blackouts updated", coupon)
+	return coupon, nil
+}
+
+func (s *couponAdminService) ListRedemptions(ctx context.Context, filter repository.RedemptionFilter) ([]domain.Redemption, error) {
+	return s.redemptions.List(ctx, filter)
+}
+
+// ImportCoupons validates every row and, unless dryRun is set, creates all of
+// the coupons in one transaction. Nothing is created if any row has an error;
+// the errors are reported in the result rather than returned.
+func (s *couponAdminService) ImportCoupons(ctx context.Context, rows []domain.CouponImportRow, dryRun bool) (*domain.CouponImportResult, error) {
+	if len(rows) == 0 {
+		return nil, &domain.InvalidRequestError{Reason: "no coupons to import"}
+	}
+	if len(rows) > MaxImportRows {
+		return nil, &domain.InvalidRequestError{Reason: fmt.Sprintf("at most %d coupons can be imported at once", MaxImportRows)}
+	}
+
+	result := &domain.CouponImportResult{DryRun: dryRun, Rows: len(rows)}
+	reject := func(row *domain.CouponImportRow, reason string) {
+		result.Errors = append(result.Errors, domain.CouponImportError{Line: row.Line, Code: row.Coupon.Code, Error: reason})
+	}
+
+	firstLine := make(map[string]int, len(rows))
+	valid := make([]*domain.CouponImportRow, 0, len(rows))
+	for i := range rows {
+		row := &rows[i]
+		if row.ParseError != "" {
+			reject(row, row.ParseError)
+			continue
+		}
+		if err := validateCoupon(&row.Coupon); err != nil {
+			reject(row, err.Error())
+			continue
+		}
+		if line, ok := firstLine[row.Coupon.Code]; ok {
+			reject(row, fmt.Sprintf("duplicate code, also on line %d", line))
+			continue
+		}
+		firstLine[row.Coupon.Code] = row.Line
+		valid = append(valid, row)
+	}
+
+	existing := make(map[string]bool)
+	for start := 0; start < len(valid); start += importBatchSize {
+		end := min(start+importBatchSize, len(valid))
+		codes := make([]string, 0, end-start)
+		for _, row := range valid[start:end] {
+			codes = append(codes, row.Coupon.Code)
+		}
+		taken, err := s.repo.ExistingCodes(ctx, codes)
+		if err != nil {
+			return nil, err
+		}
+		for _, code := range taken {
+			existing[code] = true
+		}
+	}
+
+	coupons := make([]domain.Coupon, 0, len(valid))
+	for _, row := range valid {
+		if existing[row.Coupon.Code] {
+			reject(row, fmt.Sprintf("coupon %s already exists", row.Coupon.Code))
+			continue
+		}
+		coupon := row.Coupon
+		coupon.ID = uuid.New()
+		coupon.CreatedBy = actorID(ctx)
+		s.applyApprovalPolicy(ctx, &coupon)
+		if !coupon.IsApproved() {
+			result.PendingApproval++
+		}
+		coupons = append(coupons, coupon)
+	}
+	result.Valid = len(coupons)
+	sort.SliceStable(result.Errors, func(i, j int) bool {
+		return result.Errors[i].Line < result.Errors[j].Line
+	})
+
+	if dryRun || len(result.Errors) > 0 {
+		return result, nil
+	}
+
+	if err := s.repo.CreateBatch(ctx, coupons, importBatchSize); err != nil {
+		return nil, err
+	}
+	result.Imported = len(coupons)
+	s.logger.InfoContext(ctx, "coupons imported",
+		"actor", actorID(ctx),
+		"count", result.Imported,
+		"pending_approval", result.PendingApproval,
+	)
+	return result, nil
+}
+
+func (s *couponAdminService) logChange(ctx context.Context, msg string, coupon *domain.Coupon) {
+	s.logger.InfoContext(ctx, msg,
+		"code", coupon.Code,
+		"actor", actorID(ctx),
+		"approval_status", coupon.ApprovalStatus,
+		"status", coupon.Status(time.Now()),
+	)
+}
+
+func (s *couponAdminService) applyApprovalPolicy(ctx context.Context, coupon *domain.Coupon) {
+	coupon.ApprovedBy = ""
+	coupon.ApprovedAt = nil
+	if s.policy.RequiresApproval(coupon) {
+		coupon.ApprovalStatus = domain.PendingApproval
+		coupon.ApprovalRequestedBy = actorID(ctx)
+	} else {
+		coupon.ApprovalStatus = domain.Approved
+		coupon.ApprovalRequestedBy = ""
+	}
+}
+
+// validateCoupon checks the coupon's rules, filling in the default currency
+// if it has none.
+func validateCoupon(coupon *domain.Coupon) error {
+	if coupon.Code == "" {
+		return &domain.InvalidRequestError{Reason: "code is required"}
+	}
+	if coupon.Currency == "" {
+		coupon.Currency = domain.DefaultCurrency
+	}
+	if !domain.ValidCurrency(coupon.Currency) {
+		return &domain.InvalidRequestError{Reason: fmt.Sprintf("invalid currency: %q", coupon.Currency)}
+	}
+
+	switch coupon.UsageType {
+	case domain.OneTime, domain.MultiUse, domain.TimeBased:
+	default:
+		return &domain.InvalidRequestError{Reason: fmt.Sprintf("invalid usage_type: %q", coupon.UsageType)}
+	}
+
+	switch coupon.DiscountType {
+	case domain.Percentage, domain.Fixed, domain.PerUnit, domain.BuyXGetY:
+	default:
+		return &domain.InvalidRequestError{Reason: fmt.Sprintf("invalid discount_type: %q", coupon.DiscountType)}
+	}
+	if coupon.DiscountType != domain.BuyXGetY && (coupon.BuyQuantity != 0 || coupon.GetQuantity != 0) {
+		return &domain.InvalidRequestError{Reason: "buy_quantity and get_quantity only apply to buy_x_get_y coupons"}
+	}
+	switch {
+	case len(coupon.Tiers) > 0:
+		if coupon.DiscountType != domain.Percentage && coupon.DiscountType != domain.Fixed {
+			return &domain.InvalidRequestError{Reason: "tiers are only supported for percentage and fixed discounts"}
+		}
+		if coupon.DiscountValue != 0 {
+			return &domain.InvalidRequestError{Reason: "discount_value must not be set on a coupon with tiers"}
+		}
+		if err := coupon.Tiers.Validate(coupon.DiscountType); err != nil {
+			return &domain.InvalidRequestError{Reason: fmt.Sprintf("tiers: %v", err)}
+		}
+	case coupon.DiscountType == domain.Percentage:
+		if coupon.DiscountValue <= 0 || coupon.DiscountValue > domain.MoneyFromInt(100) {
+			return &domain.InvalidRequestError{Reason: "percentage discount_value must be between 0 and 100"}
+		}
+	case coupon.DiscountType == domain.BuyXGetY:
+		if coupon.BuyQuantity <= 0 || coupon.GetQuantity <= 0 {
+			return &domain.InvalidRequestError{Reason: "buy_quantity and get_quantity must be positive"}
+		}
+		if coupon.DiscountValue != 0 {
+			return &domain.InvalidRequestError{Reason: "discount_value must not be set on a buy_x_get_y coupon"}
+		}
+	case coupon.DiscountValue <= 0:
+		return &domain.InvalidRequestError{Reason: fmt.Sprintf("%s discount_value must be positive", coupon.DiscountType)}
+	}
+
+	if coupon.MinOrderValue < 0 {
+		return &domain.InvalidRequestError{Reason: "min_order_value must not be negative"}
+	}
+	if coupon.MaxUsagePerUser < 0 {
+		return &domain.InvalidRequestError{Reason: "max_usage_per_user must not be negative"}
+	}
+	if coupon.MaxTotalUsage < 0 {
+		return &domain.InvalidRequestError{Reason: "max_total_usage must not be negative"}
+	}
+	if coupon.Budget < 0 {
+		return &domain.InvalidRequestError{Reason: "budget must not be negative"}
+	}
+	if coupon.ExpiryDate.IsZero() {
+		return &domain.InvalidRequestError{Reason: "expiry_date is required"}
+	}
+	if coupon.StartDate != nil && !coupon.ExpiryDate.After(*coupon.StartDate) {
+		return &domain.InvalidRequestError{Reason: "expiry_date must be after start_date"}
+	}
+	if coupon.ValidTimeWindow != nil && !coupon.ValidTimeWindow.EndTime.After(coupon.ValidTimeWindow.StartTime) {
+		return &domain.InvalidRequestError{Reason: "valid_time_window end_time must be after start_time"}
+	}
+	if coupon.Schedule != nil {
+		if err := coupon.Schedule.Validate(); err != nil {
+			return &domain.InvalidRequestError{Reason: fmt.Sprintf("schedule: %v", err)}
+		}
+	}
+	for i := range coupon.Blackouts {
+		if err := coupon.Blackouts[i].Validate(); err != nil {
+			return &domain.InvalidRequestError{Reason: fmt.Sprintf("blackouts[%d]: %v", i, err)}
+		}
+	}
+
+	return nil
+}
+
+// actorID identifies the principal performing an admin operation.
+func actorID(ctx context.Context) string {
+	if principal := domain.PrincipalFromContext(ctx); principal != nil {
+		return principal.ID
+	}
+	return ""
+}
@@ -0,0 +1,419 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/farmako/coupon-system/internal/logging"
+	"github.com/farmako/coupon-system/internal/repository"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCouponRepository is an in-memory CouponRepository keyed by tenant and code.
+type fakeCouponRepository struct {
+	coupons map[string]domain.Coupon
+}
+
+func fakeCouponKey(ctx context.Context, code string) string {
+	return domain.TenantFromContext(ctx) + "/" + code
+}
+
+func newFakeCouponRepository() *fakeCouponRepository {
+	return &fakeCouponRepository{coupons: make(map[string]domain.Coupon)}
+}
+
+func (r *fakeCouponRepository) FindByCode(ctx context.Context, code string) (*domain.Coupon, error) {
+	coupon, ok := r.coupons[fakeCouponKey(ctx, code)]
+	if !ok {
+		return nil, &domain.CouponNotFoundError{Code: code}
+	}
+	return &coupon, nil
+}
+
+func (r *fakeCouponRepository) FindAll(ctx context.Context) ([]domain.Coupon, error) {
+	coupons := make([]domain.Coupon, 0, len(r.coupons))
+	for _, coupon := range r.coupons {
+		if coupon.TenantID == domain.TenantFromContext(ctx) {
+			coupons = append(coupons, coupon)
+		}
+	}
+	return coupons, nil
+}
+
+// List ignores the query beyond its limit.
+func (r *fakeCouponRepository) List(ctx context.Context, query repository.CouponQuery) (*repository.CouponPage, error) {
+	coupons, _ := r.FindAll(ctx)
+	sort.Slice(coupons, func(i, j int) bool { return coupons[i].Code < coupons[j].Code })
+	if query.Limit > 0 && len(coupons) > query.Limit {
+		coupons = coupons[:query.Limit]
+	}
+	return &repository.CouponPage{Coupons: coupons}, nil
+}
+
+func (r *fakeCouponRepository) Create(ctx context.Context, coupon *domain.Coupon) error {
+	coupon.TenantID = domain.TenantFromContext(ctx)
+	r.coupons[fakeCouponKey(ctx, coupon.Code)] = *coupon
+	return nil
+}
+
+func (r *fakeCouponRepository) CreateBatch(ctx context.Context, coupons []domain.Coupon, batchSize int) error {
+	for i := range coupons {
+		if err := r.Create(ctx, &coupons[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *fakeCouponRepository) ExistingCodes(ctx context.Context, codes []string) ([]string, error) {
+	var existing []string
+	for _, code := range codes {
+		if _, ok := r.coupons[fakeCouponKey(ctx, code)]; ok {
+			existing = append(existing, code)
+		}
+	}
+	return existing, nil
+}
+
+func (r *fakeCouponRepository) CodesByCampaign(ctx context.Context, campaignID uuid.UUID) ([]string, error) {
+	var codes []string
+	for _, coupon := range r.coupons {
+		if coupon.TenantID == domain.TenantFromContext(ctx) && coupon.CampaignID != nil && *coupon.CampaignID == campaignID {
+			codes = append(codes, coupon.Code)
+		}
+	}
+	sort.Strings(codes)
+	return codes, nil
+}
+
+// Update keeps the stored usage counters, like the real repository.
+func (r *fakeCouponRepository) Update(ctx context.Context, coupon *domain.Coupon) error {
+	coupon.TenantID = domain.TenantFromContext(ctx)
+	stored := *coupon
+	if existing, ok := r.coupons[fakeCouponKey(ctx, coupon.Code)]; ok {
+		stored.RedemptionCount = existing.RedemptionCount
+		stored.DiscountSpent = existing.DiscountSpent
+	}
+	r.coupons[fakeCouponKey(ctx, coupon.Code)] = stored
+	return nil
+}
+
+func (r *fakeCouponRepository) AddUsage(ctx context.Context, id uuid.UUID, redemptions int, discount domain.Money) error {
+	for key, coupon := range r.coupons {
+		if coupon.TenantID == domain.TenantFromContext(ctx) && coupon.ID == id {
+			coupon.RedemptionCount += redemptions
+			coupon.DiscountSpent += discount
+			r.coupons[key] = coupon
+		}
+	}
+	return nil
+}
+
+func (r *fakeCouponRepository) Delete(ctx context.Context, code string) error {
+	delete(r.coupons, fakeCouponKey(ctx, code))
+	return nil
+}
+
+func asPrincipal(id string) context.Context {
+	return domain.ContextWithPrincipal(context.Background(), &domain.Principal{ID: id})
+}
+
+// newTestCoupon returns a coupon giving value whole units, or value percent.
+func newTestCoupon(code string, discountType domain.DiscountType, value int64) *domain.Coupon {
+	return &domain.Coupon{
+		Code:          code,
+		ExpiryDate:    time.Now().Add(24 * time.Hour),
+		UsageType:     domain.MultiUse,
+		DiscountType:  discountType,
+		DiscountValue: domain.MoneyFromInt(value),
+	}
+}
+
+func TestCouponApproval(t *testing.T) {
+	policy := ApprovalPolicy{PercentageThreshold: domain.MoneyFromInt(50), FixedThreshold: domain.MoneyFromInt(500)}
+
+	t.Run("coupons within the threshold are approved immediately", func(t *testing.T) {
+		svc := NewCouponAdminService(newFakeCouponRepository(), newFakeRedemptionRepository(), newFakeUsageCounter(), policy, logging.Discard())
+
+		coupon, err := svc.CreateCoupon(asPrincipal("marketer"), newTestCoupon("SAVE10", domain.Percentage, 10))
+		require.NoError(t, err)
+		assert.Equal(t, domain.Approved, coupon.ApprovalStatus)
+		assert.Equal(t, "marketer", coupon.CreatedBy)
+	})
+
+	t.Run("coupons above the threshold need a second approver", func(t *testing.T) {
+		repo := newFakeCouponRepository()
+		svc := NewCouponAdminService(repo, newFakeRedemptionRepository(), newFakeUsageCounter(), policy, logging.Discard())
+
+		coupon, err := svc.CreateCoupon(asPrincipal("marketer"), newTestCoupon("SAVE90", domain.Percentage, 90))
+		require.NoError(t, err)
+		assert.Equal(t, domain.PendingApproval, coupon.ApprovalStatus)
+
+		_, err = svc.ApproveCoupon(asPrincipal("marketer"), "SAVE90")
+		assert.IsType(t, &domain.ForbiddenError{}, err)
+
+		coupon, err = svc.ApproveCoupon(asPrincipal("admin"), "SAVE90")
+		require.NoError(t, err)
+		assert.Equal(t, domain.Approved, coupon.ApprovalStatus)
+		assert.Equal(t, "admin", coupon.ApprovedBy)
+
+		_, err = svc.ApproveCoupon(asPrincipal("admin"), "SAVE90")
+		assert.IsType(t, &domain.ConflictError{}, err)
+	})
+
+	t.Run("raising the discount requires approval again", func(t *testing.T) {
+		svc := NewCouponAdminService(newFakeCouponRepository(), newFakeRedemptionRepository(), newFakeUsageCounter(), policy, logging.Discard())
+
+		_, err := svc.CreateCoupon(asPrincipal("marketer"), newTestCoupon("FLAT100", domain.Fixed, 100))
+		require.NoError(t, err)
+
+		coupon, err := svc.UpdateCoupon(asPrincipal("other-marketer"), "FLAT100", newTestCoupon("", domain.Fixed, 1000))
+		require.NoError(t, err)
+		assert.Equal(t, domain.PendingApproval, coupon.ApprovalStatus)
+		assert.Equal(t, "other-marketer", coupon.ApprovalRequestedBy)
+		assert.Equal(t, "marketer", coupon.CreatedBy)
+	})
+
+	t.Run("buy x get y coupons are held to the percentage threshold by their free share", func(t *testing.T) {
+		svc := NewCouponAdminService(newFakeCouponRepository(), newFakeRedemptionRepository(), newFakeUsageCounter(), policy, logging.Discard())
+		bogo := func(buy, get int) *domain.Coupon {
+			coupon := newTestCoupon("BOGO", domain.BuyXGetY, 0)
+			coupon.BuyQuantity = buy
+			coupon.GetQuantity = get
+			return coupon
+		}
+
+		coupon, err := svc.CreateCoupon(asPrincipal("marketer"), bogo(1, 1))
+		require.NoError(t, err)
+		assert.Equal(t, domain.Approved, coupon.ApprovalStatus)
+
+		coupon, err = svc.UpdateCoupon(asPrincipal("marketer"), "BOGO", bogo(1, 2))
+		require.NoError(t, err)
+		assert.Equal(t, domain.PendingApproval, coupon.ApprovalStatus)
+	})
+
+	t.Run("pending coupons cannot be validated", func(t *testing.T) {
+		repo := newFakeCouponRepository()
+		admin := NewCouponAdminService(repo, newFakeRedemptionRepository(), newFakeUsageCounter(), policy, logging.Discard())
+		_, err := admin.CreateCoupon(asPrincipal("marketer"), newTestCoupon("SAVE90", domain.Percentage, 90))
+		require.NoError(t, err)
+
+		svc := NewCouponService(repo, newFakeRedemptionRepository(), newFakeBlackoutRepository(), newFakeUsageCounter(), nil, logging.Discard())
+		response, err := svc.ValidateCoupon(context.Background(), domain.CouponValidationRequest{Code: "SAVE90", OrderValue: domain.MoneyFromInt(100)})
+		require.NoError(t, err)
+		assert.False(t, response.IsValid)
+
+		coupons, err := svc.GetApplicableCoupons(context.Background(), domain.CouponRequest{OrderValue: domain.MoneyFromInt(100)})
+		require.NoError(t, err)
+		assert.Empty(t, coupons)
+	})
+
+	t.Run("paused coupons cannot be validated until resumed", func(t *testing.T) {
+		repo := newFakeCouponRepository()
+		admin := NewCouponAdminService(repo, newFakeRedemptionRepository(), newFakeUsageCounter(), policy, logging.Discard())
+		_, err := admin.CreateCoupon(asPrincipal("marketer"), newTestCoupon("SAVE10", domain.Percentage, 10))
+		require.NoError(t, err)
+
+		_, err = admin.ResumeCoupon(asPrincipal("ops"), "SAVE10")
+		assert.IsType(t, &domain.ConflictError{}, err)
+
+		coupon, err := admin.PauseCoupon(asPrincipal("ops"), "SAVE10")
+		require.NoError(t, err)
+		assert.Equal(t, domain.StatusPaused, coupon.Status(time.Now()))
+
+		_, err = admin.PauseCoupon(asPrincipal("ops"), "SAVE10")
+		assert.IsType(t, &domain.ConflictError{}, err)
+
+		coupon, err = admin.UpdateCoupon(asPrincipal("marketer"), "SAVE10", newTestCoupon("", domain.Percentage, 15))
+		require.NoError(t, err)
+		assert.True(t, coupon.Paused, "updates keep the coupon paused")
+
+		svc := NewCouponService(repo, newFakeRedemptionRepository(), newFakeBlackoutRepository(), newFakeUsageCounter(), nil, logging.Discard())
+		response, err := svc.ValidateCoupon(context.Background(), domain.CouponValidationRequest{Code: "SAVE10", OrderValue: domain.MoneyFromInt(100)})
+		require.NoError(t, err)
+		assert.False(t, response.IsValid)
+		assert.Equal(t, domain.ReasonPaused, response.Reason)
+
+		_, err = admin.ResumeCoupon(asPrincipal("ops"), "SAVE10")
+		require.NoError(t, err)
+		response, err = svc.ValidateCoupon(context.Background(), domain.CouponValidationRequest{Code: "SAVE10", OrderValue: domain.MoneyFromInt(100)})
+		require.NoError(t, err)
+		assert.True(t, response.IsValid)
+	})
+
+	t.Run("coupons are live from their start date", func(t *testing.T) {
+		repo := newFakeCouponRepository()
+		admin := NewCouponAdminService(repo, newFakeRedemptionRepository(), newFakeUsageCounter(), policy, logging.Discard())
+		svc := NewCouponService(repo, newFakeRedemptionRepository(), newFakeBlackoutRepository(), newFakeUsageCounter(), nil, logging.Discard())
+
+		start := time.Now().Add(time.Hour)
+		scheduled := newTestCoupon("LATER", domain.Percentage, 10)
+		scheduled.StartDate = &start
+		coupon, err := admin.CreateCoupon(asPrincipal("marketer"), scheduled)
+		require.NoError(t, err)
+		assert.Equal(t, domain.StatusScheduled, coupon.Status(time.Now()))
+		assert.Equal(t, domain.StatusActive, coupon.Status(start))
+
+		response, err := svc.ValidateCoupon(context.Background(), domain.CouponValidationRequest{Code: "LATER", OrderValue: domain.MoneyFromInt(100)})
+		require.NoError(t, err)
+		assert.False(t, response.IsValid)
+		assert.Equal(t, domain.ReasonNotStarted, response.Reason)
+		assert.Contains(t, response.Message, start.UTC().Format(time.RFC3339))
+
+		coupons, err := svc.GetApplicableCoupons(context.Background(), domain.CouponRequest{OrderValue: domain.MoneyFromInt(100)})
+		require.NoError(t, err)
+		assert.Empty(t, coupons)
+
+		backwards := newTestCoupon("BACKWARDS", domain.Percentage, 10)
+		late := backwards.ExpiryDate.Add(time.Hour)
+		backwards.StartDate = &late
+		_, err = admin.CreateCoupon(asPrincipal("marketer"), backwards)
+		assert.IsType(t, &domain.InvalidRequestError{}, err)
+	})
+
+	t.Run("drafts stay inactive until published", func(t *testing.T) {
+		repo := newFakeCouponRepository()
+		admin := NewCouponAdminService(repo, newFakeRedemptionRepository(), newFakeUsageCounter(), policy, logging.Discard())
+		svc := NewCouponService(repo, newFakeRedemptionRepository(), newFakeBlackoutRepository(), newFakeUsageCounter(), nil, logging.Discard())
+
+		draft := newTestCoupon("DRAFT", domain.Percentage, 10)
+		draft.Draft = true
+		_, err := admin.CreateCoupon(asPrincipal("marketer"), draft)
+		require.NoError(t, err)
+
+		_, err = admin.PauseCoupon(asPrincipal("marketer"), "DRAFT")
+		assert.IsType(t, &domain.ConflictError{}, err)
+
+		response, err := svc.ValidateCoupon(context.Background(), domain.CouponValidationRequest{Code: "DRAFT", OrderValue: domain.MoneyFromInt(100)})
+		require.NoError(t, err)
+		assert.Equal(t, domain.ReasonNotActive, response.Reason)
+
+		coupon, err := admin.PublishCoupon(asPrincipal("marketer"), "DRAFT")
+		require.NoError(t, err)
+		assert.Equal(t, domain.StatusActive, coupon.Status(time.Now()))
+
+		_, err = admin.PublishCoupon(asPrincipal("marketer"), "DRAFT")
+		assert.IsType(t, &domain.ConflictError{}, err)
+	})
+
+	t.Run("schedules restrict when coupons are valid", func(t *testing.T) {
+		repo := newFakeCouponRepository()
+		admin := NewCouponAdminService(repo, newFakeRedemptionRepository(), newFakeUsageCounter(), policy, logging.Discard())
+		svc := NewCouponService(repo, newFakeRedemptionRepository(), newFakeBlackoutRepository(), newFakeUsageCounter(), nil, logging.Discard())
+
+		opens := time.Now().UTC().Add(2 * time.Hour).Truncate(time.Minute)
+		happyHour := newTestCoupon("HAPPYHOUR", domain.Percentage, 10)
+		happyHour.Schedule = &domain.Schedule{
+			Hours: []domain.HourRange{{Start: opens.Format("15:04"), End: opens.Add(time.Hour).Format("15:04")}},
+		}
+		_, err := admin.CreateCoupon(asPrincipal("marketer"), happyHour)
+		require.NoError(t, err)
+
+		response, err := svc.ValidateCoupon(context.Background(), domain.CouponValidationRequest{Code: "HAPPYHOUR", OrderValue: domain.MoneyFromInt(100)})
+		require.NoError(t, err)
+		assert.False(t, response.IsValid)
+		assert.Equal(t, domain.ReasonOutsideSchedule, response.Reason)
+		require.NotNil(t, response.NextValidAt)
+		assert.True(t, opens.Equal(*response.NextValidAt))
+		assert.Contains(t, response.Message, opens.Format("15:04 UTC"))
+
+		coupons, err := svc.GetApplicableCoupons(context.Background(), domain.CouponRequest{OrderValue: domain.MoneyFromInt(100)})
+		require.NoError(t, err)
+		assert.Empty(t, coupons)
+
+		for name, schedule := range map[string]*domain.Schedule{
+			"unknown time zone": {TimeZone: "Mars/Olympus_Mons"},
+			"unknown day":       {Days: []domain.Weekday{"funday"}},
+			"bad hours":         {Hours: []domain.HourRange{{Start: "6pm", End: "9pm"}}},
+			"empty hours":       {Hours: []domain.HourRange{{Start: "18:00", End: "18:00"}}},
+		} {
+			invalid := newTestCoupon("INVALID", domain.Percentage, 10)
+			invalid.Schedule = schedule
+			_, err := admin.CreateCoupon(asPrincipal("marketer"), invalid)
+			assert.IsType(t, &domain.InvalidRequestError{}, err, name)
+		}
+	})
+
+	t.Run("duplicate codes are rejected", func(t *testing.T) {
+		svc := NewCouponAdminService(newFakeCouponRepository(), newFakeRedemptionRepository(), newFakeUsageCounter(), policy, logging.Discard())
+		_, err := svc.CreateCoupon(asPrincipal("marketer"), newTestCoupon("DUP", domain.Fixed, 10))
+		require.NoError(t, err)
+
+		_, err = svc.CreateCoupon(asPrincipal("marketer"), newTestCoupon("DUP", domain.Fixed, 10))
+		assert.IsType(t, &domain.ConflictError{}, err)
+	})
+}
+
+func TestImportCoupons(t *testing.T) {
+	policy := ApprovalPolicy{PercentageThreshold: domain.MoneyFromInt(50)}
+	rows := func() []domain.CouponImportRow {
+		return []domain.CouponImportRow{
+			{Line: 2, Coupon: *newTestCoupon("SAVE10", domain.Percentage, 10)},
+			{Line: 3, Coupon: *newTestCoupon("HALF", domain.Percentage, 60)},
+		}
+	}
+
+	t.Run("dry run validates without creating coupons", func(t *testing.T) {
+		repo := newFakeCouponRepository()
+		svc := NewCouponAdminService(repo, newFakeRedemptionRepository(), newFakeUsageCounter(), policy, logging.Discard())
+
+		result, err := svc.ImportCoupons(asPrincipal("marketer"), rows(), true)
+		require.NoError(t, err)
+		assert.Equal(t, 2, result.Valid)
+		assert.Equal(t, 1, result.PendingApproval)
+		assert.Zero(t, result.Imported)
+		assert.Empty(t, repo.coupons)
+	})
+
+	t.Run("valid rows are created with the approval policy applied", func(t *testing.T) {
+		repo := newFakeCouponRepository()
+		svc := NewCouponAdminService(repo, newFakeRedemptionRepository(), newFakeUsageCounter(), policy, logging.Discard())
+		ctx := asPrincipal("marketer")
+
+		result, err := svc.ImportCoupons(ctx, rows(), false)
+		require.NoError(t, err)
+		assert.Equal(t, 2, result.Imported)
+
+		half, err := repo.FindByCode(ctx, "HALF")
+		require.NoError(t, err)
+		assert.Equal(t, domain.PendingApproval, half.ApprovalStatus)
+		assert.Equal(t, "marketer", half.CreatedBy)
+	})
+
+	t.Run("any row error aborts the whole import", func(t *testing.T) {
+		repo := newFakeCouponRepository()
+		svc := NewCouponAdminService(repo, newFakeRedemptionRepository(), newFakeUsageCounter(), policy, logging.Discard())
+		ctx := asPrincipal("marketer")
+		require.NoError(t, repo.Create(ctx, newTestCoupon("TAKEN", domain.Fixed, 5)))
+
+		input := append(rows(),
+			domain.CouponImportRow{Line: 4, Coupon: *newTestCoupon("SAVE10", domain.Fixed, 5)},
+			domain.CouponImportRow{Line: 5, Coupon: *newTestCoupon("TAKEN", domain.Fixed, 5)},
+			domain.CouponImportRow{Line: 6, Coupon: *newTestCoupon("BAD", domain.Percentage, 150)},
+			domain.CouponImportRow{Line: 7, ParseError: "discount_value: \"ten\" is not a number"},
+		)
+		result, err := svc.ImportCoupons(ctx, input, false)
+		require.NoError(t, err)
+		assert.Zero(t, result.Imported)
+		require.Len(t, result.Errors, 4)
+		assert.Equal(t, domain.CouponImportError{Line: 4, Code: "SAVE10", Error: "duplicate code, also on line 2"}, result.Errors[0])
+		assert.Equal(t, 5, result.Errors[1].Line)
+		assert.Contains(t, result.Errors[1].Error, "already exists")
+		assert.Equal(t, 6, result.Errors[2].Line)
+		assert.Equal(t, 7, result.Errors[3].Line)
+
+		_, err = repo.FindByCode(ctx, "SAVE10")
+		assert.IsType(t, &domain.CouponNotFoundError{}, err)
+	})
+
+	t.Run("an empty file is rejected", func(t *testing.T) {
+		svc := NewCouponAdminService(newFakeCouponRepository(), newFakeRedemptionRepository(), newFakeUsageCounter(), policy, logging.Discard())
+		_, err := svc.ImportCoupons(asPrincipal("marketer"), nil, false)
+		assert.IsType(t, &domain.InvalidRequestError{}, err)
+	})
+}
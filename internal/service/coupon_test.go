@@ -0,0 +1,350 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/farmako/coupon-system/internal/logging"
+	"github.com/farmako/coupon-system/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRedemptionRepository struct {
+	redemptions []domain.Redemption
+}
+
+func newFakeRedemptionRepository() *fakeRedemptionRepository {
+	return &fakeRedemptionRepository{}
+}
+
+func (r *fakeRedemptionRepository) FindByOrderID(ctx context.Context, orderID string) (*domain.Redemption, error) {
+	for _, redemption := range r.redemptions {
+		if redemption.TenantID == domain.TenantFromContext(ctx) && redemption.OrderID == orderID {
+			return &redemption, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeRedemptionRepository) CountByUser(ctx context.Context, code, userID string) (int64, error) {
+	var count int64
+	for _, redemption := range r.redemptions {
+		if redemption.TenantID == domain.TenantFromContext(ctx) && redemption.CouponCode == code && redemption.UserID == userID && !redemption.Reversed() {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *fakeRedemptionRepository) List(ctx context.Context, filter repository.RedemptionFilter) ([]domain.Redemption, error) {
+	var redemptions []domain.Redemption
+	for _, redemption := range r.redemptions {
+		if redemption.TenantID != domain.TenantFromContext(ctx) {
+			continue
+		}
+		if filter.CouponCode != "" && redemption.CouponCode != filter.CouponCode {
+			continue
+		}
+		if filter.UserID != "" && redemption.UserID != filter.UserID {
+			continue
+		}
+		redemptions = append(redemptions, redemption)
+	}
+	return redemptions, nil
+}
+
+func (r *fakeRedemptionRepository) Create(ctx context.Context, redemption *domain.Redemption) error {
+	redemption.TenantID = domain.TenantFromContext(ctx)
+	r.redemptions = append(r.redemptions, *redemption)
+	return nil
+}
+
+func (r *fakeRedemptionRepository) CreateWithinLimit(ctx context.Context, redemption *domain.Redemption, limit int) (bool, error) {
+	used, err := r.CountByUser(ctx, redemption.CouponCode, redemption.UserID)
+	if err != nil || used >= int64(limit) {
+		return false, err
+	}
+	return true, r.Create(ctx, redemption)
+}
+
+func (r *fakeRedemptionRepository) UpdateReversal(ctx context.Context, redemption *domain.Redemption, refundedBefore domain.Money) error {
+	for i, stored := range r.redemptions {
+		if stored.TenantID == domain.TenantFromContext(ctx) && stored.ID == redemption.ID {
+			if stored.RefundedAmount != refundedBefore {
+				return &domain.ConflictError{Reason: "redemption was refunded concurrently"}
+			}
+			r.redemptions[i] = *redemption
+			return nil
+		}
+	}
+	return &domain.RedemptionNotFoundError{OrderID: redemption.OrderID}
+}
+
+func TestRedeemCoupon(t *testing.T) {
+	ctx := context.Background()
+	coupons := newFakeCouponRepository()
+	redemptions := newFakeRedemptionRepository()
+	svc := NewCouponService(coupons, redemptions, newFakeBlackoutRepository(), newFakeUsageCounter(), nil, logging.Discard())
+
+	oneTime := newTestCoupon("WELCOME", domain.Fixed, 50)
+	oneTime.UsageType = domain.OneTime
+	require.NoError(t, coupons.Create(ctx, oneTime))
+
+	redeem := func(ctx context.Context, orderID, userID string) (*domain.CouponRedemptionResponse, error) {
+		return svc.RedeemCoupon(ctx, domain.CouponRedemptionRequest{
+			CouponValidationRequest: domain.CouponValidationRequest{Code: "WELCOME", OrderValue: domain.MoneyFromInt(200), UserID: userID},
+			OrderID:                 orderID,
+		})
+	}
+
+	t.Run("records the redemption", func(t *testing.T) {
+		response, err := redeem(ctx, "order-1", "user-1")
+		require.NoError(t, err)
+		assert.True(t, response.IsValid)
+		require.NotNil(t, response.Redemption)
+		assert.Equal(t, domain.MoneyFromInt(50), response.Redemption.Discount)
+		assert.Equal(t, domain.DefaultTenant, response.Redemption.TenantID)
+	})
+
+	t.Run("rejects a second redemption for the same order", func(t *testing.T) {
+		_, err := redeem(ctx, "order-1", "user-2")
+		assert.IsType(t, &domain.ConflictError{}, err)
+	})
+
+	t.Run("enforces one-time usage per user", func(t *testing.T) {
+		response, err := redeem(ctx, "order-2", "user-1")
+		require.NoError(t, err)
+		assert.False(t, response.IsValid)
+		assert.Nil(t, response.Redemption)
+	})
+
+	t.Run("isolates coupons and usage per tenant", func(t *testing.T) {
+		other := domain.ContextWithTenant(ctx, "brand-b")
+		_, err := redeem(other, "order-1", "user-1")
+		assert.IsType(t, &domain.CouponNotFoundError{}, err)
+
+		coupon := newTestCoupon("WELCOME", domain.Fixed, 50)
+		coupon.UsageType = domain.OneTime
+		require.NoError(t, coupons.Create(other, coupon))
+
+		response, err := redeem(other, "order-1", "user-1")
+		require.NoError(t, err)
+		assert.True(t, response.IsValid)
+		assert.Equal(t, "brand-b", response.Redemption.TenantID)
+	})
+}
+
+func TestReverseRedemption(t *testing.T) {
+	ctx := context.Background()
+	coupons := newFakeCouponRepository()
+	usage := newFakeUsageCounter()
+	svc := NewCouponService(coupons, newFakeRedemptionRepository(), newFakeBlackoutRepository(), usage, nil, logging.Discard())
+
+	coupon := newTestCoupon("WELCOME", domain.Fixed, 30)
+	coupon.UsageType = domain.OneTime
+	coupon.Budget = domain.MoneyFromInt(1000)
+	require.NoError(t, coupons.Create(ctx, coupon))
+
+	redeem := func(orderID string) *domain.CouponRedemptionResponse {
+		response, err := svc.RedeemCoupon(ctx, domain.CouponRedemptionRequest{
+			CouponValidationRequest: domain.CouponValidationRequest{Code: "WELCOME", OrderValue: domain.MoneyFromInt(90), UserID: "user-1"},
+			OrderID:                 orderID,
+		})
+		require.NoError(t, err)
+		return response
+	}
+	reverse := func(orderID string, refunded *domain.Money) (*domain.Redemption, error) {
+		return svc.ReverseRedemption(ctx, orderID, domain.RedemptionReversalRequest{RefundedAmount: refunded})
+	}
+	stored := func() *domain.Coupon {
+		coupon, err := coupons.FindByCode(ctx, "WELCOME")
+		require.NoError(t, err)
+		return coupon
+	}
+	amount := func(v int64) *domain.Money {
+		m := domain.MoneyFromInt(v)
+		return &m
+	}
+
+	require.True(t, redeem("order-1").IsValid)
+
+	t.Run("partial refunds prorate the discount", func(t *testing.T) {
+		redemption, err := reverse("order-1", amount(20))
+		require.NoError(t, err)
+		assert.Equal(t, domain.MustParseMoney("6.67"), redemption.ReversedDiscount)
+		assert.False(t, redemption.Reversed())
+		assert.Equal(t, domain.MustParseMoney("23.33"), stored().DiscountSpent)
+		assert.Equal(t, 1, stored().RedemptionCount)
+
+		// The user's single use is still taken, and the rejected attempt
+		// gives back what it reserved.
+		assert.Equal(t, domain.ReasonUsageLimitReached, redeem("order-2").Reason)
+		assert.Equal(t, 1, usage.counts[coupon.ID])
+		assert.Equal(t, domain.MustParseMoney("23.33"), usage.spent[coupon.ID])
+	})
+
+	t.Run("repeating a refund changes nothing", func(t *testing.T) {
+		redemption, err := reverse("order-1", amount(20))
+		require.NoError(t, err)
+		assert.Equal(t, domain.MustParseMoney("6.67"), redemption.ReversedDiscount)
+		assert.Equal(t, domain.MustParseMoney("23.33"), stored().DiscountSpent)
+
+		_, err = reverse("order-1", amount(10))
+		assert.IsType(t, &domain.ConflictError{}, err)
+		_, err = reverse("order-1", amount(100))
+		assert.IsType(t, &domain.InvalidRequestError{}, err)
+	})
+
+	t.Run("cancelling the order gives the use back", func(t *testing.T) {
+		redemption, err := reverse("order-1", nil)
+		require.NoError(t, err)
+		assert.True(t, redemption.Reversed())
+		assert.Equal(t, domain.MoneyFromInt(30), redemption.ReversedDiscount)
+		assert.Equal(t, 0, stored().RedemptionCount)
+		assert.Zero(t, stored().DiscountSpent)
+		assert.Equal(t, 0, usage.counts[coupon.ID])
+		assert.Zero(t, usage.spent[coupon.ID])
+
+		again, err := reverse("order-1", nil)
+		require.NoError(t, err)
+		assert.Equal(t, redemption.ReversedAt, again.ReversedAt)
+		assert.Equal(t, 0, stored().RedemptionCount)
+
+		assert.True(t, redeem("order-2").IsValid)
+	})
+
+	t.Run("unknown order", func(t *testing.T) {
+		_, err := reverse("order-9", nil)
+		assert.IsType(t, &domain.RedemptionNotFoundError{}, err)
+	})
+}
+
+func tier(minOrderValue, discountValue int64) domain.DiscountTier {
+	return domain.DiscountTier{MinOrderValue: domain.MoneyFromInt(minOrderValue), DiscountValue: domain.MoneyFromInt(discountValue)}
+}
+
+func TestTieredDiscounts(t *testing.T) {
+	ctx := context.Background()
+	coupons := newFakeCouponRepository()
+	admin := NewCouponAdminService(coupons, newFakeRedemptionRepository(), newFakeUsageCounter(), ApprovalPolicy{PercentageThreshold: domain.MoneyFromInt(12)}, logging.Discard())
+	svc := NewCouponService(coupons, newFakeRedemptionRepository(), newFakeBlackoutRepository(), newFakeUsageCounter(), nil, logging.Discard())
+
+	tiered := newTestCoupon("TIERED", domain.Percentage, 0)
+	tiered.Tiers = domain.DiscountTiers{
+		tier(500, 5),
+		tier(1000, 10),
+	}
+	created, err := admin.CreateCoupon(asPrincipal("marketer"), tiered)
+	require.NoError(t, err)
+	assert.Equal(t, domain.Approved, created.ApprovalStatus)
+
+	validate := func(orderValue string) *domain.CouponValidationResponse {
+		response, err := svc.ValidateCoupon(ctx, domain.CouponValidationRequest{Code: "TIERED", OrderValue: domain.MustParseMoney(orderValue)})
+		require.NoError(t, err)
+		return response
+	}
+
+	t.Run("below the first tier", func(t *testing.T) {
+		response := validate("400")
+		assert.False(t, response.IsValid)
+		assert.Equal(t, domain.ReasonBelowMinimum, response.Reason)
+		assert.Nil(t, response.AppliedTier)
+		assert.Equal(t, domain.MoneyFromInt(500), response.NextTier.MinOrderValue)
+		assert.Equal(t, domain.MoneyFromInt(100), response.AmountToNextTier)
+
+		applicable, err := svc.GetApplicableCoupons(ctx, domain.CouponRequest{OrderValue: domain.MoneyFromInt(400)})
+		require.NoError(t, err)
+		assert.Empty(t, applicable)
+	})
+
+	t.Run("reports the next tier", func(t *testing.T) {
+		response := validate("800.10")
+		assert.True(t, response.IsValid)
+		assert.Equal(t, domain.MustParseMoney("40.01"), response.Discount)
+		assert.Equal(t, domain.MoneyFromInt(5), response.AppliedTier.DiscountValue)
+		assert.Equal(t, domain.MoneyFromInt(10), response.NextTier.DiscountValue)
+		assert.Equal(t, domain.MustParseMoney("199.9"), response.AmountToNextTier)
+	})
+
+	t.Run("top tier", func(t *testing.T) {
+		response := validate("1000")
+		assert.True(t, response.IsValid)
+		assert.Equal(t, domain.MoneyFromInt(100), response.Discount)
+		assert.Equal(t, domain.MoneyFromInt(10), response.AppliedTier.DiscountValue)
+		assert.Nil(t, response.NextTier)
+		assert.Zero(t, response.AmountToNextTier)
+	})
+
+	t.Run("a top tier over the threshold needs approval", func(t *testing.T) {
+		update := newTestCoupon("", domain.Percentage, 0)
+		update.Tiers = domain.DiscountTiers{tier(500, 5), tier(2000, 15)}
+		updated, err := admin.UpdateCoupon(asPrincipal("marketer"), "TIERED", update)
+		require.NoError(t, err)
+		assert.Equal(t, domain.PendingApproval, updated.ApprovalStatus)
+	})
+
+	t.Run("invalid tiers", func(t *testing.T) {
+		for name, tiers := range map[string]domain.DiscountTiers{
+			"out of order":       {tier(1000, 10), tier(500, 15)},
+			"shrinking discount": {tier(500, 10), tier(1000, 5)},
+			"over 100 percent":   {tier(500, 110)},
+		} {
+			coupon := newTestCoupon("BAD", domain.Percentage, 0)
+			coupon.Tiers = tiers
+			_, err := admin.CreateCoupon(asPrincipal("marketer"), coupon)
+			assert.IsType(t, &domain.InvalidRequestError{}, err, name)
+		}
+
+		both := newTestCoupon("BOTH", domain.Percentage, 10)
+		both.Tiers = domain.DiscountTiers{tier(500, 15)}
+		_, err := admin.CreateCoupon(asPrincipal("marketer"), both)
+		assert.IsType(t, &domain.InvalidRequestError{}, err)
+	})
+}
+
+func TestCouponCurrency(t *testing.T) {
+	ctx := context.Background()
+	coupons := newFakeCouponRepository()
+	admin := NewCouponAdminService(coupons, newFakeRedemptionRepository(), newFakeUsageCounter(), ApprovalPolicy{}, logging.Discard())
+	svc := NewCouponService(coupons, newFakeRedemptionRepository(), newFakeBlackoutRepository(), newFakeUsageCounter(), nil, logging.Discard())
+
+	created, err := admin.CreateCoupon(asPrincipal("marketer"), newTestCoupon("FLAT100", domain.Fixed, 100))
+	require.NoError(t, err)
+	assert.Equal(t, domain.DefaultCurrency, created.Currency)
+
+	usd := newTestCoupon("USD5", domain.Fixed, 5)
+	usd.Currency = "USD"
+	_, err = admin.CreateCoupon(asPrincipal("marketer"), usd)
+	require.NoError(t, err)
+
+	t.Run("orders in another currency are rejected", func(t *testing.T) {
+		response, err := svc.ValidateCoupon(ctx, domain.CouponValidationRequest{Code: "FLAT100", OrderValue: domain.MoneyFromInt(500), Currency: "USD"})
+		require.NoError(t, err)
+		assert.False(t, response.IsValid)
+		assert.Equal(t, domain.ReasonCurrencyMismatch, response.Reason)
+
+		response, err = svc.ValidateCoupon(ctx, domain.CouponValidationRequest{Code: "FLAT100", OrderValue: domain.MustParseMoney("119.99")})
+		require.NoError(t, err)
+		assert.True(t, response.IsValid)
+		assert.Equal(t, "INR", response.Currency)
+		assert.Equal(t, domain.MustParseMoney("19.99"), response.FinalAmount)
+	})
+
+	t.Run("applicable coupons are filtered by currency", func(t *testing.T) {
+		applicable, err := svc.GetApplicableCoupons(ctx, domain.CouponRequest{OrderValue: domain.MoneyFromInt(500), Currency: "USD"})
+		require.NoError(t, err)
+		require.Len(t, applicable, 1)
+		assert.Equal(t, "USD5", applicable[0].Code)
+	})
+
+	t.Run("invalid currency codes", func(t *testing.T) {
+		coupon := newTestCoupon("BAD", domain.Fixed, 5)
+		for _, currency := range []string{"rupees", "XYZ", "JPY", "KWD"} {
+			coupon.Currency = currency
+			_, err := admin.CreateCoupon(asPrincipal("marketer"), coupon)
+			assert.IsType(t, &domain.InvalidRequestError{}, err, currency)
+		}
+	})
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"math/big"
+	"slices"
+	"sort"
+
+	"github.com/farmako/coupon-system/internal/domain"
+)
+
+// itemDiscounts works out a per_unit or buy_x_get_y discount line by line,
+// returning one entry per item in the order given. Items the coupon does not
+// apply to get no discount.
+func itemDiscounts(coupon *domain.Coupon, items []domain.CartItem) []domain.ItemDiscount {
+	discounts := lineItems(items)
+	switch coupon.DiscountType {
+	case domain.PerUnit:
+		for i, item := range items {
+			if coupon.AppliesTo(item) {
+				discounts[i].Discount = min(coupon.DiscountValue, item.Price) * domain.Money(item.Units())
+			}
+		}
+	case domain.BuyXGetY:
+		for i, free := range freeUnits(coupon, items) {
+			discounts[i].FreeQuantity = free
+			discounts[i].Discount = items[i].Price * domain.Money(free)
+		}
+	}
+	return discounts
+}
+
+// splitDiscount allocates an order-level discount across the items the coupon
+// applies to, in proportion to their totals. If those items cost less than
+// the discount, it is spread over the whole cart instead. Any part of the
+// discount beyond the price of the cart, such as one on charges included in
+// the order value, is not attributed to an item.
+func splitDiscount(coupon *domain.Coupon, items []domain.CartItem, discount domain.Money) []domain.ItemDiscount {
+	discounts := lineItems(items)
+
+	weights := make([]domain.Money, len(items))
+	var eligible, total domain.Money
+	for i, item := range items {
+		if coupon.AppliesTo(item) {
+			weights[i] = item.Total()
+			eligible += weights[i]
+		}
+		total += item.Total()
+	}
+	if eligible < discount {
+		for i, item := range items {
+			weights[i] = item.Total()
+		}
+	}
+
+	for i, share := range allocate(min(discount, total), weights) {
+		discounts[i].Discount = share
+		discounts[i].DiscountedTotal = discounts[i].Total - share
+	}
+	return discounts
+}
+
+// lineItems returns an undiscounted entry for each item.
+func lineItems(items []domain.CartItem) []domain.ItemDiscount {
+	discounts := make([]domain.ItemDiscount, len(items))
+	for i, item := range items {
+		discounts[i] = domain.ItemDiscount{
+			ID:              item.ID,
+			Quantity:        item.Units(),
+			Total:           item.Total(),
+			DiscountedTotal: item.Total(),
+		}
+	}
+	return discounts
+}
+
+// freeUnits returns how many units of each item a buy_x_get_y coupon makes
+// free. Eligible units are lined up from the most to the least expensive and
+// split into groups of BuyQuantity+GetQuantity; the last GetQuantity units
+// of every complete group are free.
+func freeUnits(coupon *domain.Coupon, items []domain.CartItem) []int {
+	var eligible []int
+	total := 0
+	for i, item := range items {
+		if coupon.AppliesTo(item) {
+			eligible = append(eligible, i)
+			total += item.Units()
+		}
+	}
+	sort.SliceStable(eligible, func(a, b int) bool {
+		return items[eligible[a]].Price > items[eligible[b]].Price
+	})
+
+	group := coupon.BuyQuantity + coupon.GetQuantity
+	limit := total / group * group
+	// freeBefore counts the free units among the first n in line.
+	freeBefore := func(n int) int {
+		n = min(n, limit)
+		return n/group*coupon.GetQuantity + max(n%group-coupon.BuyQuantity, 0)
+	}
+
+	free := make([]int, len(items))
+	position := 0
+	for _, i := range eligible {
+		next := position + items[i].Units()
+		free[i] = freeBefore(next) - freeBefore(position)
+		position = next
+	}
+	return free
+}
+
+// minimumUnits returns how many eligible units a per_unit or buy_x_get_y
+// coupon needs in the cart to give any discount.
+func minimumUnits(coupon *domain.Coupon) int {
+	if coupon.DiscountType == domain.BuyXGetY {
+		return coupon.BuyQuantity + coupon.GetQuantity
+	}
+	return 1
+}
+
+// applyCartItems fills in a request's order value, if it is not set, and its
+// medicine IDs and categories from its cart items.
+func applyCartItems(items []domain.CartItem, orderValue *domain.Money, medicineIDs, categories *[]string) {
+	if len(items) == 0 {
+		return
+	}
+	var total domain.Money
+	for _, item := range items {
+		total += item.Total()
+		if item.ID != "" && !slices.Contains(*medicineIDs, item.ID) {
+			*medicineIDs = append(*medicineIDs, item.ID)
+		}
+		if item.Category != "" && !slices.Contains(*categories, item.Category) {
+			*categories = append(*categories, item.Category)
+		}
+	}
+	if *orderValue == 0 {
+		*orderValue = total
+	}
+}
+
+// eligibleUnits counts the units in the cart a coupon applies to.
+func eligibleUnits(coupon *domain.Coupon, items []domain.CartItem) int {
+	units := 0
+	for _, item := range items {
+		if coupon.AppliesTo(item) {
+			units += item.Units()
+		}
+	}
+	return units
+}
+
+// capItemDiscounts scales item discounts to total, which is less than their
+// sum when a budget cap allows less, and updates the discounted totals. The
+// amounts still add up to total exactly.
+func capItemDiscounts(discounts []domain.ItemDiscount, total domain.Money) {
+	weights := make([]domain.Money, len(discounts))
+	for i, discount := range discounts {
+		weights[i] = discount.Discount
+	}
+	for i, amount := range allocate(total, weights) {
+		discounts[i].Discount = amount
+		discounts[i].DiscountedTotal = discounts[i].Total - amount
+	}
+}
+
+// allocate splits total in proportion to weights. Each share is rounded down
+// to a minor unit and the units left over go to the shares with the largest
+// remainders, earlier ones first on ties, so the result is deterministic and
+// sums to total.
+func allocate(total domain.Money, weights []domain.Money) []domain.Money {
+	shares := make([]domain.Money, len(weights))
+	var sum domain.Money
+	for _, weight := range weights {
+		sum += weight
+	}
+	if sum == 0 {
+		return shares
+	}
+
+	remainders := make([]domain.Money, len(weights))
+	left := total
+	for i, weight := range weights {
+		// total * weight can overflow int64 for large orders.
+		share, remainder := new(big.Int).QuoRem(
+			new(big.Int).Mul(big.NewInt(int64(total)), big.NewInt(int64(weight))),
+			big.NewInt(int64(sum)),
+			new(big.Int),
+		)
+		shares[i] = domain.Money(share.Int64())
+		remainders[i] = domain.Money(remainder.Int64())
+		left -= shares[i]
+	}
+
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]] > remainders[order[b]]
+	})
+	for _, i := range order[:left] {
+		shares[i]++
+	}
+	return shares
+}
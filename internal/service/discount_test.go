@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/farmako/coupon-system/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestItemDiscounts(t *testing.T) {
+	ctx := context.Background()
+	coupons := newFakeCouponRepository()
+	admin := NewCouponAdminService(coupons, newFakeRedemptionRepository(), newFakeUsageCounter(), ApprovalPolicy{FixedThreshold: domain.MoneyFromInt(100)}, logging.Discard())
+	svc := NewCouponService(coupons, newFakeRedemptionRepository(), newFakeBlackoutRepository(), newFakeUsageCounter(), nil, logging.Discard())
+
+	bogo := newTestCoupon("B2G1", domain.BuyXGetY, 0)
+	bogo.BuyQuantity, bogo.GetQuantity = 2, 1
+	bogo.ApplicableCategories = []string{"vitamins"}
+	_, err := admin.CreateCoupon(asPrincipal("marketer"), bogo)
+	require.NoError(t, err)
+
+	perUnit := newTestCoupon("UNIT15", domain.PerUnit, 15)
+	perUnit.ApplicableMedicineIDs = []string{"med1", "med2"}
+	_, err = admin.CreateCoupon(asPrincipal("marketer"), perUnit)
+	require.NoError(t, err)
+
+	validate := func(code string, items ...domain.CartItem) *domain.CouponValidationResponse {
+		response, err := svc.ValidateCoupon(ctx, domain.CouponValidationRequest{Code: code, Items: items})
+		require.NoError(t, err)
+		return response
+	}
+
+	t.Run("buy x get y frees the cheapest units of each group", func(t *testing.T) {
+		response := validate("B2G1",
+			domain.CartItem{ID: "med1", Category: "vitamins", Price: domain.MoneyFromInt(100), Quantity: 2},
+			domain.CartItem{ID: "med2", Category: "vitamins", Price: domain.MoneyFromInt(50), Quantity: 2},
+			domain.CartItem{ID: "med3", Category: "pain-relief", Price: domain.MoneyFromInt(5)},
+			domain.CartItem{ID: "med4", Category: "vitamins", Price: domain.MoneyFromInt(20)},
+			domain.CartItem{ID: "med5", Category: "vitamins", Price: domain.MoneyFromInt(30)},
+		)
+		assert.True(t, response.IsValid)
+		assert.Equal(t, domain.MoneyFromInt(70), response.Discount)
+		assert.Equal(t, domain.MoneyFromInt(285), response.FinalAmount)
+		assert.Equal(t, []domain.ItemDiscount{
+			{ID: "med1", Quantity: 2, Total: domain.MoneyFromInt(200), DiscountedTotal: domain.MoneyFromInt(200)},
+			{ID: "med2", Quantity: 2, FreeQuantity: 1, Total: domain.MoneyFromInt(100), Discount: domain.MoneyFromInt(50), DiscountedTotal: domain.MoneyFromInt(50)},
+			{ID: "med3", Quantity: 1, Total: domain.MoneyFromInt(5), DiscountedTotal: domain.MoneyFromInt(5)},
+			{ID: "med4", Quantity: 1, FreeQuantity: 1, Total: domain.MoneyFromInt(20), Discount: domain.MoneyFromInt(20)},
+			{ID: "med5", Quantity: 1, Total: domain.MoneyFromInt(30), DiscountedTotal: domain.MoneyFromInt(30)},
+		}, response.ItemDiscounts)
+	})
+
+	t.Run("buy x get y needs a full group", func(t *testing.T) {
+		response := validate("B2G1", domain.CartItem{ID: "med1", Category: "vitamins", Price: domain.MoneyFromInt(100), Quantity: 2})
+		assert.False(t, response.IsValid)
+		assert.Equal(t, domain.ReasonNotEnoughItems, response.Reason)
+		assert.Equal(t, "Add 1 more eligible items to get 1 free", response.Message)
+	})
+
+	t.Run("per unit discounts never exceed the unit price", func(t *testing.T) {
+		response := validate("UNIT15",
+			domain.CartItem{ID: "med1", Price: domain.MoneyFromInt(10), Quantity: 3},
+			domain.CartItem{ID: "med2", Price: domain.MoneyFromInt(40), Quantity: 2},
+			domain.CartItem{ID: "med9", Price: domain.MoneyFromInt(60)},
+		)
+		assert.True(t, response.IsValid)
+		assert.Equal(t, domain.MoneyFromInt(60), response.Discount)
+		assert.Equal(t, []domain.Money{domain.MoneyFromInt(30), domain.MoneyFromInt(30), 0}, []domain.Money{
+			response.ItemDiscounts[0].Discount, response.ItemDiscounts[1].Discount, response.ItemDiscounts[2].Discount,
+		})
+	})
+
+	t.Run("a budget cap is split across the items", func(t *testing.T) {
+		capped := newTestCoupon("UNIT15CAP", domain.PerUnit, 15)
+		capped.Budget = domain.MoneyFromInt(40)
+		_, err := admin.CreateCoupon(asPrincipal("marketer"), capped)
+		require.NoError(t, err)
+
+		response := validate("UNIT15CAP", domain.CartItem{ID: "med1", Price: domain.MoneyFromInt(40)}, domain.CartItem{ID: "med2", Price: domain.MoneyFromInt(40), Quantity: 2})
+		assert.Equal(t, domain.MoneyFromInt(40), response.Discount)
+		assert.Equal(t, domain.MustParseMoney("13.33"), response.ItemDiscounts[0].Discount)
+		assert.Equal(t, domain.MustParseMoney("26.67"), response.ItemDiscounts[1].Discount)
+	})
+
+	t.Run("item coupons need eligible items", func(t *testing.T) {
+		response := validate("UNIT15")
+		assert.False(t, response.IsValid)
+
+		applicable, err := svc.GetApplicableCoupons(ctx, domain.CouponRequest{
+			Items: []domain.CartItem{{ID: "med1", Category: "vitamins", Price: domain.MoneyFromInt(10), Quantity: 2}},
+		})
+		require.NoError(t, err)
+		var codes []string
+		for _, coupon := range applicable {
+			codes = append(codes, coupon.Code)
+		}
+		assert.ElementsMatch(t, []string{"UNIT15", "UNIT15CAP"}, codes)
+	})
+
+	t.Run("order discounts are split across eligible items", func(t *testing.T) {
+		percent := newTestCoupon("VIT10", domain.Percentage, 10)
+		percent.ApplicableCategories = []string{"vitamins"}
+		_, err := admin.CreateCoupon(asPrincipal("marketer"), percent)
+		require.NoError(t, err)
+
+		response := validate("VIT10",
+			domain.CartItem{ID: "med1", Category: "vitamins", Price: domain.MustParseMoney("33.33"), Quantity: 3},
+			domain.CartItem{ID: "med2", Category: "pain-relief", Price: domain.MoneyFromInt(50)},
+			domain.CartItem{ID: "med3", Category: "vitamins", Price: domain.MustParseMoney("10.01")},
+		)
+		assert.True(t, response.IsValid)
+		assert.Equal(t, domain.MoneyFromInt(16), response.Discount)
+		assert.Equal(t, []domain.ItemDiscount{
+			{ID: "med1", Quantity: 3, Total: domain.MustParseMoney("99.99"), Discount: domain.MustParseMoney("14.54"), DiscountedTotal: domain.MustParseMoney("85.45")},
+			{ID: "med2", Quantity: 1, Total: domain.MoneyFromInt(50), DiscountedTotal: domain.MoneyFromInt(50)},
+			{ID: "med3", Quantity: 1, Total: domain.MustParseMoney("10.01"), Discount: domain.MustParseMoney("1.46"), DiscountedTotal: domain.MustParseMoney("8.55")},
+		}, response.ItemDiscounts)
+	})
+
+	t.Run("allocations always add up to the discount", func(t *testing.T) {
+		fixed := newTestCoupon("FLAT10", domain.Fixed, 10)
+		_, err := admin.CreateCoupon(asPrincipal("marketer"), fixed)
+		require.NoError(t, err)
+
+		response := validate("FLAT10",
+			domain.CartItem{ID: "med1", Price: domain.MoneyFromInt(20)},
+			domain.CartItem{ID: "med2", Price: domain.MoneyFromInt(20)},
+			domain.CartItem{ID: "med3", Price: domain.MoneyFromInt(20)},
+		)
+		assert.Equal(t, domain.MoneyFromInt(10), response.Discount)
+		assert.Equal(t, []domain.Money{domain.MustParseMoney("3.34"), domain.MustParseMoney("3.33"), domain.MustParseMoney("3.33")}, []domain.Money{
+			response.ItemDiscounts[0].Discount, response.ItemDiscounts[1].Discount, response.ItemDiscounts[2].Discount,
+		})
+	})
+
+	t.Run("a discount larger than the items is only attributed up to their total", func(t *testing.T) {
+		fixed := newTestCoupon("FLAT100", domain.Fixed, 100)
+		_, err := admin.CreateCoupon(asPrincipal("marketer"), fixed)
+		require.NoError(t, err)
+
+		response, err := svc.ValidateCoupon(ctx, domain.CouponValidationRequest{
+			Code:       "FLAT100",
+			OrderValue: domain.MoneyFromInt(150),
+			Items: []domain.CartItem{
+				{ID: "med1", Price: domain.MoneyFromInt(50)},
+				{ID: "med2", Price: domain.MoneyFromInt(30)},
+			},
+		})
+		require.NoError(t, err)
+		assert.True(t, response.IsValid)
+		assert.Equal(t, domain.MoneyFromInt(100), response.Discount)
+		assert.Equal(t, []domain.ItemDiscount{
+			{ID: "med1", Quantity: 1, Total: domain.MoneyFromInt(50), Discount: domain.MoneyFromInt(50)},
+			{ID: "med2", Quantity: 1, Total: domain.MoneyFromInt(30), Discount: domain.MoneyFromInt(30)},
+		}, response.ItemDiscounts)
+	})
+
+	t.Run("invalid coupons", func(t *testing.T) {
+		noGet := newTestCoupon("BAD", domain.BuyXGetY, 0)
+		noGet.BuyQuantity = 2
+		_, err := admin.CreateCoupon(asPrincipal("marketer"), noGet)
+		assert.IsType(t, &domain.InvalidRequestError{}, err)
+
+		stray := newTestCoupon("BAD", domain.Percentage, 10)
+		stray.GetQuantity = 1
+		_, err = admin.CreateCoupon(asPrincipal("marketer"), stray)
+		assert.IsType(t, &domain.InvalidRequestError{}, err)
+	})
+}
+
+func TestAllocate(t *testing.T) {
+	assert.Equal(t, []domain.Money{34, 33, 33}, allocate(100, []domain.Money{1, 1, 1}))
+	assert.Equal(t, []domain.Money{25, 75}, allocate(100, []domain.Money{1000, 3000}))
+	assert.Equal(t, []domain.Money{33, 67}, allocate(100, []domain.Money{1, 2}))
+	assert.Equal(t, []domain.Money{0, 0}, allocate(100, []domain.Money{0, 0}))
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/redis/go-redis/v9"
+)
+
+// UsageCounter enforces coupons' total redemption and budget caps across
+// every instance of the service.
+type UsageCounter interface {
+	// Reserve counts one redemption giving up to discount against the
+	// coupon's caps. It returns the discount granted, which is less than
+	// requested when only part of the budget remains, and false if the caps
+	// are used up.
+	Reserve(ctx context.Context, coupon *domain.Coupon, discount domain.Money) (domain.Money, bool, error)
+	// Release gives back redemptions and discount counted earlier, when a
+	// redemption fails or is reversed.
+	Release(ctx context.Context, coupon *domain.Coupon, redemptions int, discount domain.Money) error
+	// Reset drops the coupon's counters, so that the next reservation seeds
+	// them again from the database.
+	Reset(ctx context.Context, coupon *domain.Coupon) error
+}
+
+// reserveUsage seeds the counters from the database values in ARGV[1] and
+// ARGV[2] when Redis has none, then checks and increments them in one step.
+// Amounts are in minor units so that repeated increments stay exact.
+var reserveUsage = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	redis.call('HSET', KEYS[1], 'count', ARGV[1], 'spent', ARGV[2])
+	redis.call('PEXPIREAT', KEYS[1], ARGV[6])
+end
+local count = tonumber(redis.call('HGET', KEYS[1], 'count'))
+local spent = tonumber(redis.call('HGET', KEYS[1], 'spent'))
+local maxCount = tonumber(ARGV[3])
+local budget = tonumber(ARGV[4])
+local discount = tonumber(ARGV[5])
+if maxCount > 0 and count >= maxCount then
+	return -1
+end
+if budget > 0 then
+	if spent >= budget then
+		return -1
+	end
+	discount = math.min(discount, budget - spent)
+end
+redis.call('HINCRBY', KEYS[1], 'count', 1)
+redis.call('HINCRBY', KEYS[1], 'spent', discount)
+return discount
+`)
+
+// releaseUsage leaves missing counters alone; they are seeded again from the
+// database on the next reservation.
+var releaseUsage = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	redis.call('HINCRBY', KEYS[1], 'count', -tonumber(ARGV[1]))
+	redis.call('HINCRBY', KEYS[1], 'spent', -tonumber(ARGV[2]))
+end
+return 0
+`)
+
+type redisUsageCounter struct {
+	client *redis.Client
+}
+
+// NewRedisUsageCounter returns a UsageCounter that keeps each coupon's counters
+// in a Redis hash until a day after the coupon expires.
+func NewRedisUsageCounter(client *redis.Client) UsageCounter {
+	return &redisUsageCounter{client: client}
+}
+
+func (c *redisUsageCounter) Reserve(ctx context.Context, coupon *domain.Coupon, discount domain.Money) (domain.Money, bool, error) {
+	granted, err := reserveUsage.Run(ctx, c.client, []string{usageKey(coupon)},
+		coupon.RedemptionCount,
+		int64(coupon.DiscountSpent),
+		coupon.MaxTotalUsage,
+		int64(coupon.Budget),
+		int64(discount),
+		coupon.ExpiryDate.Add(24*time.Hour).UnixMilli(),
+	).Int64()
+	if err != nil {
+		return 0, false, err
+	}
+	if granted < 0 {
+		return 0, false, nil
+	}
+	return domain.Money(granted), true, nil
+}
+
+func (c *redisUsageCounter) Release(ctx context.Context, coupon *domain.Coupon, redemptions int, discount domain.Money) error {
+	return releaseUsage.Run(ctx, c.client, []string{usageKey(coupon)}, redemptions, int64(discount)).Err()
+}
+
+func (c *redisUsageCounter) Reset(ctx context.Context, coupon *domain.Coupon) error {
+	return c.client.Del(ctx, usageKey(coupon)).Err()
+}
+
+// usageKey is keyed by ID rather than code, so a deleted coupon's counters
+// never apply to a new coupon with the same code.
+func usageKey(coupon *domain.Coupon) string {
+	return "coupon_usage:" + coupon.ID.String()
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/farmako/coupon-system/internal/domain"
+	"github.com/farmako/coupon-system/internal/logging"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeUsageCounter mirrors the Redis script in memory, in minor units.
+type fakeUsageCounter struct {
+	counts map[uuid.UUID]int
+	spent  map[uuid.UUID]domain.Money
+}
+
+func newFakeUsageCounter() *fakeUsageCounter {
+	return &fakeUsageCounter{counts: make(map[uuid.UUID]int), spent: make(map[uuid.UUID]domain.Money)}
+}
+
+func (c *fakeUsageCounter) Reserve(ctx context.Context, coupon *domain.Coupon, discount domain.Money) (domain.Money, bool, error) {
+	if _, ok := c.counts[coupon.ID]; !ok {
+		c.counts[coupon.ID] = coupon.RedemptionCount
+		c.spent[coupon.ID] = coupon.DiscountSpent
+	}
+	amount := discount
+	if coupon.MaxTotalUsage > 0 && c.counts[coupon.ID] >= coupon.MaxTotalUsage {
+		return 0, false, nil
+	}
+	if budget := coupon.Budget; budget > 0 {
+		if c.spent[coupon.ID] >= budget {
+			return 0, false, nil
+		}
+		amount = min(amount, budget-c.spent[coupon.ID])
+	}
+	c.counts[coupon.ID]++
+	c.spent[coupon.ID] += amount
+	return amount, true, nil
+}
+
+func (c *fakeUsageCounter) Reset(ctx context.Context, coupon *domain.Coupon) error {
+	delete(c.counts, coupon.ID)
+	delete(c.spent, coupon.ID)
+	return nil
+}
+
+func (c *fakeUsageCounter) Release(ctx context.Context, coupon *domain.Coupon, redemptions int, discount domain.Money) error {
+	if _, ok := c.counts[coupon.ID]; ok {
+		c.counts[coupon.ID] -= redemptions
+		c.spent[coupon.ID] -= discount
+	}
+	return nil
+}
+
+func TestTotalUsageCaps(t *testing.T) {
+	policy := ApprovalPolicy{FixedThreshold: domain.MoneyFromInt(1000)}
+	redeem := func(svc CouponService, orderID string) *domain.CouponRedemptionResponse {
+		response, err := svc.RedeemCoupon(context.Background(), domain.CouponRedemptionRequest{
+			CouponValidationRequest: domain.CouponValidationRequest{Code: "FLAT100", OrderValue: domain.MoneyFromInt(500), UserID: "user-" + orderID},
+			OrderID:                 orderID,
+		})
+		require.NoError(t, err)
+		return response
+	}
+
+	t.Run("redemption count cap exhausts the coupon", func(t *testing.T) {
+		repo := newFakeCouponRepository()
+		admin := NewCouponAdminService(repo, newFakeRedemptionRepository(), newFakeUsageCounter(), policy, logging.Discard())
+		svc := NewCouponService(repo, newFakeRedemptionRepository(), newFakeBlackoutRepository(), newFakeUsageCounter(), nil, logging.Discard())
+
+		coupon := newTestCoupon("FLAT100", domain.Fixed, 100)
+		coupon.MaxTotalUsage = 2
+		_, err := admin.CreateCoupon(asPrincipal("marketer"), coupon)
+		require.NoError(t, err)
+
+		assert.True(t, redeem(svc, "1").IsValid)
+		assert.True(t, redeem(svc, "2").IsValid)
+		response := redeem(svc, "3")
+		assert.False(t, response.IsValid)
+		assert.Equal(t, domain.ReasonExhausted, response.Reason)
+
+		stored, err := admin.GetCoupon(context.Background(), "FLAT100")
+		require.NoError(t, err)
+		assert.Equal(t, 2, stored.RedemptionCount)
+		assert.Equal(t, domain.StatusExhausted, stored.Status(time.Now()))
+
+		validation, err := svc.ValidateCoupon(context.Background(), domain.CouponValidationRequest{Code: "FLAT100", OrderValue: domain.MoneyFromInt(500)})
+		require.NoError(t, err)
+		assert.Equal(t, domain.ReasonExhausted, validation.Reason)
+
+		// Raising the cap brings the coupon back, and updates keep the counters.
+		raised := newTestCoupon("", domain.Fixed, 100)
+		raised.MaxTotalUsage = 3
+		updated, err := admin.UpdateCoupon(asPrincipal("marketer"), "FLAT100", raised)
+		require.NoError(t, err)
+		assert.Equal(t, 2, updated.RedemptionCount)
+		assert.True(t, redeem(svc, "4").IsValid)
+	})
+
+	t.Run("re-adding a removed cap recounts usage from the database", func(t *testing.T) {
+		repo := newFakeCouponRepository()
+		usage := newFakeUsageCounter()
+		admin := NewCouponAdminService(repo, newFakeRedemptionRepository(), usage, policy, logging.Discard())
+		svc := NewCouponService(repo, newFakeRedemptionRepository(), newFakeBlackoutRepository(), usage, nil, logging.Discard())
+
+		coupon := newTestCoupon("FLAT100", domain.Fixed, 100)
+		coupon.MaxTotalUsage = 2
+		_, err := admin.CreateCoupon(asPrincipal("marketer"), coupon)
+		require.NoError(t, err)
+		assert.True(t, redeem(svc, "1").IsValid)
+		assert.True(t, redeem(svc, "2").IsValid)
+
+		// Reversals made without a cap are not released from the counters.
+		_, err = admin.UpdateCoupon(asPrincipal("marketer"), "FLAT100", newTestCoupon("", domain.Fixed, 100))
+		require.NoError(t, err)
+		_, err = svc.ReverseRedemption(context.Background(), "1", domain.RedemptionReversalRequest{})
+		require.NoError(t, err)
+
+		capped := newTestCoupon("", domain.Fixed, 100)
+		capped.MaxTotalUsage = 2
+		_, err = admin.UpdateCoupon(asPrincipal("marketer"), "FLAT100", capped)
+		require.NoError(t, err)
+		assert.True(t, redeem(svc, "3").IsValid)
+		assert.Equal(t, domain.ReasonExhausted, redeem(svc, "4").Reason)
+	})
+
+	t.Run("budget cap limits the last discount and reports what remains", func(t *testing.T) {
+		repo := newFakeCouponRepository()
+		admin := NewCouponAdminService(repo, newFakeRedemptionRepository(), newFakeUsageCounter(), policy, logging.Discard())
+		svc := NewCouponService(repo, newFakeRedemptionRepository(), newFakeBlackoutRepository(), newFakeUsageCounter(), nil, logging.Discard())
+
+		coupon := newTestCoupon("FLAT100", domain.Fixed, 100)
+		coupon.Budget = domain.MoneyFromInt(250)
+		_, err := admin.CreateCoupon(asPrincipal("marketer"), coupon)
+		require.NoError(t, err)
+
+		assert.Equal(t, domain.MoneyFromInt(100), redeem(svc, "1").Discount)
+		assert.Equal(t, domain.MoneyFromInt(100), redeem(svc, "2").Discount)
+
+		stored, err := admin.GetCoupon(context.Background(), "FLAT100")
+		require.NoError(t, err)
+		data, err := json.Marshal(stored)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), `"remaining_budget":50`)
+		assert.NotContains(t, string(data), "remaining_usage")
+
+		last := redeem(svc, "3")
+		assert.True(t, last.IsValid)
+		assert.Equal(t, domain.MoneyFromInt(50), last.Discount)
+		assert.Equal(t, domain.MoneyFromInt(450), last.FinalAmount)
+		assert.Equal(t, domain.MoneyFromInt(50), last.Redemption.Discount)
+
+		assert.Equal(t, domain.ReasonExhausted, redeem(svc, "4").Reason)
+	})
+
+	t.Run("caps must not be negative", func(t *testing.T) {
+		admin := NewCouponAdminService(newFakeCouponRepository(), newFakeRedemptionRepository(), newFakeUsageCounter(), policy, logging.Discard())
+		coupon := newTestCoupon("FLAT100", domain.Fixed, 100)
+		coupon.Budget = -1
+		_, err := admin.CreateCoupon(asPrincipal("marketer"), coupon)
+		assert.IsType(t, &domain.InvalidRequestError{}, err)
+	})
+}
@@ -0,0 +1,70 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const spanKey = "tracing:span"
+
+// InstrumentDB registers GORM callbacks that create a client span for every
+// database call, parented to the context passed to WithContext.
+func InstrumentDB(db *gorm.DB) error {
+	callbacks := db.Callback()
+	return errors.Join(
+		callbacks.Create().Before("gorm:create").Register("tracing:before_create", startDBSpan("INSERT")),
+		callbacks.Create().After("gorm:create").Register("tracing:after_create", endDBSpan),
+		callbacks.Query().Before("gorm:query").Register("tracing:before_query", startDBSpan("SELECT")),
+		callbacks.Query().After("gorm:query").Register("tracing:after_query", endDBSpan),
+		callbacks.Update().Before("gorm:update").Register("tracing:before_update", startDBSpan("UPDATE")),
+		callbacks.Update().After("gorm:update").Register("tracing:after_update", endDBSpan),
+		callbacks.Delete().Before("gorm:delete").Register("tracing:before_delete", startDBSpan("DELETE")),
+		callbacks.Delete().After("gorm:delete").Register("tracing:after_delete", endDBSpan),
+		callbacks.Row().Before("gorm:row").Register("tracing:before_row", startDBSpan("ROW")),
+		callbacks.Row().After("gorm:row").Register("tracing:after_row", endDBSpan),
+		callbacks.Raw().Before("gorm:raw").Register("tracing:before_raw", startDBSpan("RAW")),
+		callbacks.Raw().After("gorm:raw").Register("tracing:after_raw", endDBSpan),
+	)
+}
+
+func startDBSpan(operation string) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		ctx := tx.Statement.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		name := operation
+		if tx.Statement.Table != "" {
+			name += " " + tx.Statement.Table
+		}
+		_, span := otel.Tracer(instrumentationName).Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				semconv.DBSystemKey.String(tx.Dialector.Name()),
+				semconv.DBOperationName(operation),
+				semconv.DBCollectionName(tx.Statement.Table),
+			),
+		)
+		tx.InstanceSet(spanKey, span)
+	}
+}
+
+func endDBSpan(tx *gorm.DB) {
+	value, ok := tx.InstanceGet(spanKey)
+	if !ok {
+		return
+	}
+	span := value.(trace.Span)
+	span.SetAttributes(semconv.DBQueryText(tx.Statement.SQL.String()))
+
+	err := tx.Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = nil
+	}
+	endSpan(span, err)
+}